@@ -0,0 +1,63 @@
+// Package activation gets the sockets passed by systemd socket activation, so that a service
+// can use sockets that systemd has already bound, such as privileged ports.
+//
+// See https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// firstFD is the file descriptor of the first socket passed by systemd.
+var firstFD = 3
+
+// Socket is a listening socket passed by systemd.
+type Socket struct {
+	Name string // from FileDescriptorName in the .socket unit; "unknown" by default
+	net.Listener
+}
+
+// Listeners gets the listening sockets passed by systemd, in the order they were passed. It
+// returns none if the process was not socket-activated. The environment variables are unset
+// so that child processes don't also try to use the sockets.
+func Listeners() ([]Socket, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	sockets := make([]Socket, n)
+	for i := range sockets {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// FileListener duplicates the descriptor, so the original is closed
+		f := os.NewFile(uintptr(firstFD+i), name)
+		listener, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d (%s): %w", firstFD+i, name, err)
+		}
+
+		sockets[i] = Socket{Name: name, Listener: listener}
+	}
+
+	return sockets, nil
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package activation
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/rickb777/expect"
+)
+
+func TestListeners(t *testing.T) {
+	web, err := net.Listen("tcp", "localhost:0")
+	expect.Error(err).Not().ToHaveOccurred(t)
+	defer web.Close()
+
+	// systemd passes consecutive descriptors, so this relies on the two duplicates being
+	// allocated next to each other
+	f, err := web.(*net.TCPListener).File()
+	expect.Error(err).Not().ToHaveOccurred(t)
+	webFD, err := syscall.Dup(int(f.Fd()))
+	expect.Error(err).Not().ToHaveOccurred(t)
+	adminFD, err := syscall.Dup(int(f.Fd()))
+	expect.Error(err).Not().ToHaveOccurred(t)
+	expect.Error(f.Close()).Not().ToHaveOccurred(t)
+	if adminFD != webFD+1 {
+		t.Skip("file descriptors are not consecutive")
+	}
+
+	firstFD = webFD
+	t.Cleanup(func() { firstFD = 3 })
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "http:admin")
+
+	sockets, err := Listeners()
+	expect.Error(err).Not().ToHaveOccurred(t)
+	expect.Slice(sockets).ToHaveLength(t, 2)
+	expect.String(sockets[0].Name).ToBe(t, "http")
+	expect.String(sockets[1].Name).ToBe(t, "admin")
+	expect.String(sockets[0].Addr().String()).ToBe(t, web.Addr().String())
+	expect.String(os.Getenv("LISTEN_FDS")).ToBe(t, "")
+
+	for _, s := range sockets {
+		expect.Error(s.Close()).Not().ToHaveOccurred(t)
+	}
+}
+
+func TestListeners_notActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+
+	sockets, err := Listeners()
+	expect.Error(err).Not().ToHaveOccurred(t)
+	expect.Slice(sockets).ToBeEmpty(t)
+}
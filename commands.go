@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/explain"
+	"github.com/spf13/afero"
+)
+
+// explainURLs prints why each URL was or wasn't crawled in the last run, returning the exit code.
+func explainURLs(w io.Writer, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(w, "Must provide one or more URLs to explain")
+		return 1
+	}
+
+	urls, err := parseAll(args)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid URL: %s\n", err)
+		return 1
+	}
+
+	trail, err := explain.Load(afero.NewOsFs(), db.StateDir())
+	if err != nil {
+		fmt.Fprintf(w, "There is no trail from a previous run: %s\n", err)
+		return 1
+	}
+
+	for _, u := range urls {
+		if err := trail.Explain(w, u); err != nil {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// filterTest prints what the rules given by the options do to each URL, returning the exit code.
+// The URLs are read from stdin if there are none in the arguments.
+func filterTest(w io.Writer, stdin io.Reader, args []string) int {
+	arguments, err := declareFlags(args)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid flags: %s\n", err)
+		return 1
+	}
+
+	arguments, err = applyEnvironment(arguments)
+	if err != nil {
+		fmt.Fprintf(w, "Config error: %s\n", err)
+		return 1
+	}
+
+	cfg, err := buildConfig(arguments)
+	if err != nil {
+		fmt.Fprintf(w, "Config error: %s\n", err)
+		return 1
+	}
+
+	list := flag.Args()
+	if len(list) == 0 {
+		s := bufio.NewScanner(stdin)
+		for s.Scan() {
+			list = append(list, s.Text())
+		}
+	}
+
+	urls, err := parseAll(list)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid URL: %s\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, u := range urls {
+		if rule, found := cfg.Rules.Match(u); found {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", rule.Action, u, rule)
+		} else {
+			fmt.Fprintf(tw, "include\t%s\tno rule matched\n", u)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return 1
+	}
+
+	return 0
+}
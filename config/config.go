@@ -3,20 +3,27 @@ package config
 import (
 	"math"
 	"net/http"
-	"regexp"
 	"time"
 
+	"github.com/rickb777/goscrape2/filter"
 	"github.com/rickb777/goscrape2/images"
+	"github.com/rickb777/goscrape2/linkcheck"
+	"github.com/rickb777/goscrape2/mapping"
 )
 
 // Config contains the scraper configuration.
 type Config struct {
-	Includes []*regexp.Regexp
-	Excludes []*regexp.Regexp
+	Rules     filter.Rules          // decides which URLs are fetched, saved and followed
+	Responses filter.ResponseFilter // rejects responses by their size or content type
+	External  linkcheck.Config      // checks links to other hosts
 
 	Concurrency    int                 // number of concurrent downloads; default 1
 	MaxDepth       int                 // download depth, 0 for unlimited
 	ImageQuality   images.ImageQuality // image quality from 0 to 100%, 0 to disable reencoding
+	Scripts        ScriptMode          // heuristic URL discovery in JavaScript and JSON
+	FeedUpdate     bool                // only follow feed entries newer than those seen previously
+	Compression    mapping.Compression // whether compressible files are stored gzip-compressed
+	Spider         bool                // discover URLs without saving anything; only HTML and CSS are fetched
 	RequestTimeout time.Duration       // overall time limit to process each http request
 	ConnectTimeout time.Duration       // time limit for connecting to the origin server
 	LoopDelay      time.Duration       // fixed value sleep time per request
@@ -32,6 +39,15 @@ type Config struct {
 	UserAgent string
 }
 
+// ScriptMode controls the heuristic discovery of URLs in JavaScript and JSON.
+type ScriptMode int
+
+const (
+	ScriptsIgnored   ScriptMode = iota // scripts are not scanned
+	ScriptsScanned                     // URLs found in scripts are downloaded
+	ScriptsRewritten                   // URLs found in scripts are downloaded and relinked
+)
+
 func (c *Config) GetLaxAge() time.Duration {
 	if c.LaxAge > 0 {
 		return c.LaxAge
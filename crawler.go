@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	urlpkg "net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/progress"
+	"github.com/rickb777/goscrape2/scraper"
+	"github.com/rickb777/goscrape2/sdnotify"
+	"github.com/rickb777/goscrape2/server"
+	"github.com/spf13/afero"
+)
+
+// crawler crawls the start URLs. Whilst the webserver is running, a signal starts a fresh
+// crawl and another reloads the configuration, but neither is allowed during a crawl.
+type crawler struct {
+	fs        afero.Fs
+	term      *progress.Terminal
+	base      Arguments // from the command line, before the environment is applied
+	serve     bool
+	listeners server.Listeners
+
+	args Arguments
+	cfg  config.Config
+	mu   sync.Mutex // guards args and cfg, which are replaced by a reload
+
+	etagStore *db.DB
+	webServer *http.Server // guarded by mu, because the watchdog reads it
+	errChan   chan error
+	busy      atomic.Bool // set during a crawl or a reload
+
+	recrawl func(ctx context.Context) error // crawls again on a signal; normally c.crawl
+}
+
+// run crawls the start URLs, then keeps the webserver running, if enabled, until it stops.
+func (c *crawler) run(ctx context.Context) error {
+	if !c.cfg.Spider {
+		// spidering stores no files, so it neither uses nor updates their metadata
+		c.etagStore = db.Open()
+		defer c.etagStore.Close()
+	}
+
+	sdnotify.StartWatchdog(ctx, c.alive)
+
+	stopSignals := c.handleSignals(ctx)
+	defer stopSignals()
+
+	if !c.serve {
+		sdnotify.Ready() // otherwise, when the webserver is listening
+	}
+
+	c.busy.Store(true)
+	if err := c.crawl(ctx); err != nil || !c.serve {
+		return err // there will be no more crawls
+	}
+	c.busy.Store(false)
+
+	sdnotify.Status("Scraping finished; serving on demand")
+	return server.AwaitWebserver(ctx, c.webServer, c.errChan)
+}
+
+// crawl scrapes each start URL once. The webserver is launched for the first, if enabled and
+// not already running.
+func (c *crawler) crawl(ctx context.Context) error {
+	c.mu.Lock()
+	args, cfg := c.args, c.cfg
+	c.mu.Unlock()
+
+	out, err := openReports(args, c.term)
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+
+	out.startExternal(ctx, cfg, c.etagStore)
+	finish := sync.OnceFunc(func() { out.finish(c.fs) })
+	defer finish()
+
+	for _, startURL := range args.URLs {
+		url := *startURL // each crawl has its own copy, which the scraper alters
+		sc, err := scraper.New(cfg, &url, afero.NewBasePathFs(c.fs, cfg.Directory))
+		if err != nil {
+			return fmt.Errorf("initializing scraper: %w", err)
+		}
+
+		sc.ETagsDB = c.etagStore
+		out.attach(sc)
+
+		if c.serve && c.webServer == nil {
+			webServer, errChan, err := server.LaunchWebserver(sc, cfg.Directory, c.listeners)
+			if err != nil {
+				return fmt.Errorf("launching webserver: %w", err)
+			}
+
+			c.mu.Lock()
+			c.webServer, c.errChan = webServer, errChan
+			c.mu.Unlock()
+		}
+
+		logger.Info("Scraping", slog.String("url", sc.URL.String()))
+		sdnotify.Status("Scraping " + sc.URL.String())
+		stopProgress := out.showProgress(ctx, sc)
+		err = sc.Start(ctx)
+		stopProgress()
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				c.listeners.Close() // removes any Unix domain socket
+				logger.Exit(1)
+			}
+
+			var ue *urlpkg.Error
+			if errors.As(err, &ue) {
+				if c.serve {
+					logger.Warn("HTTP request failed",
+						slog.String("url", url.String()),
+						slog.Any("error", err))
+					continue // ignore because the webserver is operational
+				}
+			}
+
+			return fmt.Errorf("HTTP get %s failed: %w", &url, err)
+		}
+
+		if args.SaveCookieFile != "" {
+			if err := saveCookies(args.SaveCookieFile, sc.Cookies()); err != nil {
+				return fmt.Errorf("saving cookies url=%s: %w", &url, err)
+			}
+		}
+	}
+
+	finish()
+	return nil
+}
+
+// alive tests whether the service is working, for the systemd watchdog. Once the webserver is
+// running, it must be ready, which includes having loaded the state database; before that, or
+// without a webserver, the state database must be loaded, unless it is not used.
+func (c *crawler) alive() bool {
+	c.mu.Lock()
+	webServer := c.webServer
+	c.mu.Unlock()
+
+	if webServer != nil {
+		return server.Ready(webServer)
+	}
+	return c.etagStore == nil || c.etagStore.Loaded()
+}
+
+// handleSignals handles the signals to crawl again and to reload the configuration until the
+// returned function is called.
+func (c *crawler) handleSignals(ctx context.Context) (stop func()) {
+	if recrawlSignal == nil {
+		return func() {} // not supported on this platform
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, recrawlSignal, reloadSignal)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				c.handleSignal(ctx, sig)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func (c *crawler) handleSignal(ctx context.Context, sig os.Signal) {
+	if !c.busy.CompareAndSwap(false, true) {
+		logger.Warn("Crawl already running; signal rejected", slog.String("signal", sig.String()))
+		return
+	}
+
+	switch sig {
+	case recrawlSignal:
+		go func() {
+			defer c.busy.Store(false)
+			logger.Info("Crawling again", slog.String("signal", sig.String()))
+			if err := c.recrawl(ctx); err != nil {
+				logger.Error("Scraping execution error", slog.Any("error", err))
+			}
+			sdnotify.Status("Scraping finished; serving on demand")
+		}()
+
+	case reloadSignal:
+		defer c.busy.Store(false)
+		if err := c.reload(); err != nil {
+			logger.Error("Cannot reload configuration", slog.Any("error", err))
+		}
+	}
+}
+
+// reload re-reads the GOSCRAPE_ variables, which the next crawl uses. The webserver keeps the
+// scraper of the first crawl, so its on-demand fetching and metrics are not affected.
+func (c *crawler) reload() error {
+	args, err := applyEnvironment(c.base)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := buildConfig(args)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.args, c.cfg = args, *cfg
+	c.mu.Unlock()
+
+	logger.Info("Reloaded configuration",
+		slog.String("file", args.ConfigFile),
+		slog.Int("urls", len(args.URLs)),
+		slog.Int("include", len(args.Include.Values)),
+		slog.Int("exclude", len(args.Exclude.Values)),
+		slog.Int("headers", len(args.Headers.Values)),
+		slog.Duration("loopdelay", args.LoopDelay))
+	return nil
+}
@@ -0,0 +1,92 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+)
+
+// stubCrawl stands in for a crawl, which runs until it is released.
+type stubCrawl struct {
+	started chan struct{}
+	release chan struct{}
+	count   atomic.Int32
+}
+
+func newStubCrawl() *stubCrawl {
+	return &stubCrawl{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (s *stubCrawl) crawl(ctx context.Context) error {
+	s.count.Add(1)
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func awaitIdle(t *testing.T, c *crawler) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); c.busy.Load(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("crawler is still busy")
+		}
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "goscrape.conf")
+	expect.Error(os.WriteFile(path, []byte(content), 0644)).ToBeNil(t)
+	return path
+}
+
+func TestHandleSignal_recrawl(t *testing.T) {
+	stub := newStubCrawl()
+	c := &crawler{recrawl: stub.crawl}
+
+	c.handleSignal(context.Background(), recrawlSignal)
+	<-stub.started
+	expect.Bool(c.busy.Load()).I("crawling").ToBeTrue(t)
+
+	close(stub.release)
+	awaitIdle(t, c)
+	expect.Number(stub.count.Load()).ToBe(t, 1)
+}
+
+func TestHandleSignal_reload(t *testing.T) {
+	base := Arguments{ConfigFile: writeConfigFile(t, "GOSCRAPE_URLS=\"https://example.org/ https://example.com/\"\nGOSCRAPE_LOOPDELAY=250ms\n")}
+	c := &crawler{base: base, recrawl: newStubCrawl().crawl}
+
+	c.handleSignal(context.Background(), reloadSignal)
+
+	expect.Bool(c.busy.Load()).I("busy").ToBeFalse(t)
+	expect.Slice(c.args.URLs).ToHaveLength(t, 2)
+	expect.Number(c.cfg.LoopDelay).ToBe(t, 250*time.Millisecond)
+}
+
+func TestHandleSignal_rejectedDuringCrawl(t *testing.T) {
+	base := Arguments{ConfigFile: writeConfigFile(t, "GOSCRAPE_LOOPDELAY=250ms\n")}
+	stub := newStubCrawl()
+	c := &crawler{base: base, recrawl: stub.crawl}
+
+	c.handleSignal(context.Background(), recrawlSignal)
+	<-stub.started
+
+	c.handleSignal(context.Background(), recrawlSignal)
+	c.handleSignal(context.Background(), reloadSignal)
+	expect.Number(c.cfg.LoopDelay).I("not reloaded").ToBe(t, 0)
+
+	close(stub.release)
+	awaitIdle(t, c)
+	expect.Number(stub.count.Load()).I("crawls").ToBe(t, 1)
+
+	c.handleSignal(context.Background(), reloadSignal)
+	expect.Number(c.cfg.LoopDelay).I("reloaded").ToBe(t, 250*time.Millisecond)
+}
@@ -2,9 +2,11 @@ package db
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/mapping"
+	"github.com/rickb777/goscrape2/metrics"
 	"github.com/spf13/afero"
 	"io"
 	"log/slog"
@@ -26,18 +28,20 @@ const FileName = "goscrape-cache.txt"
 // repeating a download session. If the store is unavailable for some reason, its methods are no-ops.
 type DB struct {
 	dir          string
+	loaded       bool // false if the file exists but could not be read
 	records      map[string]Item
 	unsavedItems int
+	flushTimes   *metrics.Histogram
 	fs           afero.Fs
 	mu           sync.Mutex
 }
 
 func DeleteFile(fs afero.Fs) {
-	_ = fs.Remove(filepath.Join(localStateDir(), FileName))
+	_ = fs.Remove(filepath.Join(StateDir(), FileName))
 }
 
 func Open() *DB {
-	return OpenDB(localStateDir(), afero.NewOsFs())
+	return OpenDB(StateDir(), afero.NewOsFs())
 }
 
 func OpenDB(dir string, fs afero.Fs) *DB {
@@ -47,13 +51,26 @@ func OpenDB(dir string, fs afero.Fs) *DB {
 		return nil
 	}
 
-	store := &DB{dir: appendSlash(dir), fs: fs, records: make(map[string]Item)}
+	store := &DB{dir: appendSlash(dir), fs: fs, records: make(map[string]Item), flushTimes: metrics.NewHistogram(metrics.DefaultSeconds...)}
 
 	fileName := filepath.Join(dir, FileName)
 	f, err := fs.Open(fileName)
-	if err == nil {
+	switch {
+	case err == nil:
 		defer f.Close()
-		store.records, err = readFile(f)
+		records, err := readFile(f)
+		if err != nil {
+			logger.DB.Warn("Cannot read DB", slog.Any("err", err), slog.String("file", fileName))
+		} else {
+			store.records = records
+			store.loaded = true
+		}
+
+	case errors.Is(err, os.ErrNotExist):
+		store.loaded = true // there is nothing to load yet
+
+	default:
+		logger.DB.Warn("Cannot open DB", slog.Any("err", err), slog.String("file", fileName))
 	}
 
 	go store.syncPeriodically(time.Second)
@@ -87,12 +104,12 @@ func readFile(rdr io.Reader) (map[string]Item, error) {
 			}
 		}
 	}
-	return records, nil
+	return records, s.Err()
 }
 
-// localStateDir gets the XDG state directory, a place for storage of volatile
+// StateDir gets the XDG state directory, a place for storage of volatile
 // application state. See https://specifications.freedesktop.org/basedir-spec/
-func localStateDir() string {
+func StateDir() string {
 	dir := os.Getenv("XDG_STATE_HOME")
 	if dir != "" {
 		return dir
@@ -126,6 +143,39 @@ func (store *DB) Close() error {
 	return nil
 }
 
+// Loaded tests whether the records have been loaded, or there were none, and the store is
+// still open.
+func (store *DB) Loaded() bool {
+	if store == nil {
+		return false // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.loaded && store.dir != ""
+}
+
+// Len gets the number of records.
+func (store *DB) Len() int {
+	if store == nil {
+		return 0 // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return len(store.records)
+}
+
+// FlushTimes gets the times taken, in seconds, to write the file.
+func (store *DB) FlushTimes() *metrics.Histogram {
+	if store == nil {
+		return nil // no-op if absent
+	}
+	return store.flushTimes
+}
+
 // keyOf gets the canonical minimal form of the URL as a string such that all escaped
 // characters are unescaped, where possible. The URL fragment is discarded.
 func keyOf(u *urlpkg.URL) string {
@@ -173,6 +223,10 @@ func (store *DB) Store(url *urlpkg.URL, item Item) {
 	case http.StatusOK, http.StatusNotFound:
 		store.records[keyOf(url)] = item
 
+	case http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		// responses that were rejected for their size or content type
+		store.records[keyOf(url)] = item
+
 	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
 		if item.Location != "" {
 			store.records[keyOf(url)] = item
@@ -194,6 +248,44 @@ func (store *DB) Store(url *urlpkg.URL, item Item) {
 	}
 }
 
+// linkKeyPrefix distinguishes the results of checking external links from the metadata of
+// downloads, which might be for the same URLs.
+const linkKeyPrefix = "link:"
+
+// LookupLink finds the cached result of checking an external link.
+func (store *DB) LookupLink(u *urlpkg.URL) Item {
+	if store == nil {
+		return Item{} // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.records[linkKeyPrefix+keyOf(u)]
+}
+
+// StoreLink caches the result of checking an external link. The item's Expires time
+// should be set to limit how long it is kept.
+func (store *DB) StoreLink(u *urlpkg.URL, item Item) {
+	if store == nil {
+		return // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if item.Empty() {
+		delete(store.records, linkKeyPrefix+keyOf(u))
+	} else {
+		store.records[linkKeyPrefix+keyOf(u)] = item
+	}
+
+	store.unsavedItems++
+	if store.unsavedItems >= maxNumberOfUnsavedItems {
+		store.writeFileAtomically()
+	}
+}
+
 // maxNumberOfUnsavedItems balances the cost of writing to disk against the lost items that
 // could happen when the whole app is interrupted.
 const maxNumberOfUnsavedItems = 100
@@ -206,6 +298,9 @@ func (store *DB) writeFileAtomically() {
 		return // already closed
 	}
 
+	started := time.Now()
+	defer func() { store.flushTimes.Observe(time.Since(started).Seconds()) }()
+
 	temporaryName := store.dir + randomName()
 	store.writeFile(temporaryName)
 
@@ -213,9 +308,9 @@ func (store *DB) writeFileAtomically() {
 	//_ = os.Remove(store.file) -- not needed on Linux
 	if err := store.fs.Rename(temporaryName, store.dir+FileName); err != nil {
 		_ = store.fs.Remove(temporaryName)
-		logger.Warn("Cannot rename DB", slog.Any("temp", temporaryName), slog.String("file", store.dir+FileName))
+		logger.DB.Warn("Cannot rename DB", slog.Any("temp", temporaryName), slog.String("file", store.dir+FileName))
 	} else {
-		logger.Debug("Wrote DB", slog.String("file", store.dir+FileName))
+		logger.DB.Debug("Wrote DB", slog.String("file", store.dir+FileName))
 	}
 
 	store.unsavedItems = 0
@@ -226,7 +321,7 @@ func (store *DB) writeFileAtomically() {
 func (store *DB) writeFile(fileName string) {
 	file, err := store.fs.Create(fileName)
 	if err != nil {
-		logger.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", fileName))
+		logger.DB.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", fileName))
 		return
 	}
 	defer file.Close()
@@ -242,7 +337,7 @@ func (store *DB) writeFile(fileName string) {
 	buf := bufio.NewWriter(file)
 	for _, key := range keys {
 		if err := writeItem(buf, key, store.records[key]); err != nil {
-			logger.Warn("Cannot write DB", slog.Any("err", err), slog.String("file", fileName))
+			logger.DB.Warn("Cannot write DB", slog.Any("err", err), slog.String("file", fileName))
 			return
 		}
 	}
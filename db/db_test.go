@@ -21,6 +21,9 @@ func Test_writeItem(t *testing.T) {
 	writeItem(buf, "k2", Item{Code: 200, Content: textHtml, Expires: t1.Add(time.Hour), ETags: `"abc123"`})
 	writeItem(buf, "k3", Item{Code: 200, ETags: `"def123"`})
 	writeItem(buf, "k4", Item{Code: 308, Location: "/foo/bar.html"})
+	writeItem(buf, "k5", Item{Code: 200, Latest: t1})
+	writeItem(buf, "k6", Item{Code: 413, Content: header.ContentType{MediaType: "video/mp4"}, Size: 123456})
+	writeItem(buf, "k7", Item{Code: 200, Content: header.ContentType{MediaType: "text/plain"}, Sniffed: header.ContentType{MediaType: "text/html"}})
 
 	s := strings.Split(buf.String(), "\n")
 
@@ -28,6 +31,32 @@ func Test_writeItem(t *testing.T) {
 	expect.String(s[1]).ToBe(t, `k2	200	-	text/html	2000-01-01T02:01:01Z	"abc123"`)
 	expect.String(s[2]).ToBe(t, `k3	200	-	-	-	"def123"`)
 	expect.String(s[3]).ToBe(t, `k4	308	/foo/bar.html	-	-	-`)
+	expect.String(s[4]).ToBe(t, `k5	200	-	-	-	-	2000-01-01T01:01:01Z`)
+	expect.String(s[5]).ToBe(t, `k6	413	-	video/mp4	-	-	-	123456`)
+	expect.String(s[6]).ToBe(t, `k7	200	-	text/plain	-	-	-	-	text/html`)
+}
+
+func Test_parseItem(t *testing.T) {
+	t1 := time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)
+
+	k1, v1 := parseItem(`k1	200	-	text/html	2000-01-01T01:01:01Z	"abc123"`)
+	expect.String(k1).ToBe(t, "k1")
+	expect.Any(v1).ToBe(t, Item{Code: 200, Content: header.ContentType{MediaType: "text/html"}, Expires: t1, ETags: `"abc123"`})
+
+	k2, v2 := parseItem(`k2	200	-	-	-	-	2000-01-01T01:01:01Z`)
+	expect.String(k2).ToBe(t, "k2")
+	expect.Any(v2).ToBe(t, Item{Code: 200, Latest: t1})
+
+	k4, v4 := parseItem(`k4	413	-	video/mp4	-	-	-	123456`)
+	expect.String(k4).ToBe(t, "k4")
+	expect.Any(v4).ToBe(t, Item{Code: 413, Content: header.ContentType{MediaType: "video/mp4"}, Size: 123456})
+
+	k5, v5 := parseItem(`k5	200	-	text/plain	-	-	-	-	text/html`)
+	expect.String(k5).ToBe(t, "k5")
+	expect.Any(v5).ToBe(t, Item{Code: 200, Content: header.ContentType{MediaType: "text/plain"}, Sniffed: header.ContentType{MediaType: "text/html"}})
+
+	k3, _ := parseItem(`k3	200	-	-`)
+	expect.String(k3).ToBe(t, "")
 }
 
 func Test_keyOf(t *testing.T) {
@@ -95,6 +124,48 @@ func TestDB(t *testing.T) {
 	expect.Bool(w3.Expires.IsZero()).ToBeTrue(t)
 }
 
+func TestDB_Loaded(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	empty := OpenDB("/empty", fs)
+	defer empty.Close()
+	expect.Bool(empty.Loaded()).I("no file").ToBeTrue(t)
+
+	// a line longer than the scanner's limit cannot be read
+	expect.Error(afero.WriteFile(fs, "/corrupt/"+FileName, []byte(strings.Repeat("x", 100000)), 0644)).ToBeNil(t)
+	corrupt := OpenDB("/corrupt", fs)
+	defer corrupt.Close()
+	expect.Bool(corrupt.Loaded()).I("corrupt file").ToBeFalse(t)
+
+	empty.Close()
+	expect.Bool(empty.Loaded()).I("closed").ToBeFalse(t)
+}
+
+func TestDB_links(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store1 := OpenDB("/state", fs)
+
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	u1 := mustParse("https://other.org/a")
+
+	store1.Store(u1, Item{Code: 200, ETags: `"h1"`})
+	store1.StoreLink(u1, Item{Code: 301, Location: "https://other.org/b", Expires: t1})
+
+	expect.Any(store1.Lookup(u1)).ToBe(t, Item{Code: 200, ETags: `"h1"`})
+	expect.Any(store1.LookupLink(u1)).ToBe(t, Item{Code: 301, Location: "https://other.org/b", Expires: t1})
+
+	store1.Close()
+
+	store2 := OpenDB("/state", fs)
+	defer store2.Close()
+
+	expect.Any(store2.LookupLink(u1)).ToBe(t, Item{Code: 301, Location: "https://other.org/b", Expires: t1})
+
+	store2.StoreLink(u1, Item{})
+	expect.Any(store2.LookupLink(u1)).ToBe(t, Item{})
+	expect.Any(store2.Lookup(u1)).ToBe(t, Item{Code: 200, ETags: `"h1"`})
+}
+
 func mustParse(s string) *url.URL {
 	u, err := url.Parse(s)
 	if err != nil {
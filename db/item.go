@@ -11,10 +11,22 @@ import (
 // Item is a record in the database.
 type Item struct {
 	Code     int
-	Location string // redirection
-	Content  header.ContentType
+	Location string             // redirection
+	Content  header.ContentType // as declared by the origin server
 	ETags    string
 	Expires  time.Time
+	Latest   time.Time          // most recent entry seen in a feed
+	Size     int64              // content length of a response that was rejected for its size
+	Sniffed  header.ContentType // the type found from the content, if it differs from Content
+}
+
+// Classified gets the content type that the response was processed as, which is the sniffed
+// type, if any, or otherwise the declared type.
+func (i Item) Classified() header.ContentType {
+	if i.Sniffed.MediaType != "" {
+		return i.Sniffed
+	}
+	return i.Content
 }
 
 func (i Item) EmptyContentType() bool {
@@ -22,7 +34,7 @@ func (i Item) EmptyContentType() bool {
 }
 
 func (i Item) Empty() bool {
-	return i.Code == 0 && i.Location == "" && i.EmptyContentType() && i.ETags == "" && i.Expires.IsZero()
+	return i.Code == 0 && i.Location == "" && i.EmptyContentType() && i.ETags == "" && i.Expires.IsZero() && i.Latest.IsZero() && i.Size == 0 && i.Sniffed.MediaType == ""
 }
 
 func dashIfBlank(s string) string {
@@ -43,13 +55,37 @@ func (i Item) Strings() []string {
 		expires = i.Expires.Format(time.RFC3339)
 	}
 
-	return []string{
+	ss := []string{
 		strconv.Itoa(i.Code),
 		dashIfBlank(i.Location),
 		ct,
 		expires,
 		dashIfBlank(i.ETags),
 	}
+
+	// the optional columns are only present for feeds, for responses rejected for their size
+	// and for content that differs from its declared type
+	if !i.Latest.IsZero() || i.Size > 0 || i.Sniffed.MediaType != "" {
+		latest := "-"
+		if !i.Latest.IsZero() {
+			latest = i.Latest.Format(time.RFC3339)
+		}
+		ss = append(ss, latest)
+	}
+
+	if i.Size > 0 || i.Sniffed.MediaType != "" {
+		size := "-"
+		if i.Size > 0 {
+			size = strconv.FormatInt(i.Size, 10)
+		}
+		ss = append(ss, size)
+	}
+
+	if i.Sniffed.MediaType != "" {
+		ss = append(ss, i.Sniffed.String())
+	}
+
+	return ss
 }
 
 func (i Item) String() string {
@@ -59,7 +95,7 @@ func (i Item) String() string {
 func parseItem(line string) (string, Item) {
 	parts := strings.Split(line, "\t")
 
-	if len(parts) != 6 {
+	if len(parts) < 6 || len(parts) > 9 {
 		return "", Item{}
 	}
 
@@ -81,12 +117,30 @@ func parseItem(line string) (string, Item) {
 		expires, _ = time.Parse(time.RFC3339, v4)
 	}
 
+	var latest time.Time
+	if len(parts) >= 7 && parts[6] != "-" {
+		latest, _ = time.Parse(time.RFC3339, parts[6])
+	}
+
+	var size int64
+	if len(parts) >= 8 && parts[7] != "-" {
+		size, _ = strconv.ParseInt(parts[7], 10, 64)
+	}
+
+	var sniffed header.ContentType
+	if len(parts) == 9 {
+		sniffed = header.ParseContentType(parts[8])
+	}
+
 	return key, Item{
 		Code:     v1,
 		Location: strNotDash(v2),
 		Content:  ct,
 		Expires:  expires,
 		ETags:    strNotDash(v5),
+		Latest:   latest,
+		Size:     size,
+		Sniffed:  sniffed,
 	}
 
 }
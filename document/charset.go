@@ -0,0 +1,94 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rickb777/goscrape2/logger"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+const utf8Charset = "utf-8"
+
+// decodeHTML converts an HTML document to UTF-8. The original encoding is determined from a
+// byte order mark, the charset parameter of the content type or a <meta charset> element,
+// in that order. It returns the canonical name of the original encoding.
+//
+// Documents that declare nothing are assumed to be UTF-8 if they are valid UTF-8, or
+// windows-1252 otherwise, as in browsers. A <meta> declaration is also disregarded if the
+// document contains multi-byte UTF-8 and nothing else, because this is a common mistake.
+func decodeHTML(data []byte, contentType string) ([]byte, string, error) {
+	enc, name, certain := charset.DetermineEncoding(data, contentType)
+
+	if name == utf8Charset || (!certain && utf8.Valid(data)) {
+		return data, utf8Charset, nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, name, fmt.Errorf("decoding %s: %w", name, err)
+	}
+
+	// the decoders for UTF-16 keep the byte order mark
+	decoded = bytes.TrimPrefix(decoded, []byte("\uFEFF"))
+
+	logger.Document.Debug("HTML decoded", slog.String("charset", name))
+	return decoded, name, nil
+}
+
+// declareUTF8 alters the <meta> elements that declare the character set so that they agree
+// with the UTF-8 rendering. If there is no such element, one is added to the <head>.
+func declareUTF8(doc *html.Node) {
+	var head *html.Node
+	declared := false
+
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+
+		switch n.DataAtom {
+		case atom.Head:
+			if head == nil {
+				head = n
+			}
+
+		case atom.Meta:
+			for i, attr := range n.Attr {
+				switch {
+				case attr.Key == "charset":
+					n.Attr[i].Val = utf8Charset
+					declared = true
+
+				case attr.Key == "content" && isContentTypeMeta(n):
+					n.Attr[i].Val = "text/html; charset=" + utf8Charset
+					declared = true
+				}
+			}
+		}
+	}
+
+	if !declared && head != nil {
+		meta := &html.Node{
+			Type:     html.ElementNode,
+			DataAtom: atom.Meta,
+			Data:     "meta",
+			Attr:     []html.Attribute{{Key: "charset", Val: utf8Charset}},
+		}
+		head.InsertBefore(meta, head.FirstChild)
+	}
+}
+
+func isContentTypeMeta(node *html.Node) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == "http-equiv" && strings.EqualFold(strings.TrimSpace(attr.Val), "content-type") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package document
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestParseHTMLWithContentType_legacyCharsets(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/content/")
+
+	cases := []struct {
+		enc         encoding.Encoding
+		contentType string
+		input       string
+		charset     string
+		expected    string
+	}{
+		{
+			enc:         japanese.ShiftJIS,
+			contentType: "text/html",
+			input:       `<html><head><meta charset="Shift_JIS"></head><body><a href="https://domain.com/">日本語のページ</a></body></html>`,
+			charset:     "shift_jis",
+			expected:    `<html><head><meta charset="utf-8"/></head><body><a href="../">日本語のページ</a></body></html>`,
+		},
+		{
+			enc:         charmap.Windows1252,
+			contentType: "text/html; charset=windows-1252",
+			input:       `<html><head><title>Café</title></head><body><a href="/menu.html">Crème brûlée – €5</a></body></html>`,
+			charset:     "windows-1252",
+			expected:    `<html><head><meta charset="utf-8"/><title>Café</title></head><body><a href="../menu.html">Crème brûlée – €5</a></body></html>`,
+		},
+		{
+			enc:         charmap.ISO8859_2,
+			contentType: "",
+			input:       `<html><head><meta http-equiv="Content-Type" content="text/html; charset=iso-8859-2"></head><body><p>Zażółć gęślą jaźń</p></body></html>`,
+			charset:     "iso-8859-2",
+			expected:    `<html><head><meta http-equiv="Content-Type" content="text/html; charset=utf-8"/></head><body><p>Zażółć gęślą jaźń</p></body></html>`,
+		},
+		{
+			enc:         charmap.Windows1251,
+			contentType: "text/html; charset=windows-1251",
+			input:       `<html><head><meta charset="windows-1251"></head><body><p>Привет</p></body></html>`,
+			charset:     "windows-1251",
+			expected:    `<html><head><meta charset="utf-8"/></head><body><p>Привет</p></body></html>`,
+		},
+		{
+			enc:         unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+			contentType: "text/html",
+			input:       `<html><head></head><body><p>Grüße</p></body></html>`,
+			charset:     "utf-16le",
+			expected:    `<html><head><meta charset="utf-8"/></head><body><p>Grüße</p></body></html>`,
+		},
+	}
+
+	for i, c := range cases {
+		encoded, err := c.enc.NewEncoder().Bytes([]byte(c.input))
+		expect.Error(err).Info(i).ToBeNil(t)
+
+		doc, err := ParseHTMLWithContentType(u, u, bytes.NewReader(encoded), c.contentType)
+		expect.Error(err).Info(i).ToBeNil(t)
+		expect.String(doc.Charset()).Info(i).ToBe(t, c.charset)
+
+		rendered, fixed, err := doc.FixURLReferences()
+		expect.Error(err).Info(i).ToBeNil(t)
+		expect.Bool(fixed).Info(i).ToBeTrue(t)
+		expect.String(string(rendered)).Info(i).ToBe(t, c.expected)
+	}
+}
+
+func TestParseHTML_utf8(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/content/")
+
+	cases := []string{
+		`<html><head></head><body><p>Grüße</p></body></html>`,
+		`<html><head><meta charset="iso-8859-1"></head><body><p>日本語</p></body></html>`,
+	}
+
+	for i, c := range cases {
+		doc, err := ParseHTML(u, u, bytes.NewReader([]byte(c)))
+		expect.Error(err).Info(i).ToBeNil(t)
+		expect.String(doc.Charset()).Info(i).ToBe(t, "utf-8")
+
+		_, fixed, err := doc.FixURLReferences()
+		expect.Error(err).Info(i).ToBeNil(t)
+		expect.Bool(fixed).Info(i).ToBeFalse(t)
+	}
+}
@@ -43,7 +43,7 @@ func CheckCSSForUrls(cssURL *url.URL, startURLHost string, data []byte) ([]byte,
 
 		resolved, err := cssURL.Parse(src)
 		if err != nil {
-			logger.Logger.Error("Parsing URL failed",
+			logger.Document.Error("Parsing URL failed",
 				slog.String("url", src),
 				slog.Any("error", err))
 			continue
@@ -65,7 +65,7 @@ func CheckCSSForUrls(cssURL *url.URL, startURLHost string, data []byte) ([]byte,
 	for original, filePath := range urls {
 		fixed := fmt.Sprintf("url(%s)", filePath)
 		css = strings.ReplaceAll(css, original, fixed)
-		logger.Debug("CSS element relinked", slog.String("url", original), slog.String("fixed", fixed))
+		logger.Document.Debug("CSS element relinked", slog.String("url", original), slog.String("fixed", fixed))
 	}
 
 	return []byte(css), refs
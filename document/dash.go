@@ -0,0 +1,403 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// maxDASHSegments limits the expansion of each segment template, guarding against
+// malformed manifests.
+const maxDASHSegments = 100000
+
+// DASHDocument is an MPEG-DASH media presentation description (.mpd).
+type DASHDocument struct {
+	doc      *etree.Document
+	u        *url.URL
+	startURL *url.URL
+	duration time.Duration
+	refs     work.Refs
+}
+
+// ParseDASH parses a DASH manifest. All the references it contains are gathered
+// at this point, before any of them get altered by FixURLReferences.
+func ParseDASH(u, startURL *url.URL, rdr io.Reader) (*DASHDocument, error) {
+	doc := etree.NewDocument()
+	_, err := doc.ReadFrom(rdr)
+	if err != nil {
+		return nil, err
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "MPD" {
+		return nil, fmt.Errorf("%s: not a DASH manifest", u)
+	}
+
+	d := &DASHDocument{doc: doc, u: u, startURL: startURL}
+	d.duration, _ = parseISODuration(root.SelectAttrValue("mediaPresentationDuration", ""))
+	d.refs = d.findReferences(root)
+	return d, nil
+}
+
+// FindReferences returns the URLs of the initialisation and media segments, expanding
+// segment templates where the number of segments can be determined.
+func (d *DASHDocument) FindReferences() (work.Refs, error) {
+	return d.refs, nil
+}
+
+func (d *DASHDocument) findReferences(root *etree.Element) work.Refs {
+	var result work.Refs
+	seen := make(map[string]struct{})
+
+	addURL := func(u *url.URL) {
+		v := *u
+		v.Fragment = ""
+		if _, exists := seen[v.String()]; !exists {
+			seen[v.String()] = struct{}{}
+			result = append(result, &v)
+		}
+	}
+
+	add := func(base *url.URL, ref string) {
+		if ref == "" || hasIgnoredPrefix(ref) {
+			return
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			logger.Document.Error("Parsing URL failed",
+				slog.String("url", ref),
+				slog.Any("error", err))
+			return
+		}
+		addURL(base.ResolveReference(u))
+	}
+
+	dynamic := root.SelectAttrValue("type", "static") == "dynamic"
+	mpdBase := baseURLOf(d.u, root)
+
+	for _, period := range root.SelectElements("Period") {
+		periodBase := baseURLOf(mpdBase, period)
+		periodDuration := d.duration
+		if pd, ok := parseISODuration(period.SelectAttrValue("duration", "")); ok {
+			periodDuration = pd
+		}
+
+		for _, adaptation := range period.SelectElements("AdaptationSet") {
+			adaptationBase := baseURLOf(periodBase, adaptation)
+
+			for _, rep := range adaptation.SelectElements("Representation") {
+				repBase := baseURLOf(adaptationBase, rep)
+				vars := map[string]string{
+					"RepresentationID": rep.SelectAttrValue("id", ""),
+					"Bandwidth":        rep.SelectAttrValue("bandwidth", ""),
+				}
+
+				template := mergedSegmentTemplate(period, adaptation, rep)
+				list := firstChild("SegmentList", rep, adaptation, period)
+				segBase := firstChild("SegmentBase", rep, adaptation, period)
+
+				switch {
+				case template != nil:
+					add(repBase, expandTemplate(template.SelectAttrValue("initialization", ""), vars))
+					if dynamic {
+						logger.Document.Debug("DASH live segments not expanded", slog.String("url", d.u.String()))
+						break
+					}
+					for _, media := range segmentTemplateURLs(template, vars, periodDuration) {
+						add(repBase, media)
+					}
+
+				case list != nil:
+					if init := list.SelectElement("Initialization"); init != nil {
+						add(repBase, init.SelectAttrValue("sourceURL", ""))
+					}
+					for _, seg := range list.SelectElements("SegmentURL") {
+						add(repBase, seg.SelectAttrValue("media", ""))
+					}
+
+				default:
+					if segBase != nil {
+						if init := segBase.SelectElement("Initialization"); init != nil {
+							add(repBase, init.SelectAttrValue("sourceURL", ""))
+						}
+						if index := segBase.SelectElement("RepresentationIndex"); index != nil {
+							add(repBase, index.SelectAttrValue("sourceURL", ""))
+						}
+					}
+					if rep.SelectElement("BaseURL") != nil {
+						addURL(repBase) // single-segment representation
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// FixURLReferences fixes URL references to point to relative file names.
+// It returns a bool that indicates that no reference needed to be fixed,
+// in this case the returned manifest string will be empty.
+func (d *DASHDocument) FixURLReferences() ([]byte, bool, error) {
+	changed := d.fixElement(d.doc.Root(), d.u)
+
+	if !changed {
+		return nil, false, nil
+	}
+
+	var rendered bytes.Buffer
+	_, err := d.doc.WriteTo(&rendered)
+	if err != nil {
+		return nil, false, fmt.Errorf("rendering DASH: %w", err)
+	}
+
+	return rendered.Bytes(), true, nil
+}
+
+// dashURLAttributes lists the elements and their attributes that contain URLs or URL templates.
+var dashURLAttributes = map[string][]string{
+	"SegmentTemplate":     {"media", "initialization", "index"},
+	"SegmentURL":          {"media", "index"},
+	"Initialization":      {"sourceURL"},
+	"RepresentationIndex": {"sourceURL"},
+}
+
+// fixElement rewrites the URLs in node and its descendants. Each URL is made relative to the base
+// that applies to it, which is the enclosing BaseURL or the manifest itself, so that the chain of
+// nested BaseURLs still resolves correctly in the local copy.
+func (d *DASHDocument) fixElement(node *etree.Element, base *url.URL) (changed bool) {
+	if b := node.SelectElement("BaseURL"); b != nil {
+		parent := base
+		base = baseURLOf(parent, node) // the original, before it is rewritten
+
+		value := strings.TrimSpace(b.Text())
+		if fixed := d.fixURL(parent, value); fixed != value {
+			b.SetText(fixed)
+			changed = true
+		}
+	}
+
+	for i, a := range node.Attr {
+		if names, ok := dashURLAttributes[node.Tag]; ok && a.Space == "" && slices.Contains(names, a.Key) {
+			if fixed := d.fixURL(base, a.Value); fixed != a.Value {
+				node.Attr[i].Value = fixed
+				changed = true
+			}
+		}
+	}
+
+	for _, c := range node.ChildElements() {
+		if c.Tag != "BaseURL" && d.fixElement(c, base) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// fixURL makes absolute and root-relative URLs relative to base. Relative URLs are
+// left unchanged because they already resolve correctly in the local copy.
+func (d *DASHDocument) fixURL(base *url.URL, value string) string {
+	if value == "" || hasIgnoredPrefix(value) {
+		return value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Host == "" && !strings.HasPrefix(u.Path, "/")) {
+		return value
+	}
+
+	if base.Host != d.startURL.Host {
+		return value // the base is not mirrored, so the value must be left unchanged
+	}
+
+	fixed := resolveURL(base, value, d.startURL.Host, "")
+	if fixed == "" {
+		fixed = "./"
+	} else if strings.HasSuffix(u.Path, "/") && !strings.HasSuffix(fixed, "/") {
+		fixed += "/" // BaseURL directories must keep their trailing slash
+	}
+
+	if fixed != value {
+		logger.Document.Debug("DASH URL relinked", slog.String("url", value), slog.String("fixed", fixed))
+	}
+	return fixed
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// baseURLOf resolves the first BaseURL child of node, if any, against the parent base.
+func baseURLOf(parent *url.URL, node *etree.Element) *url.URL {
+	b := node.SelectElement("BaseURL")
+	if b == nil {
+		return parent
+	}
+
+	u, err := url.Parse(strings.TrimSpace(b.Text()))
+	if err != nil {
+		return parent
+	}
+	return parent.ResolveReference(u)
+}
+
+// firstChild finds the named child element of the first node that has one.
+func firstChild(tag string, nodes ...*etree.Element) *etree.Element {
+	for _, n := range nodes {
+		if c := n.SelectElement(tag); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// mergedSegmentTemplate combines the segment templates at the period, adaptation set and
+// representation levels, with lower levels overriding higher ones.
+func mergedSegmentTemplate(levels ...*etree.Element) *etree.Element {
+	var merged *etree.Element
+	for _, level := range levels {
+		t := level.SelectElement("SegmentTemplate")
+		if t == nil {
+			continue
+		}
+		if merged == nil {
+			merged = t.Copy()
+			continue
+		}
+		for _, a := range t.Attr {
+			merged.CreateAttr(a.FullKey(), a.Value)
+		}
+		if timeline := t.SelectElement("SegmentTimeline"); timeline != nil {
+			if old := merged.SelectElement("SegmentTimeline"); old != nil {
+				merged.RemoveChild(old)
+			}
+			merged.AddChild(timeline.Copy())
+		}
+	}
+	return merged
+}
+
+// segmentTemplateURLs lists the media segment URLs of a segment template, using its
+// timeline if present, otherwise using the segment duration.
+func segmentTemplateURLs(template *etree.Element, vars map[string]string, periodDuration time.Duration) []string {
+	media := template.SelectAttrValue("media", "")
+	if media == "" {
+		return nil
+	}
+
+	number := attrInt(template, "startNumber", 1)
+	timescale := attrInt(template, "timescale", 1)
+	if timescale <= 0 {
+		timescale = 1
+	}
+
+	var urls []string
+	emit := func(t int64) bool {
+		vars["Number"] = strconv.FormatInt(number, 10)
+		vars["Time"] = strconv.FormatInt(t, 10)
+		urls = append(urls, expandTemplate(media, vars))
+		number++
+		return len(urls) < maxDASHSegments
+	}
+
+	if timeline := template.SelectElement("SegmentTimeline"); timeline != nil {
+		periodEnd := int64(periodDuration.Seconds() * float64(timescale))
+		var t int64
+		for _, s := range timeline.SelectElements("S") {
+			t = attrInt(s, "t", t)
+			d := attrInt(s, "d", 0)
+			r := attrInt(s, "r", 0)
+			if d <= 0 {
+				continue
+			}
+			if r < 0 {
+				r = 0
+				if periodEnd > t {
+					r = (periodEnd-t+d-1)/d - 1 // repeat until the end of the period
+				}
+			}
+			for i := int64(0); i <= r; i++ {
+				if !emit(t) {
+					return urls
+				}
+				t += d
+			}
+		}
+		return urls
+	}
+
+	duration := attrInt(template, "duration", 0)
+	if duration <= 0 || periodDuration <= 0 {
+		return nil
+	}
+
+	count := int64(math.Ceil(periodDuration.Seconds() * float64(timescale) / float64(duration)))
+	for i := int64(0); i < count; i++ {
+		if !emit(i * duration) {
+			break
+		}
+	}
+	return urls
+}
+
+func attrInt(node *etree.Element, key string, dflt int64) int64 {
+	v := node.SelectAttrValue(key, "")
+	if v == "" {
+		return dflt
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return dflt
+	}
+	return i
+}
+
+var dashTemplateRe = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0(\d+)d)?\$|\$\$`)
+
+// expandTemplate substitutes the identifiers in a DASH URL template.
+func expandTemplate(template string, vars map[string]string) string {
+	return dashTemplateRe.ReplaceAllStringFunc(template, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+
+		sub := dashTemplateRe.FindStringSubmatch(m)
+		value := vars[sub[1]]
+		if width, err := strconv.Atoi(sub[3]); err == nil && len(value) < width {
+			value = strings.Repeat("0", width-len(value)) + value
+		}
+		return value
+	})
+}
+
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)Y)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses durations such as "PT1H2M3.5S" as used in DASH manifests.
+// Years and months are approximated as 365 and 30 days.
+func parseISODuration(s string) (time.Duration, bool) {
+	m := isoDurationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, false
+	}
+
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total float64
+	for i, unit := range units {
+		if m[i+1] != "" {
+			v, _ := strconv.ParseFloat(m[i+1], 64)
+			total += v * float64(unit)
+		}
+	}
+	return time.Duration(total), true
+}
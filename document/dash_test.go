@@ -0,0 +1,134 @@
+package document
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestDASH_segmentTemplate(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT10S">
+  <BaseURL>https://example.org/media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate timescale="1000" duration="4000" startNumber="1" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s"/>
+      <Representation id="v1" bandwidth="500000"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4">
+      <SegmentTemplate timescale="10" initialization="/media/a/init.mp4" media="/media/a/$Time$.m4s">
+        <SegmentTimeline>
+          <S t="0" d="40" r="1"/>
+          <S d="20"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="a1" bandwidth="64000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	u := mustParseURL("https://example.org/video/manifest.mpd")
+
+	doc, err := ParseDASH(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 8)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/media/v1/init.mp4"),
+		mustParseURL("https://example.org/media/v1/seg-001.m4s"),
+		mustParseURL("https://example.org/media/v1/seg-002.m4s"),
+		mustParseURL("https://example.org/media/v1/seg-003.m4s"),
+		mustParseURL("https://example.org/media/a/init.mp4"),
+		mustParseURL("https://example.org/media/a/0.m4s"),
+		mustParseURL("https://example.org/media/a/40.m4s"),
+		mustParseURL("https://example.org/media/a/80.m4s"))
+
+	fixed, changed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(changed).ToBeTrue(t)
+	expect.String(string(fixed)).ToContain(t, `<BaseURL>../media/</BaseURL>`)
+	expect.String(string(fixed)).ToContain(t, `initialization="$RepresentationID$/init.mp4"`)
+	expect.String(string(fixed)).ToContain(t, `initialization="a/init.mp4" media="a/$Time$.m4s"`)
+}
+
+func TestDASH_segmentList(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<MPD type="static">
+  <Period duration="PT1M">
+    <AdaptationSet>
+      <Representation id="1">
+        <BaseURL>video/</BaseURL>
+        <SegmentList>
+          <Initialization sourceURL="init.mp4"/>
+          <SegmentURL media="s1.m4s"/>
+          <SegmentURL media="https://example.org/dash/video/s2.m4s"/>
+        </SegmentList>
+      </Representation>
+      <Representation id="2">
+        <BaseURL>https://example.org/files/whole.mp4</BaseURL>
+        <SegmentBase><Initialization sourceURL="whole-init.mp4"/></SegmentBase>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	u := mustParseURL("https://example.org/dash/manifest.mpd")
+
+	doc, err := ParseDASH(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 5)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/dash/video/init.mp4"),
+		mustParseURL("https://example.org/dash/video/s1.m4s"),
+		mustParseURL("https://example.org/dash/video/s2.m4s"),
+		mustParseURL("https://example.org/files/whole-init.mp4"),
+		mustParseURL("https://example.org/files/whole.mp4"))
+
+	fixed, changed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(changed).ToBeTrue(t)
+	expect.String(string(fixed)).ToContain(t, `<BaseURL>video/</BaseURL>`)
+	expect.String(string(fixed)).ToContain(t, `<SegmentURL media="s2.m4s"/>`)
+	expect.String(string(fixed)).ToContain(t, `<BaseURL>../files/whole.mp4</BaseURL>`)
+}
+
+func TestDASH_notManifest(t *testing.T) {
+	u := mustParseURL("https://example.org/dash/manifest.mpd")
+
+	_, err := ParseDASH(u, u, strings.NewReader(`<svg/>`))
+	expect.Error(err).Not().ToBeNil(t)
+}
+
+func Test_parseISODuration(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected time.Duration
+		ok       bool
+	}{
+		{input: "PT10S", expected: 10 * time.Second, ok: true},
+		{input: "PT1H2M3.5S", expected: time.Hour + 2*time.Minute + 3500*time.Millisecond, ok: true},
+		{input: "P1DT1S", expected: 24*time.Hour + time.Second, ok: true},
+		{input: "PT", ok: false},
+		{input: "", ok: false},
+		{input: "10S", ok: false},
+	}
+
+	for i, c := range cases {
+		d, ok := parseISODuration(c.input)
+		expect.Bool(ok).I(i).ToBe(t, c.ok)
+		expect.Number(d).I(i).ToBe(t, c.expected)
+	}
+}
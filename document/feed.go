@@ -0,0 +1,307 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// FeedDocument is an RSS or Atom feed.
+type FeedDocument struct {
+	doc      *etree.Document
+	u        *url.URL
+	startURL *url.URL
+	links    []feedLink // feed-level self and alternate links
+	entries  []feedEntry
+}
+
+type feedEntry struct {
+	updated time.Time // zero if the entry is undated
+	links   []feedLink
+}
+
+// feedLink is a URL held either in an attribute or in the text of an element.
+type feedLink struct {
+	element *etree.Element
+	attr    string // blank for element text
+	ref     *url.URL
+}
+
+// ParseFeed parses an RSS 2.0 or Atom feed. All the references it contains are gathered
+// at this point, before any of them get altered by FixURLReferences.
+func ParseFeed(u, startURL *url.URL, rdr io.Reader) (*FeedDocument, error) {
+	doc := etree.NewDocument()
+	_, err := doc.ReadFrom(rdr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &FeedDocument{doc: doc, u: u, startURL: startURL}
+
+	root := doc.Root()
+	switch {
+	case root != nil && root.Tag == "rss":
+		d.parseRSS(root)
+	case root != nil && root.Tag == "feed":
+		d.parseAtom(root)
+	default:
+		return nil, fmt.Errorf("%s: not an RSS or Atom feed", u)
+	}
+
+	return d, nil
+}
+
+func (d *FeedDocument) parseRSS(root *etree.Element) {
+	channel := root.SelectElement("channel")
+	if channel == nil {
+		return
+	}
+
+	d.links = append(d.links, d.textLink(rssLink(channel))...)
+	d.links = append(d.links, d.atomLinks(channel, "self", "alternate")...)
+
+	for _, item := range channel.SelectElements("item") {
+		var entry feedEntry
+		entry.updated = parseFeedDate(childText(item, "pubDate"))
+		entry.links = append(entry.links, d.textLink(rssLink(item))...)
+		for _, enclosure := range item.SelectElements("enclosure") {
+			entry.links = append(entry.links, d.attrLink(enclosure, "url")...)
+		}
+		d.entries = append(d.entries, entry)
+	}
+}
+
+func (d *FeedDocument) parseAtom(root *etree.Element) {
+	d.links = append(d.links, d.atomLinks(root, "self", "alternate")...)
+
+	for _, item := range root.SelectElements("entry") {
+		var entry feedEntry
+		entry.updated = parseFeedDate(childText(item, "updated"))
+		if entry.updated.IsZero() {
+			entry.updated = parseFeedDate(childText(item, "published"))
+		}
+		entry.links = d.atomLinks(item, "alternate", "enclosure")
+		d.entries = append(d.entries, entry)
+	}
+}
+
+// atomLinks gets the link elements that have one of the wanted relations. In RSS feeds,
+// these are in the Atom namespace; in Atom feeds, a missing rel means "alternate".
+func (d *FeedDocument) atomLinks(parent *etree.Element, rels ...string) []feedLink {
+	var links []feedLink
+	for _, link := range parent.ChildElements() {
+		if link.Tag != "link" || link.SelectAttr("href") == nil {
+			continue
+		}
+		rel := link.SelectAttrValue("rel", "alternate")
+		for _, wanted := range rels {
+			if rel == wanted {
+				links = append(links, d.attrLink(link, "href")...)
+			}
+		}
+	}
+	return links
+}
+
+func (d *FeedDocument) attrLink(node *etree.Element, attr string) []feedLink {
+	if node == nil {
+		return nil
+	}
+	if ref := d.resolve(node.SelectAttrValue(attr, "")); ref != nil {
+		return []feedLink{{element: node, attr: attr, ref: ref}}
+	}
+	return nil
+}
+
+func (d *FeedDocument) textLink(node *etree.Element) []feedLink {
+	if node == nil {
+		return nil
+	}
+	if ref := d.resolve(node.Text()); ref != nil {
+		return []feedLink{{element: node, ref: ref}}
+	}
+	return nil
+}
+
+func (d *FeedDocument) resolve(value string) *url.URL {
+	value = strings.TrimSpace(value)
+	if value == "" || hasIgnoredPrefix(value) {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		logger.Document.Error("Parsing URL failed",
+			slog.String("url", value),
+			slog.Any("error", err))
+		return nil
+	}
+
+	resolved := d.u.ResolveReference(u)
+	resolved.Fragment = ""
+	return resolved
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// FindReferences returns the URLs of the feed's self and alternate links, and the links and
+// enclosures of all its entries.
+func (d *FeedDocument) FindReferences() (work.Refs, error) {
+	result := refsOf(d.links)
+	for _, entry := range d.entries {
+		result = append(result, refsOf(entry.links)...)
+	}
+	return result, nil
+}
+
+// ReferencesSince returns the URLs of the links and enclosures of entries updated after a
+// given time. If the time is zero, this is the same as FindReferences. Otherwise, undated
+// entries and the feed's own links are omitted.
+func (d *FeedDocument) ReferencesSince(since time.Time) work.Refs {
+	if since.IsZero() {
+		result, _ := d.FindReferences()
+		return result
+	}
+
+	var result work.Refs
+	for _, entry := range d.entries {
+		if entry.updated.After(since) {
+			result = append(result, refsOf(entry.links)...)
+		}
+	}
+	return result
+}
+
+// Latest returns the time of the most recently updated entry, or zero if there are none.
+func (d *FeedDocument) Latest() time.Time {
+	var latest time.Time
+	for _, entry := range d.entries {
+		if entry.updated.After(latest) {
+			latest = entry.updated
+		}
+	}
+	return latest
+}
+
+func refsOf(links []feedLink) work.Refs {
+	result := make(work.Refs, 0, len(links))
+	for _, link := range links {
+		result = append(result, link.ref)
+	}
+	return result
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// FixURLReferences fixes URL references to point to relative file names.
+// It returns a bool that indicates that no reference needed to be fixed,
+// in this case the returned feed string will be empty.
+func (d *FeedDocument) FixURLReferences() ([]byte, bool, error) {
+	relativeToRoot := urlRelativeToRoot(d.u)
+
+	var changed bool
+	fix := func(link feedLink) {
+		var value string
+		if link.attr == "" {
+			value = strings.TrimSpace(link.element.Text())
+		} else {
+			value = strings.TrimSpace(link.element.SelectAttrValue(link.attr, ""))
+		}
+
+		adjusted := nonBlankURL(resolveURL(d.u, value, d.startURL.Host, relativeToRoot), link.ref)
+
+		if adjusted == value {
+			return // no change
+		}
+
+		if link.attr == "" {
+			link.element.SetText(adjusted)
+		} else {
+			link.element.CreateAttr(link.attr, adjusted)
+		}
+		changed = true
+
+		logger.Document.Debug("Feed link relinked",
+			slog.String("value", value),
+			slog.String("fixed_value", adjusted))
+	}
+
+	for _, link := range d.links {
+		fix(link)
+	}
+	for _, entry := range d.entries {
+		for _, link := range entry.links {
+			fix(link)
+		}
+	}
+
+	if !changed {
+		return nil, false, nil
+	}
+
+	var rendered bytes.Buffer
+	_, err := d.doc.WriteTo(&rendered)
+	if err != nil {
+		return nil, false, fmt.Errorf("rendering feed: %w", err)
+	}
+
+	return rendered.Bytes(), true, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// rssLink finds the plain RSS link element, which may be accompanied by atom:link elements.
+func rssLink(parent *etree.Element) *etree.Element {
+	for _, c := range parent.ChildElements() {
+		if c.Tag == "link" && c.Space == "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func childText(parent *etree.Element, tag string) string {
+	if c := parent.SelectElement(tag); c != nil {
+		return strings.TrimSpace(c.Text())
+	}
+	return ""
+}
+
+// feedDateLayouts lists the date formats found in RSS (RFC-822 and variants) and Atom (RFC-3339).
+var feedDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+}
+
+// parseFeedDate parses a date, returning zero if it is blank or cannot be parsed.
+func parseFeedDate(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+
+	logger.Document.Debug("Unparseable feed date", slog.String("date", s))
+	return time.Time{}
+}
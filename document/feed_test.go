@@ -0,0 +1,121 @@
+package document
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestFeed_RSS(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Blog</title>
+  <atom:link href="https://example.org/blog/feed.rss" rel="self" type="application/rss+xml"/>
+  <link>https://example.org/blog/</link>
+  <item>
+    <title>Newer</title>
+    <link>https://example.org/blog/2024/newer.html</link>
+    <pubDate>Tue, 2 Jan 2024 10:00:00 GMT</pubDate>
+    <enclosure url="https://example.org/media/newer.mp3" length="1" type="audio/mpeg"/>
+  </item>
+  <item>
+    <title>Older</title>
+    <link>https://example.org/blog/2023/older.html</link>
+    <pubDate>Sun, 31 Dec 2023 10:00:00 +0000</pubDate>
+  </item>
+</channel>
+</rss>`
+
+	u := mustParseURL("https://example.org/blog/feed.rss")
+
+	doc, err := ParseFeed(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 5)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/blog/feed.rss"),
+		mustParseURL("https://example.org/blog/"),
+		mustParseURL("https://example.org/blog/2024/newer.html"),
+		mustParseURL("https://example.org/media/newer.mp3"),
+		mustParseURL("https://example.org/blog/2023/older.html"))
+
+	expect.Any(doc.Latest()).ToBe(t, time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+
+	since := doc.ReferencesSince(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	expect.Slice(since).ToHaveLength(t, 2)
+	expect.Slice(since).ToContainAll(t,
+		mustParseURL("https://example.org/blog/2024/newer.html"),
+		mustParseURL("https://example.org/media/newer.mp3"))
+
+	fixed, changed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(changed).ToBeTrue(t)
+	expect.String(string(fixed)).ToContain(t, `<atom:link href="feed.rss" rel="self" type="application/rss+xml"/>`)
+	expect.String(string(fixed)).ToContain(t, `<link>2024/newer.html</link>`)
+	expect.String(string(fixed)).ToContain(t, `<enclosure url="../media/newer.mp3" length="1" type="audio/mpeg"/>`)
+}
+
+func TestFeed_Atom(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>News</title>
+  <link href="/news/atom.xml" rel="self"/>
+  <link href="/news/"/>
+  <link href="https://example.org/hub" rel="hub"/>
+  <entry>
+    <title>One</title>
+    <link href="/news/one.html"/>
+    <link rel="enclosure" href="/news/one.pdf"/>
+    <link rel="edit" href="/api/one"/>
+    <updated>2024-05-01T12:00:00Z</updated>
+  </entry>
+  <entry>
+    <title>Two</title>
+    <link rel="alternate" href="two.html"/>
+    <published>2024-04-01T12:00:00+02:00</published>
+  </entry>
+</feed>`
+
+	u := mustParseURL("https://example.org/news/atom.xml")
+
+	doc, err := ParseFeed(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 5)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/news/atom.xml"),
+		mustParseURL("https://example.org/news/"),
+		mustParseURL("https://example.org/news/one.html"),
+		mustParseURL("https://example.org/news/one.pdf"),
+		mustParseURL("https://example.org/news/two.html"))
+
+	expect.Any(doc.Latest()).ToBe(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	expect.Slice(doc.ReferencesSince(doc.Latest())).ToBeEmpty(t)
+
+	fixed, changed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(changed).ToBeTrue(t)
+	expect.String(string(fixed)).ToContain(t, `<link href="one.html"/>`)
+	expect.String(string(fixed)).ToContain(t, `<link href="https://example.org/hub" rel="hub"/>`)
+}
+
+func TestFeed_notAFeed(t *testing.T) {
+	u := mustParseURL("https://example.org/news/atom.xml")
+
+	_, err := ParseFeed(u, u, strings.NewReader(`<html/>`))
+	expect.Error(err).Not().ToBeNil(t)
+}
@@ -0,0 +1,94 @@
+package document
+
+import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// hlsURIAttrRe matches the URI attribute used by tags such as EXT-X-KEY, EXT-X-MAP,
+// EXT-X-MEDIA and EXT-X-I-FRAME-STREAM-INF.
+var hlsURIAttrRe = regexp.MustCompile(`URI="([^"]*)"`)
+
+// CheckHLSForUrls finds the variant playlists, media segments, keys and initialisation
+// sections referenced by an HLS (.m3u8) playlist. Every URI is resolved relative to the
+// playlist and rewritten to the relative path of the local copy.
+func CheckHLSForUrls(playlistURL *url.URL, startURLHost string, data []byte) ([]byte, work.Refs) {
+	var refs work.Refs
+	var changed bool
+
+	lines := strings.Split(string(data), "\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+
+		switch {
+		case trimmed == "":
+			// blank line
+
+		case strings.HasPrefix(trimmed, "#EXT"):
+			for _, m := range hlsURIAttrRe.FindAllStringSubmatchIndex(line, -1) {
+				uri := line[m[2]:m[3]]
+				ref, fixed := resolveHLSURI(playlistURL, startURLHost, uri)
+				if ref != nil {
+					refs = append(refs, ref)
+				}
+				if fixed != uri {
+					lines[i] = strings.Replace(lines[i], `URI="`+uri+`"`, `URI="`+fixed+`"`, 1)
+					changed = true
+				}
+			}
+
+		case strings.HasPrefix(trimmed, "#"):
+			// comment
+
+		default:
+			ref, fixed := resolveHLSURI(playlistURL, startURLHost, trimmed)
+			if ref != nil {
+				refs = append(refs, ref)
+			}
+			if fixed != trimmed {
+				lines[i] = strings.Replace(line, trimmed, fixed, 1)
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return data, refs // nothing more needs doing
+	}
+
+	return []byte(strings.Join(lines, "\n")), refs
+}
+
+func resolveHLSURI(playlistURL *url.URL, startURLHost, uri string) (*url.URL, string) {
+	if uri == "" || hasIgnoredPrefix(uri) {
+		return nil, uri
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		logger.Document.Error("Parsing URL failed",
+			slog.String("url", uri),
+			slog.Any("error", err))
+		return nil, uri
+	}
+
+	if u.Scheme == "skd" {
+		return nil, uri // FairPlay key identifiers are not fetchable
+	}
+
+	resolved := playlistURL.ResolveReference(u)
+	resolved.Fragment = ""
+
+	fixed := resolveURL(playlistURL, uri, startURLHost, "")
+	if fixed != uri {
+		logger.Document.Debug("HLS URI relinked", slog.String("url", uri), slog.String("fixed", fixed))
+	}
+
+	return resolved, fixed
+}
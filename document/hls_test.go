@@ -0,0 +1,73 @@
+package document
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestCheckHLSForURLs_master(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="en",URI="https://example.org/video/audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aud"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO="aud"
+/video/high/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,URI="iframe.m3u8"
+`
+
+	u := mustParseURL("https://example.org/video/master.m3u8")
+
+	fixed, refs := CheckHLSForUrls(u, "example.org", []byte(sample))
+
+	expect.Slice(refs).ToHaveLength(t, 4)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/video/audio/en.m3u8"),
+		mustParseURL("https://example.org/video/low/index.m3u8"),
+		mustParseURL("https://example.org/video/high/index.m3u8"),
+		mustParseURL("https://example.org/video/iframe.m3u8"))
+
+	expected := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="en",URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aud"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO="aud"
+high/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,URI="iframe.m3u8"
+`
+	expect.String(string(fixed)).ToBe(t, expected)
+}
+
+func TestCheckHLSForURLs_media(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := "#EXTM3U\r\n" +
+		"#EXT-X-TARGETDURATION:10\r\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/k1.bin\",IV=0x1\r\n" +
+		"#EXT-X-MAP:URI=\"init.mp4\"\r\n" +
+		"#EXTINF:9.9,\r\n" +
+		"seg1.m4s\r\n" +
+		"#EXTINF:9.9,\r\n" +
+		"https://cdn.other.net/seg2.m4s\r\n" +
+		"#EXT-X-ENDLIST\r\n"
+
+	u := mustParseURL("https://example.org/video/low/index.m3u8")
+
+	fixed, refs := CheckHLSForUrls(u, "example.org", []byte(sample))
+
+	expect.Slice(refs).ToHaveLength(t, 4)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/keys/k1.bin"),
+		mustParseURL("https://example.org/video/low/init.mp4"),
+		mustParseURL("https://example.org/video/low/seg1.m4s"),
+		mustParseURL("https://cdn.other.net/seg2.m4s"))
+
+	expect.String(string(fixed)).ToContain(t, "#EXT-X-KEY:METHOD=AES-128,URI=\"../../keys/k1.bin\",IV=0x1\r\n")
+	expect.String(string(fixed)).ToContain(t, "\r\nseg1.m4s\r\n")
+	expect.String(string(fixed)).ToContain(t, "\r\nhttps://cdn.other.net/seg2.m4s\r\n")
+}
@@ -9,9 +9,11 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/htmlindex"
 	"github.com/rickb777/goscrape2/logger"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // ignoredURLPrefixes contains a list of URL prefixes that do not need to bo adjusted.
@@ -27,18 +29,53 @@ type HTMLDocument struct {
 	startURL *url.URL
 	doc      *html.Node
 	index    *htmlindex.Index
+	scripts  config.ScriptMode
+	charset  string // the original character encoding
 }
 
+// ParseHTML parses an HTML document. Its character encoding is determined from a byte order
+// mark or a <meta charset> element; UTF-8 is assumed otherwise.
 func ParseHTML(u, startURL *url.URL, rdr io.Reader) (*HTMLDocument, error) {
-	doc, err := html.Parse(rdr)
+	return ParseHTMLWithContentType(u, startURL, rdr, "")
+}
+
+// ParseHTMLWithContentType parses an HTML document, also using the charset parameter of its
+// content type. Documents in legacy encodings are converted to UTF-8 and will be rendered as
+// UTF-8 by FixURLReferences, with their <meta charset> altered to match.
+func ParseHTMLWithContentType(u, startURL *url.URL, rdr io.Reader, contentType string) (*HTMLDocument, error) {
+	data, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	data, name, err := decodeHTML(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("parsing: %w", err)
 	}
 
+	if name != utf8Charset {
+		declareUTF8(doc)
+	}
+
 	index := htmlindex.New()
 	index.Index(u, doc)
 
-	return &HTMLDocument{u: u, startURL: startURL, doc: doc, index: index}, nil
+	return &HTMLDocument{u: u, startURL: startURL, doc: doc, index: index, charset: name}, nil
+}
+
+// Charset returns the canonical name of the original character encoding of the document.
+func (d *HTMLDocument) Charset() string {
+	return d.charset
+}
+
+// ScanScripts enables heuristic URL discovery in inline scripts. The default is config.ScriptsIgnored.
+func (d *HTMLDocument) ScanScripts(mode config.ScriptMode) {
+	d.scripts = mode
 }
 
 // FixURLReferences fixes URL references to point to relative file names.
@@ -47,7 +84,21 @@ func ParseHTML(u, startURL *url.URL, rdr io.Reader) (*HTMLDocument, error) {
 func (d *HTMLDocument) FixURLReferences() ([]byte, bool, error) {
 	relativeToRoot := urlRelativeToRoot(d.u)
 
-	if changed := fixHTMLNodeURLs(d.u, d.startURL.Host, relativeToRoot, d.index); !changed {
+	changed := fixHTMLNodeURLs(d.u, d.startURL.Host, relativeToRoot, d.index)
+
+	if d.charset != utf8Charset {
+		changed = true // the rendering is in UTF-8 instead
+	}
+
+	if d.fixJSONLD() {
+		changed = true
+	}
+
+	if d.scripts == config.ScriptsRewritten && d.fixInlineScripts() {
+		changed = true
+	}
+
+	if !changed {
 		return nil, false, nil
 	}
 
@@ -108,7 +159,7 @@ func fixHTMLNodeURL(baseURL *url.URL, attributes []string, node *html.Node, star
 			attribute.Val = adjusted
 			changed = true
 
-			logger.Debug("HTML node relinked",
+			logger.Document.Debug("HTML node relinked",
 				slog.String("value", value),
 				slog.String("fixed_value", adjusted))
 		}
@@ -130,3 +181,70 @@ func resolveSrcSetURLs(base *url.URL, srcSetValue, startURLHost, relativeToRoot
 
 	return strings.Join(values, ", ")
 }
+
+// fixInlineScripts rewrites URLs found in inline scripts. It returns whether any have been fixed.
+func (d *HTMLDocument) fixInlineScripts() (changed bool) {
+	for _, text := range inlineScripts(d.doc) {
+		fixed, _ := CheckScriptForUrls(d.u, d.startURL.Host, []byte(text.Data), config.ScriptsRewritten)
+		if string(fixed) != text.Data {
+			text.Data = string(fixed)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fixJSONLD rewrites URLs found in JSON-LD structured data. It returns whether any have been fixed.
+func (d *HTMLDocument) fixJSONLD() (changed bool) {
+	for _, text := range scriptsMatching(d.doc, isJSONLDType) {
+		fixed, _ := CheckJSONLDForUrls(d.u, d.startURL.Host, []byte(text.Data))
+		if string(fixed) != text.Data {
+			text.Data = string(fixed)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// inlineScripts finds the text nodes of all script elements that contain JavaScript or JSON.
+func inlineScripts(node *html.Node) []*html.Node {
+	return scriptsMatching(node, isScriptType)
+}
+
+// scriptsMatching finds the text nodes of the script elements that are accepted by a predicate.
+func scriptsMatching(node *html.Node, accept func(scriptType string) bool) []*html.Node {
+	var list []*html.Node
+	for n := range node.Descendants() {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Script && accept(scriptType(n)) {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					list = append(list, c)
+				}
+			}
+		}
+	}
+	return list
+}
+
+func scriptType(node *html.Node) string {
+	return scriptTypeOf(node.Attr)
+}
+
+func scriptTypeOf(attrs []html.Attribute) string {
+	for _, attr := range attrs {
+		if attr.Key == "type" {
+			return strings.ToLower(strings.TrimSpace(attr.Val))
+		}
+	}
+	return ""
+}
+
+// isScriptType accepts JavaScript and JSON, except JSON-LD, which has its own handling.
+func isScriptType(t string) bool {
+	return t == "" || t == "module" || t == "importmap" ||
+		strings.Contains(t, "javascript") || (strings.Contains(t, "json") && !isJSONLDType(t))
+}
+
+func isJSONLDType(t string) bool {
+	return t == "application/ld+json"
+}
@@ -1,10 +1,16 @@
 package document
 
 import (
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/htmlindex"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/work"
-	"log/slog"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 func (d *HTMLDocument) FindReferences() (work.Refs, error) {
@@ -13,7 +19,7 @@ func (d *HTMLDocument) FindReferences() (work.Refs, error) {
 	for tag := range htmlindex.Nodes {
 		references, err := d.index.URLs(tag)
 		if err != nil {
-			logger.Error("Getting node URLs failed",
+			logger.Document.Error("Getting node URLs failed",
 				slog.String("url", d.u.String()),
 				slog.String("node", tag.String()),
 				slog.Any("error", err))
@@ -25,5 +31,98 @@ func (d *HTMLDocument) FindReferences() (work.Refs, error) {
 		}
 	}
 
+	for _, text := range scriptsMatching(d.doc, isJSONLDType) {
+		_, refs := CheckJSONLDForUrls(d.u, d.startURL.Host, []byte(text.Data))
+		result = append(result, refs...)
+	}
+
+	if d.scripts != config.ScriptsIgnored {
+		for _, text := range inlineScripts(d.doc) {
+			_, refs := CheckScriptForUrls(d.u, d.startURL.Host, []byte(text.Data), config.ScriptsScanned)
+			result = append(result, refs...)
+		}
+	}
+
 	return result, nil
 }
+
+// maxLinkTextLength limits the length of the link texts, which are only used for reports.
+const maxLinkTextLength = 100
+
+// Links gets the details of each reference in the document, keyed by its URL without any
+// fragment: where it was first found and, for hyperlinks, the text of the first one with any.
+// Links around images use the image's alt text. Link elements have their relations.
+func (d *HTMLDocument) Links() map[string]work.Link {
+	links := make(map[string]work.Link)
+
+	for tag := range htmlindex.Nodes {
+		for key, nodes := range d.index.Nodes(tag) {
+			u, err := url.Parse(key)
+			if err != nil {
+				continue
+			}
+			u.Fragment = ""
+
+			link, exists := links[u.String()]
+			if !exists {
+				link.Source = d.index.Source(key)
+			}
+
+			if tag == atom.Link && link.Rel == "" {
+				link.Rel = attributeValue(nodes[0], "rel")
+			}
+
+			if tag == atom.A && link.Text == "" {
+				for _, node := range nodes {
+					if link.Text = linkText(node); link.Text != "" {
+						break
+					}
+				}
+			}
+
+			links[u.String()] = link
+		}
+	}
+
+	return links
+}
+
+// linkText gets the text content of a node, with its whitespace collapsed.
+func linkText(node *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			b.WriteString(attributeValue(n, "alt"))
+			b.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	return collapseLinkText(b.String())
+}
+
+// collapseLinkText collapses the whitespace in a link text and limits its length.
+func collapseLinkText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxLinkTextLength {
+		text = strings.ToValidUTF8(text[:maxLinkTextLength], "") + "…"
+	}
+	return text
+}
+
+func attributeValue(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/rickb777/expect"
 	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
 )
 
 func mustParseURL(s string) *url.URL {
@@ -48,3 +49,27 @@ func TestFindReferences(t *testing.T) {
 		mustParseURL("https://domain.com/test-800w.jpg"),
 		mustParseURL("http://domain.com/js/func.min.js"))
 }
+
+func TestLinks(t *testing.T) {
+	u := mustParseURL("http://domain.com/docs/")
+
+	b := []byte(`<html><head><link rel="manifest" href="/app.json"></head><body>
+  <a href="guide.pdf#page=2">The
+     <em>user</em> guide</a>
+  <a href="/home"><img src="/logo.png" alt="Home"></a>
+  <a href="/blank"></a>
+  <a href="/blank">Second link</a>
+</body></html>
+`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b))
+	expect.Error(err).ToBeNil(t)
+
+	expect.Map(doc.Links()).ToBe(t, map[string]work.Link{
+		"http://domain.com/docs/guide.pdf": {Text: "The user guide", Source: "a href"},
+		"http://domain.com/home":           {Text: "Home", Source: "a href"},
+		"http://domain.com/blank":          {Text: "Second link", Source: "a href"},
+		"http://domain.com/logo.png":       {Source: "img src"},
+		"http://domain.com/app.json":       {Source: "link href", Rel: "manifest"},
+	})
+}
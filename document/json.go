@@ -0,0 +1,197 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// manifestURLKeys lists the web app manifest members that hold the URLs of icons and screenshots.
+var manifestURLKeys = map[string]struct{}{
+	"src": {},
+}
+
+// jsonLDURLKeys lists the JSON-LD (schema.org) properties that usually hold URLs.
+var jsonLDURLKeys = map[string]struct{}{
+	"contentUrl":   {},
+	"image":        {},
+	"logo":         {},
+	"thumbnailUrl": {},
+	"url":          {},
+}
+
+// CheckManifestForUrls finds the icons, screenshots and shortcut icons in a web app manifest
+// (manifest.webmanifest). They are resolved relative to the manifest and rewritten to the
+// relative paths of the local copies.
+func CheckManifestForUrls(manifestURL *url.URL, startURLHost string, data []byte) ([]byte, work.Refs) {
+	return checkJSONForUrls(manifestURL, startURLHost, "", data, manifestURLKeys)
+}
+
+// CheckJSONLDForUrls finds the image and url properties in JSON-LD structured data, such as
+// the content of a <script type="application/ld+json"> element. They are resolved relative to
+// pageURL and rewritten to the relative paths of the local copies.
+func CheckJSONLDForUrls(pageURL *url.URL, startURLHost string, data []byte) ([]byte, work.Refs) {
+	return checkJSONForUrls(pageURL, startURLHost, urlRelativeToRoot(pageURL), data, jsonLDURLKeys)
+}
+
+// jsonFrame tracks the object or array being decoded, and the member name that applies to the
+// next value.
+type jsonFrame struct {
+	isObject  bool
+	expectKey bool
+	key       string
+}
+
+// checkJSONForUrls walks the tokens of a JSON document, looking for string values whose member
+// name is one of the keys. Values in arrays take the name of the member holding the array. The
+// source is altered in place, so its layout is preserved.
+func checkJSONForUrls(base *url.URL, startURLHost, relativeToRoot string, data []byte, keys map[string]struct{}) ([]byte, work.Refs) {
+	var refs work.Refs
+	var rewritten []byte
+	copied := 0
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var stack []jsonFrame
+	previous := 0
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) && len(stack) == 0 {
+			break
+		}
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			logger.Document.Debug("Parsing JSON failed",
+				slog.String("url", base.String()),
+				slog.Any("error", err))
+			return data, refs // leave the source unaltered
+		}
+
+		end := int(dec.InputOffset())
+		start := previous
+		previous = end
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, jsonFrame{isObject: true, expectKey: true})
+			case '[':
+				frame := jsonFrame{}
+				if top != nil {
+					frame.key = top.key
+				}
+				stack = append(stack, frame)
+			default:
+				stack = stack[:len(stack)-1]
+				if len(stack) > 0 && stack[len(stack)-1].isObject {
+					stack[len(stack)-1].expectKey = true
+				}
+			}
+
+		case string:
+			if top != nil && top.isObject && top.expectKey {
+				top.key = t
+				top.expectKey = false
+				continue
+			}
+
+			if top != nil {
+				if _, wanted := keys[top.key]; wanted {
+					start = literalStart(data, start)
+					ref, fixed := resolveJSONURL(base, startURLHost, relativeToRoot, t)
+					if ref != nil {
+						refs = append(refs, ref)
+					}
+					if fixed != t {
+						rewritten = append(rewritten, data[copied:start]...)
+						rewritten = append(rewritten, jsonString(fixed, data[start:end])...)
+						copied = end
+					}
+				}
+
+				if top.isObject {
+					top.expectKey = true
+				}
+			}
+
+		default:
+			if top != nil && top.isObject {
+				top.expectKey = true
+			}
+		}
+	}
+
+	if rewritten == nil {
+		return data, refs // nothing more needs doing
+	}
+
+	return append(rewritten, data[copied:]...), refs
+}
+
+// literalStart skips the white space and separators that precede a string literal.
+func literalStart(data []byte, i int) int {
+	for i < len(data) && data[i] != '"' {
+		i++
+	}
+	return i
+}
+
+func resolveJSONURL(base *url.URL, startURLHost, relativeToRoot, value string) (*url.URL, string) {
+	value = strings.TrimSpace(value)
+	if value == "" || hasIgnoredPrefix(value) {
+		return nil, value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		logger.Document.Error("Parsing URL failed",
+			slog.String("url", value),
+			slog.Any("error", err))
+		return nil, value
+	}
+
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return nil, value
+	}
+
+	resolved := base.ResolveReference(u)
+	resolved.Fragment = ""
+
+	fixed := nonBlankURL(resolveURL(base, value, startURLHost, relativeToRoot), resolved)
+	if fixed != value {
+		logger.Document.Debug("JSON URL relinked", slog.String("url", value), slog.String("fixed", fixed))
+	}
+
+	return resolved, fixed
+}
+
+// jsonString encodes a string value, following the original literal if it escaped its slashes.
+func jsonString(value string, original []byte) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(value)
+
+	encoded := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if bytes.Contains(original, []byte(`\/`)) {
+		encoded = bytes.ReplaceAll(encoded, []byte("/"), []byte(`\/`))
+	}
+	return encoded
+}
@@ -0,0 +1,88 @@
+package document
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestCheckManifestForUrls(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `{
+  "name": "App",
+  "start_url": "/",
+  "icons": [
+    {"src": "https://example.org/icons/192.png", "sizes": "192x192"},
+    {"src": "icons/512.png", "sizes": "512x512"}
+  ],
+  "shortcuts": [{"name": "News", "url": "/news/", "icons": [{"src": "/icons/news.png"}]}],
+  "screenshots": [{"src": "data:image/png;base64,iVBORw0"}]
+}`
+
+	u := mustParseURL("https://example.org/app/manifest.webmanifest")
+
+	data, refs := CheckManifestForUrls(u, "example.org", []byte(sample))
+
+	expected := `{
+  "name": "App",
+  "start_url": "/",
+  "icons": [
+    {"src": "../icons/192.png", "sizes": "192x192"},
+    {"src": "icons/512.png", "sizes": "512x512"}
+  ],
+  "shortcuts": [{"name": "News", "url": "/news/", "icons": [{"src": "../icons/news.png"}]}],
+  "screenshots": [{"src": "data:image/png;base64,iVBORw0"}]
+}`
+	expect.String(string(data)).ToBe(t, expected)
+
+	expect.Slice(refs).ToHaveLength(t, 3)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/icons/192.png"),
+		mustParseURL("https://example.org/app/icons/512.png"),
+		mustParseURL("https://example.org/icons/news.png"))
+}
+
+func TestCheckManifestForUrls_invalid(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `{"icons": [{"src": "/icons/192.png"}`
+
+	data, _ := CheckManifestForUrls(mustParseURL("https://example.org/manifest.webmanifest"), "example.org", []byte(sample))
+	expect.String(string(data)).ToBe(t, sample)
+}
+
+func TestJSONLD(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("https://example.org/blog/post.html")
+
+	b := []byte(`<html><head>
+<script type="application/ld+json">{"@type": "Article", "url": "https:\/\/example.org\/blog\/post.html",
+ "image": ["https://example.org/img/a.jpg", "/img/b.jpg"],
+ "publisher": {"@type": "Organization", "url": "https://other.org/", "logo": {"@type": "ImageObject", "url": "/img/logo.png"}}}</script>
+</head><body></body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 5)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("https://example.org/blog/post.html"),
+		mustParseURL("https://example.org/img/a.jpg"),
+		mustParseURL("https://example.org/img/b.jpg"),
+		mustParseURL("https://other.org/"),
+		mustParseURL("https://example.org/img/logo.png"))
+
+	rendered, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeTrue(t)
+	expect.String(string(rendered)).ToContain(t, `{"@type": "Article", "url": "post.html",
+ "image": ["../img/a.jpg", "../img/b.jpg"],
+ "publisher": {"@type": "Organization", "url": "https://other.org/", "logo": {"@type": "ImageObject", "url": "../img/logo.png"}}}`)
+}
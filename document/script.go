@@ -0,0 +1,141 @@
+package document
+
+import (
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// scriptStringRe matches double-quoted, single-quoted and simple template string literals.
+// Template literals containing substitutions are ignored.
+var scriptStringRe = regexp.MustCompile(`"((?:[^"\\\n]|\\.)*)"|'((?:[^'\\\n]|\\.)*)'|` + "`([^`$\\\\]*)`")
+
+// assetExtensions lists the file extensions of string literals that are likely to be URLs.
+var assetExtensions = map[string]struct{}{
+	".avif": {}, ".bmp": {}, ".gif": {}, ".ico": {}, ".jpeg": {}, ".jpg": {}, ".png": {}, ".svg": {}, ".webp": {},
+	".css": {}, ".js": {}, ".mjs": {}, ".json": {}, ".map": {}, ".wasm": {},
+	".eot": {}, ".otf": {}, ".ttf": {}, ".woff": {}, ".woff2": {},
+	".m4a": {}, ".mp3": {}, ".mp4": {}, ".ogg": {}, ".webm": {}, ".vtt": {},
+	".htm": {}, ".html": {}, ".pdf": {}, ".txt": {}, ".xml": {},
+}
+
+// CheckScriptForUrls finds string literals in JavaScript or JSON source that look like
+// same-site URLs of assets with known file extensions. The URLs are resolved relative
+// to scriptURL.
+//
+// When the mode is config.ScriptsRewritten, absolute same-site URLs are rewritten to be
+// root-relative so that they resolve against whichever server is hosting the copy.
+// Other literals are left as they are because, at runtime, relative URLs are resolved
+// against the page that loads the script, which cannot be known here.
+func CheckScriptForUrls(scriptURL *url.URL, startURLHost string, data []byte, mode config.ScriptMode) ([]byte, work.Refs) {
+	var refs work.Refs
+	seen := make(map[string]struct{})
+
+	var rewritten []byte
+	copied := 0
+
+	for _, m := range scriptStringRe.FindAllSubmatchIndex(data, -1) {
+		start, end := literalBounds(m)
+		if start < 0 {
+			continue
+		}
+
+		literal := string(data[start:end])
+		escapedSlashes := strings.Contains(literal, `\/`)
+		if escapedSlashes {
+			literal = strings.ReplaceAll(literal, `\/`, "/") // as found in JSON
+		}
+
+		u, ok := likelyURL(literal, startURLHost)
+		if !ok {
+			continue
+		}
+
+		resolved := scriptURL.ResolveReference(u)
+		resolved.Fragment = ""
+		if _, exists := seen[resolved.String()]; !exists {
+			seen[resolved.String()] = struct{}{}
+			refs = append(refs, resolved)
+		}
+
+		if mode == config.ScriptsRewritten && u.Host != "" {
+			local := *u
+			local.Scheme = ""
+			local.Host = ""
+			local.User = nil
+			fixed := local.String()
+			if fixed == "" {
+				fixed = "/"
+			}
+			if escapedSlashes {
+				fixed = strings.ReplaceAll(fixed, "/", `\/`)
+			}
+
+			rewritten = append(rewritten, data[copied:start]...)
+			rewritten = append(rewritten, fixed...)
+			copied = end
+
+			logger.Document.Debug("Script string relinked", slog.String("url", literal), slog.String("fixed", fixed))
+		}
+	}
+
+	if rewritten == nil {
+		return data, refs // nothing more needs doing
+	}
+
+	return append(rewritten, data[copied:]...), refs
+}
+
+// literalBounds gets the start and end of the content of whichever string literal group matched.
+func literalBounds(m []int) (int, int) {
+	for g := 1; g < len(m)/2; g++ {
+		if m[2*g] >= 0 {
+			return m[2*g], m[2*g+1]
+		}
+	}
+	return -1, -1
+}
+
+// likelyURL decides whether a string literal is probably the URL of an asset on the start host.
+func likelyURL(s, startURLHost string) (*url.URL, bool) {
+	if s == "" || len(s) > 2048 || strings.ContainsAny(s, " \t\r\n<>{}\\") {
+		return nil, false
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Path == "" || u.Opaque != "" {
+		return nil, false
+	}
+
+	switch u.Scheme {
+	case "":
+		if u.Host == "" && !isPathLike(s) {
+			return nil, false
+		}
+	case "http", "https":
+	default:
+		return nil, false
+	}
+
+	if u.Host != "" && u.Host != startURLHost {
+		return nil, false // points to a different website
+	}
+
+	if _, isAsset := assetExtensions[strings.ToLower(path.Ext(u.Path))]; !isAsset {
+		return nil, false
+	}
+
+	return u, true
+}
+
+// isPathLike rejects relative strings such as "a.b.js" that are more likely to be module or
+// property names than file names.
+func isPathLike(s string) bool {
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") || strings.Contains(s, "/")
+}
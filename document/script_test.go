@@ -0,0 +1,110 @@
+package document
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestCheckScriptForURLs(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cases := []struct{ input, ref, rewritten string }{
+		{
+			input:     `img.src = "/img/logo.png";`,
+			ref:       "http://localhost/img/logo.png",
+			rewritten: `img.src = "/img/logo.png";`,
+		},
+		{
+			input:     `import('./chunks/main.3f2a.js')`,
+			ref:       "http://localhost/js/chunks/main.3f2a.js",
+			rewritten: `import('./chunks/main.3f2a.js')`,
+		},
+		{
+			input:     "const u = `http://localhost/fonts/a.woff2`;",
+			ref:       "http://localhost/fonts/a.woff2",
+			rewritten: "const u = `/fonts/a.woff2`;",
+		},
+		{
+			input:     `{"icon":"http:\/\/localhost\/icons\/x.svg?v=2"}`,
+			ref:       "http://localhost/icons/x.svg?v=2",
+			rewritten: `{"icon":"\/icons\/x.svg?v=2"}`,
+		},
+		{
+			input:     `fetch("//localhost/data/list.json")`,
+			ref:       "http://localhost/data/list.json",
+			rewritten: `fetch("/data/list.json")`,
+		},
+		{input: `x = "https://other.org/img/logo.png"`},
+		{input: `require("lodash.debounce.js")`},
+		{input: `s = "/api/items"`},
+		{input: "s = `/img/${name}.png`"},
+		{input: `s = "mailto:someone@localhost.png"`},
+	}
+
+	scriptURL := mustParseURL("http://localhost/js/app.js")
+
+	for i, c := range cases {
+		scanned, refs := CheckScriptForUrls(scriptURL, "localhost", []byte(c.input), config.ScriptsScanned)
+		expect.String(string(scanned)).Info(i).ToBe(t, c.input)
+
+		if c.ref == "" {
+			expect.Slice(refs).Info(i).ToBeEmpty(t)
+			continue
+		}
+
+		expect.Slice(refs).Info(i).ToHaveLength(t, 1)
+		expect.String(refs[0].String()).Info(i).ToBe(t, c.ref)
+
+		rewritten, _ := CheckScriptForUrls(scriptURL, "localhost", []byte(c.input), config.ScriptsRewritten)
+		expect.String(string(rewritten)).Info(i).ToBe(t, c.rewritten)
+	}
+}
+
+func TestInlineScripts(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/content/")
+
+	b := []byte(`<html><head>
+<script>var bg = "http://domain.com/img/bg.jpg";</script>
+<script type="application/json">{"poster": "/media/poster.webp"}</script>
+<script type="text/template"><img src="/not/this.png"></script>
+</head><body></body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b))
+	expect.Error(err).ToBeNil(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToBeEmpty(t)
+
+	_, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeFalse(t)
+
+	doc.ScanScripts(config.ScriptsScanned)
+
+	refs, err = doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 2)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("http://domain.com/img/bg.jpg"),
+		mustParseURL("http://domain.com/media/poster.webp"))
+
+	_, fixed, err = doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeFalse(t)
+
+	doc.ScanScripts(config.ScriptsRewritten)
+
+	rendered, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeTrue(t)
+	expect.String(string(rendered)).ToContain(t, `var bg = "/img/bg.jpg";`)
+	expect.String(string(rendered)).ToContain(t, `{"poster": "/media/poster.webp"}`)
+}
@@ -0,0 +1,236 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/htmlindex"
+	"github.com/rickb777/goscrape2/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// CanStreamHTML decides whether an HTML document can be processed by StreamHTML, given the
+// first part of its content. This is not possible if the document has a <base> element,
+// which alters the meaning of the URLs before it, or if it is not in UTF-8.
+func CanStreamHTML(prefix []byte, contentType string) bool {
+	if bytes.Contains(bytes.ToLower(prefix), []byte("<base")) {
+		return false
+	}
+
+	_, name, _ := charset.DetermineEncoding(prefix, contentType)
+	return name == utf8Charset
+}
+
+// StreamHTML copies an HTML document from rdr to w, relinking the URLs in its elements token
+// by token so that the document is never held in memory as a whole. It returns the same
+// references and link details that FindReferences and Links would. Only the elements that
+// need relinking are altered; the rest of the source is copied as it is.
+//
+// Use CanStreamHTML first: unlike ParseHTML, this neither honours <base href> nor converts
+// legacy character sets.
+func StreamHTML(u, startURL *url.URL, rdr io.Reader, w io.Writer, scripts config.ScriptMode) (work.Refs, map[string]work.Link, error) {
+	relativeToRoot := urlRelativeToRoot(u)
+	links := &streamLinks{links: make(map[string]work.Link)}
+
+	var refs work.Refs
+	seen := make(map[string]struct{})
+	addRefs := func(list ...*url.URL) {
+		for _, ref := range list {
+			ref.Fragment = ""
+			if _, exists := seen[ref.String()]; !exists {
+				seen[ref.String()] = struct{}{}
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	z := html.NewTokenizer(rdr)
+	var scriptType string // the type of the enclosing <script>, if any
+	inScript := false
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return refs, links.links, nil
+			}
+			return refs, links.links, fmt.Errorf("tokenizing: %w", z.Err())
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := tagAtom(z.Raw())
+			if _, ok := htmlindex.Nodes[tag]; !ok && tag != atom.Script {
+				if _, err := w.Write(z.Raw()); err != nil {
+					return refs, links.links, err
+				}
+				continue
+			}
+
+			raw := bytes.Clone(z.Raw()) // because Token lower-cases the buffer in place
+			token := z.Token()
+
+			if token.DataAtom == atom.Script && tt == html.StartTagToken {
+				inScript = true
+				scriptType = scriptTypeOf(token.Attr)
+			}
+
+			if info, ok := htmlindex.Nodes[token.DataAtom]; ok {
+				node := &html.Node{Type: html.ElementNode, DataAtom: token.DataAtom, Data: token.Data, Attr: token.Attr}
+
+				for _, s := range htmlindex.NodeURLs(u, node) {
+					if ref, err := url.Parse(s); err == nil {
+						addRefs(ref)
+					}
+				}
+
+				links.element(u, node, info.Attributes, tt == html.StartTagToken)
+
+				if fixHTMLNodeURL(u, info.Attributes, node, startURL.Host, relativeToRoot) {
+					token.Attr = node.Attr
+					if _, err := io.WriteString(w, token.String()); err != nil {
+						return refs, links.links, err
+					}
+					continue
+				}
+			}
+
+			if _, err := w.Write(raw); err != nil {
+				return refs, links.links, err
+			}
+
+		case html.TextToken:
+			raw := z.Raw()
+
+			if inScript {
+				var found work.Refs
+				raw, found = streamScript(u, startURL.Host, raw, scriptType, scripts)
+				addRefs(found...)
+			} else {
+				links.text(raw)
+			}
+
+			if _, err := w.Write(raw); err != nil {
+				return refs, links.links, err
+			}
+
+		case html.EndTagToken:
+			inScript = false
+			if _, err := w.Write(z.Raw()); err != nil {
+				return refs, links.links, err
+			}
+
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.A {
+				links.endAnchor()
+			}
+
+		default:
+			if _, err := w.Write(z.Raw()); err != nil {
+				return refs, links.links, err
+			}
+		}
+	}
+}
+
+// streamLinks gathers the details of the references in a document as it is streamed, in the
+// same way as HTMLDocument.Links.
+type streamLinks struct {
+	links  map[string]work.Link
+	anchor string          // the URL of the enclosing <a>, if any
+	buf    strings.Builder // the text of the enclosing <a>
+}
+
+// element records where the URLs in the attributes of an element were found. An <a> start
+// tag begins the gathering of its text, and so do images within it, using their alt text.
+func (sl *streamLinks) element(u *url.URL, node *html.Node, attributes []string, isStart bool) {
+	for _, attribute := range attributes {
+		for _, s := range htmlindex.NodeAttributeURLs(u, node, attribute) {
+			ref, err := url.Parse(s)
+			if err != nil {
+				continue
+			}
+			ref.Fragment = ""
+			key := ref.String()
+
+			link, exists := sl.links[key]
+			if !exists {
+				link.Source = node.Data + " " + attribute
+			}
+			if node.DataAtom == atom.Link && link.Rel == "" {
+				link.Rel = attributeValue(node, "rel")
+			}
+			sl.links[key] = link
+
+			if node.DataAtom == atom.A && isStart {
+				sl.anchor = key
+				sl.buf.Reset()
+			}
+		}
+	}
+
+	if node.DataAtom == atom.Img && sl.anchor != "" {
+		sl.buf.WriteString(attributeValue(node, "alt"))
+		sl.buf.WriteByte(' ')
+	}
+}
+
+// text adds the text within an <a> element.
+func (sl *streamLinks) text(raw []byte) {
+	if sl.anchor != "" {
+		sl.buf.WriteString(html.UnescapeString(string(raw)))
+		sl.buf.WriteByte(' ')
+	}
+}
+
+// endAnchor keeps the text of an <a> element, unless an earlier one with the same URL had
+// some text.
+func (sl *streamLinks) endAnchor() {
+	if sl.anchor == "" {
+		return
+	}
+
+	link := sl.links[sl.anchor]
+	if link.Text == "" {
+		link.Text = collapseLinkText(sl.buf.String())
+		sl.links[sl.anchor] = link
+	}
+	sl.anchor = ""
+}
+
+// tagAtom gets the element name from the source of a start tag, without altering it.
+func tagAtom(raw []byte) atom.Atom {
+	name := raw[1:] // after '<'
+	if end := bytes.IndexAny(name, " \t\n\f\r/>"); end >= 0 {
+		name = name[:end]
+	}
+	if len(name) > 16 {
+		return 0 // longer than any known element
+	}
+	var lower [16]byte
+	for i, c := range name {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return atom.Lookup(lower[:len(name)])
+}
+
+// streamScript handles the content of a <script> element in the same way as the DOM path.
+func streamScript(u *url.URL, startURLHost string, raw []byte, scriptType string, scripts config.ScriptMode) ([]byte, work.Refs) {
+	switch {
+	case isJSONLDType(scriptType):
+		return CheckJSONLDForUrls(u, startURLHost, raw)
+
+	case scripts != config.ScriptsIgnored && isScriptType(scriptType):
+		return CheckScriptForUrls(u, startURLHost, raw, scripts)
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,194 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func TestStreamHTML(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/content/")
+
+	b := `<!DOCTYPE html>
+<HTML lang="es"><head>
+<script type="application/ld+json">{"image": "http://domain.com/img/card.png"}</script>
+<script>var bg = "http://domain.com/img/bg.jpg";</script>
+</head>
+<body>
+  <!-- <a href="/not/this.html"> -->
+  <a href="https://domain.com/">Home &amp; away</a>
+  <A HREF="https://domain.com/wp-content/uploads/document.pdf" rel="doc">Guide</A>
+  <img src="https://domain.com/content/test.jpg" srcset="https://domain.com/content/test-480w.jpg 480w, https://domain.com/content/test-800w.jpg 800w"/>
+  <img src="/other.jpg">
+  <a href="#top">Top</a>
+</body></HTML>
+`
+
+	var out bytes.Buffer
+	refs, links, err := StreamHTML(u, u, strings.NewReader(b), &out, config.ScriptsRewritten)
+	expect.Error(err).ToBeNil(t)
+
+	expected := `<!DOCTYPE html>
+<HTML lang="es"><head>
+<script type="application/ld+json">{"image": "../img/card.png"}</script>
+<script>var bg = "/img/bg.jpg";</script>
+</head>
+<body>
+  <!-- <a href="/not/this.html"> -->
+  <a href="../">Home &amp; away</a>
+  <a href="../wp-content/uploads/document.pdf" rel="doc">Guide</A>
+  <img src="test.jpg" srcset="test-480w.jpg 480w, test-800w.jpg 800w"/>
+  <img src="../other.jpg">
+  <a href="#top">Top</a>
+</body></HTML>
+`
+	expect.String(out.String()).ToBe(t, expected)
+
+	// the references are the same as with the DOM
+	doc, err := ParseHTML(u, u, strings.NewReader(b))
+	expect.Error(err).ToBeNil(t)
+	doc.ScanScripts(config.ScriptsRewritten)
+	domRefs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+
+	expect.Slice(refs).ToHaveLength(t, 9)
+	expect.Slice(refs).ToContainAll(t, domRefs...)
+
+	// and so are the link details
+	expect.Map(links).ToBe(t, doc.Links())
+	expect.Any(links["https://domain.com/"]).ToBe(t, work.Link{Text: "Home & away", Source: "a href"})
+}
+
+func TestStreamHTML_links(t *testing.T) {
+	u := mustParseURL("http://domain.com/docs/")
+
+	b := `<html><head><link rel="manifest" href="/app.json"></head><body>
+  <a href="guide.pdf#page=2">The
+     <em>user</em> guide</a>
+  <a href="/home"><img src="/logo.png" alt="Home"></a>
+  <a href="/blank"></a>
+  <a href="/blank">Second link</a>
+</body></html>
+`
+
+	_, links, err := StreamHTML(u, u, strings.NewReader(b), io.Discard, config.ScriptsIgnored)
+	expect.Error(err).ToBeNil(t)
+
+	doc, err := ParseHTML(u, u, strings.NewReader(b))
+	expect.Error(err).ToBeNil(t)
+
+	expect.Map(links).ToBe(t, doc.Links())
+}
+
+func TestCanStreamHTML(t *testing.T) {
+	cases := []struct {
+		prefix, contentType string
+		expected            bool
+	}{
+		{prefix: `<html><head><meta charset="utf-8"></head>`, expected: true},
+		{prefix: `<html><head></head>`, contentType: "text/html; charset=utf-8", expected: true},
+		{prefix: `<html><head><BASE href="/x/"></head>`, contentType: "text/html; charset=utf-8"},
+		{prefix: `<html><head><meta charset="iso-8859-1"></head>`},
+		{prefix: `<html><head></head>`, contentType: "text/html; charset=shift_jis"},
+		{prefix: `<html><head></head>`}, // undeclared and ASCII so far
+	}
+
+	for i, c := range cases {
+		expect.Bool(CanStreamHTML([]byte(c.prefix), c.contentType)).Info(i).ToBe(t, c.expected)
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// largeHTML generates a report-like document with a table of n rows.
+func largeHTML(n int) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><link rel="stylesheet" href="/css/report.css"></head><body><table>`)
+	for i := range n {
+		fmt.Fprintf(buf, `<tr><td><a href="http://domain.com/items/%d.html">Item %d</a></td><td><img src="/icons/%d.png"></td><td>Some descriptive text for row %d</td></tr>`+"\n", i, i, i%10, i)
+	}
+	buf.WriteString(`</table></body></html>`)
+	return buf.Bytes()
+}
+
+// The two benchmarks compare the memory used by the DOM and streaming approaches. The
+// "live-B/op" metric is the heap in use at the point where each approach holds most data:
+// for the DOM, when the tree and its rendering are complete; for streaming, half way through.
+// Run with -benchmem to compare the allocations too.
+
+func BenchmarkHTML_DOM(b *testing.B) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/reports/big.html")
+	data := largeHTML(20000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	var live uint64
+	for b.Loop() {
+		before := liveHeap()
+		doc, err := ParseHTML(u, u, bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		fixed, _, err := doc.FixURLReferences()
+		if err != nil {
+			b.Fatal(err)
+		}
+		refs, _ := doc.FindReferences()
+		live += liveHeap() - before
+		runtime.KeepAlive(doc)
+		runtime.KeepAlive(fixed)
+		runtime.KeepAlive(refs)
+	}
+	b.ReportMetric(float64(live)/float64(b.N), "live-B/op")
+}
+
+func BenchmarkHTML_streaming(b *testing.B) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := mustParseURL("http://domain.com/reports/big.html")
+	data := largeHTML(20000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	var live uint64
+	for b.Loop() {
+		probe := &midwayProbe{half: len(data) / 2, before: liveHeap()}
+		_, _, err := StreamHTML(u, u, bytes.NewReader(data), probe, config.ScriptsIgnored)
+		if err != nil {
+			b.Fatal(err)
+		}
+		live += probe.live
+	}
+	b.ReportMetric(float64(live)/float64(b.N), "live-B/op")
+}
+
+func liveHeap() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// midwayProbe discards what is written but measures the heap when half of it has been written.
+type midwayProbe struct {
+	half, n      int
+	before, live uint64
+}
+
+func (p *midwayProbe) Write(b []byte) (int, error) {
+	if p.n < p.half && p.n+len(b) >= p.half {
+		p.live = liveHeap() - p.before
+	}
+	p.n += len(b)
+	return len(b), nil
+}
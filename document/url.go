@@ -92,3 +92,16 @@ func urlRelativeToOther(src, base *urlpkg.URL) string {
 
 	return upLevels + path.Join(srcSplits...)
 }
+
+// nonBlankURL replaces the blank result that resolveURL gives for a link to the document
+// itself, or to its directory, with the equivalent relative reference.
+func nonBlankURL(resolved string, ref *urlpkg.URL) string {
+	switch {
+	case resolved != "":
+		return resolved
+	case strings.HasSuffix(ref.Path, "/"):
+		return "./"
+	default:
+		return path.Base(ref.Path)
+	}
+}
@@ -3,18 +3,25 @@ package document
 import (
 	"bytes"
 	"fmt"
-	"github.com/beevik/etree"
-	"github.com/rickb777/goscrape2/work"
 	"io"
+	"log/slog"
 	"net/url"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
 )
 
 type SVGDocument struct {
-	etree.Document
+	doc      *etree.Document
 	u        *url.URL
 	startURL *url.URL
+	refs     work.Refs
 }
 
+// ParseSVG parses an SVG document. All the references it contains are gathered
+// at this point, before any of them get altered by FixURLReferences.
 func ParseSVG(u, startURL *url.URL, rdr io.Reader) (*SVGDocument, error) {
 	doc := etree.NewDocument()
 	_, err := doc.ReadFrom(rdr)
@@ -22,45 +29,163 @@ func ParseSVG(u, startURL *url.URL, rdr io.Reader) (*SVGDocument, error) {
 		return nil, err
 	}
 
-	return &SVGDocument{Document: *doc, u: u, startURL: startURL}, nil
+	d := &SVGDocument{doc: doc, u: u, startURL: startURL}
+	d.refs = d.findReferences()
+	return d, nil
+}
+
+// FindReferences returns the URLs referenced by href and xlink:href attributes, and
+// by url() values in style elements and style attributes.
+func (d *SVGDocument) FindReferences() (work.Refs, error) {
+	return d.refs, nil
+}
+
+func (d *SVGDocument) findReferences() work.Refs {
+	var result work.Refs
+	seen := make(map[string]struct{})
+
+	add := func(ur *url.URL) {
+		ur.Fragment = ""
+		key := ur.String()
+		if _, exists := seen[key]; !exists {
+			seen[key] = struct{}{}
+			result = append(result, ur)
+		}
+	}
+
+	walkXML(&d.doc.Element, func(node *etree.Element) bool {
+		for _, a := range node.Attr {
+			switch {
+			case isLink(a):
+				value := strings.TrimSpace(a.Value)
+				if value == "" || hasIgnoredPrefix(value) {
+					continue
+				}
+
+				ur, err := url.Parse(value)
+				if err != nil {
+					logger.Document.Error("Parsing URL failed",
+						slog.String("url", value),
+						slog.Any("error", err))
+					continue
+				}
+				add(d.u.ResolveReference(ur))
+
+			case isStyle(a):
+				_, refs := CheckCSSForUrls(d.u, d.startURL.Host, []byte(a.Value))
+				for _, ur := range refs {
+					add(ur)
+				}
+			}
+		}
+
+		if node.Tag == "style" {
+			for _, cd := range styleText(node) {
+				_, refs := CheckCSSForUrls(d.u, d.startURL.Host, []byte(cd.Data))
+				for _, ur := range refs {
+					add(ur)
+				}
+			}
+		}
+		return true
+	})
+
+	return result
 }
 
 // FixURLReferences fixes URL references to point to relative file names.
 // It returns a bool that indicates that no reference needed to be fixed,
-// in this case the returned HTML string will be empty.
-func (d *SVGDocument) FixURLReferences() ([]byte, bool, work.Refs, error) {
+// in this case the returned SVG string will be empty.
+func (d *SVGDocument) FixURLReferences() ([]byte, bool, error) {
 	relativeToRoot := urlRelativeToRoot(d.u)
-	//if !fixHTMLNodeURLs(d.u, d.startURL.Host, relativeToRoot, d.index) {
-	//	return nil, false, nil
-	//}
 
-	var links []string
-	walkXML(&d.Element, func(node *etree.Element) bool {
+	var changed bool
+	walkXML(&d.doc.Element, func(node *etree.Element) bool {
 		for i, a := range node.Attr {
-			if isLink(a) {
-				links = append(links, a.Value)
-				a.Value = relativeToRoot + a.Value
-				node.Attr[i] = a
+			switch {
+			case isLink(a):
+				value := strings.TrimSpace(a.Value)
+				if value == "" || hasIgnoredPrefix(value) {
+					continue
+				}
+
+				ref, err := d.u.Parse(value)
+				if err != nil {
+					continue // left as it is
+				}
+
+				adjusted := nonBlankURL(resolveURL(d.u, value, d.startURL.Host, relativeToRoot), ref)
+				if adjusted != value { // check for no change
+					node.Attr[i].Value = adjusted
+					changed = true
+
+					logger.Document.Debug("SVG node relinked",
+						slog.String("value", value),
+						slog.String("fixed_value", adjusted))
+				}
+
+			case isStyle(a):
+				fixed, refs := CheckCSSForUrls(d.u, d.startURL.Host, []byte(a.Value))
+				if len(refs) > 0 && string(fixed) != a.Value {
+					node.Attr[i].Value = string(fixed)
+					changed = true
+				}
+			}
+		}
+
+		if node.Tag == "style" {
+			for _, cd := range styleText(node) {
+				fixed, refs := CheckCSSForUrls(d.u, d.startURL.Host, []byte(cd.Data))
+				if len(refs) > 0 && string(fixed) != cd.Data {
+					cd.SetData(string(fixed))
+					changed = true
+				}
 			}
 		}
 		return true
 	})
 
-	var result work.Refs
+	if !changed {
+		return nil, false, nil
+	}
 
 	var rendered bytes.Buffer
-	_, err := d.WriteTo(&rendered)
+	_, err := d.doc.WriteTo(&rendered)
 	if err != nil {
-		return nil, false, nil, fmt.Errorf("rendering SVG: %w", err)
+		return nil, false, fmt.Errorf("rendering SVG: %w", err)
 	}
 
-	return rendered.Bytes(), true, result, nil
+	return rendered.Bytes(), true, nil
 }
 
 func isLink(a etree.Attr) bool {
 	return (a.Space == "" || a.Space == "xlink") && a.Key == "href"
 }
 
+func isStyle(a etree.Attr) bool {
+	return a.Space == "" && a.Key == "style"
+}
+
+// styleText gets the text and CDATA content of a style element.
+func styleText(node *etree.Element) []*etree.CharData {
+	var list []*etree.CharData
+	for _, c := range node.Child {
+		if cd, ok := c.(*etree.CharData); ok {
+			list = append(list, cd)
+		}
+	}
+	return list
+}
+
+func hasIgnoredPrefix(value string) bool {
+	for _, prefix := range ignoredURLPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func walkXML(node *etree.Element, f func(*etree.Element) bool) {
 	if f(node) {
 		for _, c := range node.ChildElements() {
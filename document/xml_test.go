@@ -1,9 +1,13 @@
 package document
 
 import (
-	"github.com/rickb777/expect"
+	"io"
+	"log/slog"
 	"strings"
 	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
 )
 
 func TestSVG(t *testing.T) {
@@ -20,15 +24,101 @@ height="30" width="200">
 	doc, err := ParseSVG(u1, u2, strings.NewReader(sample))
 	expect.Error(err).ToBeNil(t)
 
-	_, fixed, _, err := doc.FixURLReferences()
+	data, fixed, err := doc.FixURLReferences()
 	expect.Error(err).ToBeNil(t)
 	expect.Bool(fixed).ToBeTrue(t)
 
-	//	expected := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.w3.org/1999/xlink" height="30" width="200">
-	//  <a href="link1.svg"><text>Link1</text></a>
-	//  <a href="../here/link2.svg"><text>Link2</text></a>
-	//  <a href="../there/link3.svg"><text>Link3</text></a>
-	//</svg>`
-	//
-	//	assert.Equal(t, expected, string(data))
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.w3.org/1999/xlink" height="30" width="200">
+  <a href="link1.svg"><text>Link1</text></a>
+  <a href="../here/link2.svg"><text>Link2</text></a>
+  <a href="../there/link3.svg"><text>Link3</text></a>
+</svg>`
+	expect.String(string(data)).ToBe(t, expected)
+}
+
+func TestSVG_styleAndUse(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="30" width="200">
+  <style>.bg { fill: url(/img/bg.png); }</style>
+  <a href="link1.svg"><text>Link1</text></a>
+  <a href="/here/link2.svg"><text>Link2</text></a>
+  <a href="http://example.com/there/link3.svg"><text>Link3</text></a>
+  <a href="http://other.org/link4.svg"><text>Link4</text></a>
+  <use xlink:href="/sprites.svg#icon"/>
+  <use href="#local"/>
+  <rect style="fill: url('/img/fill.png')"/>
+  <image href="data:image/gif;base64,R0lGODl"/>
+</svg>`
+
+	u1 := mustParseURL("http://example.com/dir/page.svg")
+	u2 := mustParseURL("http://example.com/")
+
+	doc, err := ParseSVG(u1, u2, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	data, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeTrue(t)
+
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" height="30" width="200">
+  <style>.bg { fill: url(../img/bg.png); }</style>
+  <a href="link1.svg"><text>Link1</text></a>
+  <a href="../here/link2.svg"><text>Link2</text></a>
+  <a href="../there/link3.svg"><text>Link3</text></a>
+  <a href="http://other.org/link4.svg"><text>Link4</text></a>
+  <use xlink:href="../sprites.svg#icon"/>
+  <use href="#local"/>
+  <rect style="fill: url(../img/fill.png)"/>
+  <image href="data:image/gif;base64,R0lGODl"/>
+</svg>`
+	expect.String(string(data)).ToBe(t, expected)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToHaveLength(t, 7)
+	expect.Slice(refs).ToContainAll(t,
+		mustParseURL("http://example.com/img/bg.png"),
+		mustParseURL("http://example.com/dir/link1.svg"),
+		mustParseURL("http://example.com/here/link2.svg"),
+		mustParseURL("http://example.com/there/link3.svg"),
+		mustParseURL("http://other.org/link4.svg"),
+		mustParseURL("http://example.com/sprites.svg"),
+		mustParseURL("http://example.com/img/fill.png"))
+}
+
+func TestSVG_selfReference(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a href="/dir/"><text>Up</text></a><use xlink:href="/dir/page.svg"/></svg>`
+
+	u := mustParseURL("http://example.com/dir/page.svg")
+
+	doc, err := ParseSVG(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	data, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeTrue(t)
+	expect.String(string(data)).ToBe(t, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a href="./"><text>Up</text></a><use xlink:href="page.svg"/></svg>`)
+}
+
+func TestSVG_unchanged(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sample := `<svg xmlns="http://www.w3.org/2000/svg"><use href="#local"/><circle r="4"/></svg>`
+
+	u := mustParseURL("http://example.com/dir/page.svg")
+
+	doc, err := ParseSVG(u, u, strings.NewReader(sample))
+	expect.Error(err).ToBeNil(t)
+
+	data, fixed, err := doc.FixURLReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(fixed).ToBeFalse(t)
+	expect.Slice(data).ToBeEmpty(t)
+
+	refs, err := doc.FindReferences()
+	expect.Error(err).ToBeNil(t)
+	expect.Slice(refs).ToBeEmpty(t)
 }
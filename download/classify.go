@@ -0,0 +1,281 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/goscrape2/download/ioutil"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+	"github.com/spf13/afero"
+)
+
+// contentKind says how a downloaded file is processed.
+type contentKind int
+
+const (
+	otherContent contentKind = iota
+	htmlContent
+	cssContent
+	svgContent
+	feedContent
+	manifestContent
+	hlsContent
+	dashContent
+	scriptContent // JavaScript or JSON
+	imageContent
+)
+
+// sniffLength is the amount of content examined by classify, as for http.DetectContentType.
+const sniffLength = 512
+
+// extensionTypes supplements mime.TypeByExtension with types that are often missing.
+var extensionTypes = map[string]string{
+	".atom":        "application/atom+xml",
+	".m3u8":        "application/vnd.apple.mpegurl",
+	".mjs":         "text/javascript",
+	".mpd":         "application/dash+xml",
+	".rss":         "application/rss+xml",
+	".webmanifest": "application/manifest+json",
+}
+
+// classify decides what a file contains by combining the content type declared by the origin
+// server (the Content-Type header, or the one stored from a previous run), sniffing the first
+// part of the content and the file extension, in that order of preference.
+//
+// A declaration that is missing or generic, such as application/octet-stream, is disregarded.
+// So is the declaration of a format that gets processed, such as HTML, if the content has the
+// signature of a binary format instead.
+func classify(u *url.URL, declared header.ContentType, prefix []byte) (contentKind, header.ContentType) {
+	sniffed, isBinary := sniff(prefix)
+
+	if isSpecific(declared.MediaType) {
+		kind := kindOf(declared)
+		if sniffed == "" {
+			return kind, declared
+		}
+
+		sniffedType := header.ContentType{MediaType: sniffed}
+		if kindOf(sniffedType) == kind {
+			return kind, declared
+		}
+
+		logger.Download.Debug("Content-Type mismatch",
+			slog.String("url", u.String()),
+			slog.String("declared", declared.MediaType),
+			slog.String("sniffed", sniffed))
+
+		if isBinary && kind != otherContent && kind != imageContent {
+			return kindOf(sniffedType), sniffedType
+		}
+		return kind, declared
+	}
+
+	// keep any charset parameter from the generic declaration
+	if sniffed != "" {
+		ct := header.ContentType{MediaType: sniffed, Params: declared.Params}
+		return kindOf(ct), ct
+	}
+
+	if byExtension := typeByExtension(u); byExtension != "" {
+		ct := header.ContentType{MediaType: byExtension, Params: declared.Params}
+		return kindOf(ct), ct
+	}
+
+	return otherContent, declared
+}
+
+// asReferenced treats JSON, or content of no particular type, as a web app manifest if it was
+// referenced as one, e.g. by <link rel="manifest">. Servers often declare manifests as plain
+// JSON, which would only be processed as a script, if at all.
+func asReferenced(item work.Item, kind contentKind, ct header.ContentType) contentKind {
+	if item.Manifest && (isJSON(ct) || !isSpecific(ct.MediaType)) {
+		return manifestContent
+	}
+	return kind
+}
+
+// sniffedType gets the type that classify found, if it differs from the declared type, so
+// that the two can be stored separately.
+func sniffedType(declared, classified header.ContentType) header.ContentType {
+	if strings.EqualFold(declared.MediaType, classified.MediaType) {
+		return header.ContentType{}
+	}
+	return classified
+}
+
+func kindOf(ct header.ContentType) contentKind {
+	switch {
+	case isHtml(ct) || isXHtml(ct):
+		return htmlContent
+	case isCSS(ct):
+		return cssContent
+	case isSVG(ct):
+		return svgContent
+	case isFeed(ct):
+		return feedContent
+	case isWebManifest(ct):
+		return manifestContent
+	case isHLS(ct):
+		return hlsContent
+	case isDASH(ct):
+		return dashContent
+	case isJavaScript(ct) || isJSON(ct):
+		return scriptContent
+	case ct.Type() == "image":
+		return imageContent
+	}
+	return otherContent
+}
+
+// isSpecific rejects blank and generic media types, which say nothing about the content.
+func isSpecific(mediaType string) bool {
+	switch strings.ToLower(mediaType) {
+	case "", "*/*", "text/plain", "application/octet-stream", "binary/octet-stream", "application/x-download", "application/unknown":
+		return false
+	}
+	return true
+}
+
+// sniff gets the media type of the content from its first bytes, or blank if this is unknown
+// or generic. It reports whether the type came from the signature of a binary format.
+func sniff(prefix []byte) (string, bool) {
+	if len(prefix) == 0 {
+		return "", false
+	}
+
+	if kind, err := filetype.Match(prefix); err == nil && kind != types.Unknown {
+		return kind.MIME.Value, true
+	}
+
+	text := bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	text = bytes.TrimLeft(text, " \t\r\n")
+
+	if bytes.HasPrefix(text, []byte("#EXTM3U")) {
+		return "application/vnd.apple.mpegurl", false
+	}
+
+	switch firstElement(text) {
+	case "html":
+		return "text/html", false
+	case "svg":
+		return "image/svg+xml", false
+	case "rss":
+		return "application/rss+xml", false
+	case "feed":
+		return "application/atom+xml", false
+	case "mpd":
+		return "application/dash+xml", false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(prefix))
+	if !isSpecific(mediaType) {
+		return "", false
+	}
+	return mediaType, false
+}
+
+// firstElement gets the lower-case local name of the first element in a markup document,
+// skipping any XML declaration, processing instructions, comments and DOCTYPE.
+func firstElement(text []byte) string {
+	for {
+		text = bytes.TrimLeft(text, " \t\r\n")
+		switch {
+		case bytes.HasPrefix(text, []byte("<?")):
+			text = skipPast(text, "?>")
+		case bytes.HasPrefix(text, []byte("<!--")):
+			text = skipPast(text, "-->")
+		case bytes.HasPrefix(text, []byte("<!")):
+			text = skipPast(text, ">")
+		case bytes.HasPrefix(text, []byte("<")):
+			name := text[1:]
+			if end := bytes.IndexAny(name, " \t\r\n/>"); end >= 0 {
+				name = name[:end]
+			}
+			if _, local, found := bytes.Cut(name, []byte(":")); found {
+				name = local
+			}
+			return strings.ToLower(string(name))
+		default:
+			return ""
+		}
+	}
+}
+
+func skipPast(text []byte, end string) []byte {
+	if i := bytes.Index(text, []byte(end)); i >= 0 {
+		return text[i+len(end):]
+	}
+	return nil
+}
+
+// typeByExtension gets the media type implied by the file extension of a URL. Paths ending
+// with a slash are pages.
+func typeByExtension(u *url.URL) string {
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return "text/html"
+	}
+
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext == "" {
+		return ""
+	}
+
+	if mediaType, exists := extensionTypes[ext]; exists {
+		return mediaType
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return mediaType
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// peekBody gets the first part of the response body, decompressed if necessary, without
+// consuming it.
+func peekBody(resp *http.Response, encoding string) []byte {
+	br := bufio.NewReaderSize(resp.Body, 8*sniffLength)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{Reader: br, Closer: resp.Body}
+
+	if encoding == "" {
+		prefix, _ := br.Peek(sniffLength)
+		return prefix
+	}
+
+	compressed, _ := br.Peek(br.Size())
+	dr, err := decode(bytes.NewReader(compressed), encoding)
+	if err != nil {
+		return nil
+	}
+	defer dr.Close()
+
+	prefix := make([]byte, sniffLength)
+	n, _ := io.ReadFull(dr, prefix)
+	return prefix[:n]
+}
+
+// peekFile gets the first part of a file, if it exists, decompressing it if necessary.
+func peekFile(fs afero.Fs, filePath string) []byte {
+	f, err := ioutil.OpenStoredFile(fs, filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	prefix := make([]byte, sniffLength)
+	n, _ := io.ReadFull(f, prefix)
+	return prefix[:n]
+}
@@ -0,0 +1,78 @@
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestClassify(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	cases := []struct {
+		url, declared, prefix string
+		kind                  contentKind
+		mediaType             string
+	}{
+		// declared
+		{url: "http://x.org/a", declared: "text/html; charset=utf-8", prefix: "<p>hello", kind: htmlContent, mediaType: "text/html"},
+		{url: "http://x.org/a.css", declared: "text/css", prefix: "body {}", kind: cssContent, mediaType: "text/css"},
+		{url: "http://x.org/a.php", declared: "application/rss+xml", kind: feedContent, mediaType: "application/rss+xml"},
+		{url: "http://x.org/a.jpg", declared: "image/jpeg", prefix: string(png), kind: imageContent, mediaType: "image/jpeg"},
+		{url: "http://x.org/a.pdf", declared: "application/pdf", prefix: "%PDF-1.7", kind: otherContent, mediaType: "application/pdf"},
+
+		// declared but contradicted by a binary signature
+		{url: "http://x.org/a", declared: "text/html", prefix: string(png), kind: imageContent, mediaType: "image/png"},
+
+		// generic or missing declarations are sniffed
+		{url: "http://x.org/a", declared: "application/octet-stream", prefix: "<!DOCTYPE html>\n<html><head>", kind: htmlContent, mediaType: "text/html"},
+		{url: "http://x.org/a", declared: "text/plain; charset=shift_jis", prefix: "<html>", kind: htmlContent, mediaType: "text/html"},
+		{url: "http://x.org/a", prefix: `<?xml version="1.0"?><!-- x --><svg xmlns="http://www.w3.org/2000/svg">`, kind: svgContent, mediaType: "image/svg+xml"},
+		{url: "http://x.org/a", prefix: `<?xml version="1.0"?><rss version="2.0">`, kind: feedContent, mediaType: "application/rss+xml"},
+		{url: "http://x.org/a", prefix: `<feed xmlns="http://www.w3.org/2005/Atom">`, kind: feedContent, mediaType: "application/atom+xml"},
+		{url: "http://x.org/a", prefix: `<MPD xmlns="urn:mpeg:dash:schema:mpd:2011">`, kind: dashContent, mediaType: "application/dash+xml"},
+		{url: "http://x.org/a", prefix: "#EXTM3U\n#EXT-X-VERSION:3", kind: hlsContent, mediaType: "application/vnd.apple.mpegurl"},
+		{url: "http://x.org/a", prefix: string(png), kind: imageContent, mediaType: "image/png"},
+
+		// otherwise the extension decides
+		{url: "http://x.org/a.js", declared: "text/plain", prefix: "var a = 1;", kind: scriptContent, mediaType: "text/javascript"},
+		{url: "http://x.org/a.webmanifest", prefix: `{"name": "x"}`, kind: manifestContent, mediaType: "application/manifest+json"},
+		{url: "http://x.org/dir/", kind: htmlContent, mediaType: "text/html"},
+		{url: "http://x.org/a", kind: otherContent, mediaType: ""},
+	}
+
+	for i, c := range cases {
+		kind, ct := classify(mustParse(c.url), header.ParseContentType(c.declared), []byte(c.prefix))
+		expect.Number(kind).Info(i).ToBe(t, c.kind)
+		expect.String(ct.MediaType).Info(i).ToBe(t, c.mediaType)
+	}
+}
+
+func TestPeekBody_gzip(t *testing.T) {
+	page := "<html><body>" + string(bytes.Repeat([]byte("<p>Hello</p>"), 100)) + "</body></html>"
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, _ = gw.Write([]byte(page))
+	_ = gw.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://x.org/", nil)
+	resp := &http.Response{Request: req, Body: io.NopCloser(bytes.NewReader(buf.Bytes()))}
+
+	prefix := peekBody(resp, "gzip")
+	expect.String(string(prefix)).ToBe(t, page[:sniffLength])
+
+	// the body is still intact
+	_, data, err := bufferEntireResponse(resp, "gzip")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(data)).ToBe(t, page)
+}
@@ -12,9 +12,13 @@ import (
 	"github.com/rickb777/acceptable/headername"
 	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/download/ioutil"
 	"github.com/rickb777/goscrape2/download/throttle"
+	"github.com/rickb777/goscrape2/events"
+	"github.com/rickb777/goscrape2/filter"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/mapping"
+	"github.com/rickb777/goscrape2/stats"
 	"github.com/rickb777/goscrape2/utc"
 	"github.com/rickb777/goscrape2/work"
 	"github.com/spf13/afero"
@@ -36,6 +40,9 @@ type Download struct {
 
 	Lockdown  *throttle.Throttle // increases sharply when server gives 429 (Too Many Requests) responses, then resets
 	LoopDelay *throttle.Throttle // increases only slightly when server gives 429; never decreases
+
+	Stats  *stats.Stats  // may be nil
+	Events *events.Crawl // may be nil
 }
 
 func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *work.Result, error) {
@@ -44,15 +51,20 @@ func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *w
 	var existingModified time.Time
 
 	item.FilePath = mapping.GetFilePath(item.URL, false)
-	existingModified = modificationTime(d.Fs.Stat(item.FilePath))
+	existingModified = modificationTime(ioutil.StoredFileInfo(d.Fs, item.FilePath))
 
 	if existingModified.IsZero() {
 		item.FilePath = mapping.GetFilePath(item.URL, true)
-		existingModified = modificationTime(d.Fs.Stat(item.FilePath))
+		existingModified = modificationTime(ioutil.StoredFileInfo(d.Fs, item.FilePath))
 	}
 
 	item.StartTime = utc.Now()
 
+	if reason := d.stillRejected(metadata); reason != "" {
+		// no need for any HTTP traffic - report as 'teapot'
+		return item.URL, &work.Result{Item: item, StatusCode: http.StatusTeapot, Skipped: reason}, nil
+	}
+
 	resp, err := d.httpGet(ctx, item.URL, existingModified, metadata)
 	if err != nil {
 		return nil, nil, err
@@ -74,11 +86,13 @@ func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *w
 	switch resp.StatusCode {
 	case http.StatusOK:
 		// write the response body to a file, possibly modifying its hyperlinks
-		return d.response200(item, resp)
+		baseURL, result, err := d.response200(item, resp)
+		return baseURL, withLinkHeaders(result, resp), err
 
 	case http.StatusNotModified, http.StatusTeapot:
 		discardData(resp.Body) // discard anything present
-		return d.response304(item, resp)
+		baseURL, result, err := d.response304(item, resp)
+		return baseURL, withLinkHeaders(result, resp), err
 
 	case http.StatusNotFound:
 		discardData(resp.Body) // discard anything present
@@ -105,22 +119,78 @@ func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *w
 
 //-------------------------------------------------------------------------------------------------
 
-// responseGone deletes obsolete/inaccessible files
+// withLinkHeaders adds the references found in HTTP Link headers to a result.
+func withLinkHeaders(result *work.Result, resp *http.Response) *work.Result {
+	if result == nil {
+		return nil
+	}
+
+	for _, ref := range linkHeaderReferences(resp) {
+		result.References = append(result.References, ref)
+		if _, exists := result.Links[ref.String()]; !exists {
+			if result.Links == nil {
+				result.Links = make(map[string]work.Link)
+			}
+			result.Links[ref.String()] = work.Link{Source: "Link header"}
+		}
+	}
+
+	return result
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// responseGone deletes obsolete/inaccessible files, except in spider mode or if a rule says
+// the URL should not be saved, when the files are left alone.
 func (d *Download) responseGone(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+	if d.Config.Spider || d.Config.Rules.Action(item.URL) == filter.NoSave {
+		return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
+	}
+
 	filePath := mapping.GetFilePath(item.URL, true)
 	_ = d.Fs.Remove(filePath)
+	if mapping.IsCompressible(filePath) {
+		_ = d.Fs.Remove(mapping.GzipFilePath(filePath))
+	}
 	return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
 
+// rejectedDrainLimit is the most of a rejected response body that is read, so that the
+// connection can be reused if the rest is small, without reading a large body to the end.
+const rejectedDrainLimit = 64 << 10
+
+// responseRejected abandons a response that the response filter rejects. This is recorded so
+// that the URL is skipped in later runs, for as long as the filter would still reject it. It is
+// reported in the same way as in those runs.
+func (d *Download) responseRejected(item work.Item, resp *http.Response, metadata db.Item, reason string) (*url.URL, *work.Result, error) {
+	_, _ = io.CopyN(io.Discard, resp.Body, rejectedDrainLimit)
+	d.ETagsDB.Store(item.URL, metadata)
+	return item.URL, &work.Result{Item: item, StatusCode: http.StatusTeapot, Skipped: reason}, nil
+}
+
+// stillRejected gets the reason why a response that was rejected in a previous run would be
+// rejected again, or blank if the URL should be fetched.
+func (d *Download) stillRejected(metadata db.Item) string {
+	switch metadata.Code {
+	case http.StatusRequestEntityTooLarge:
+		return d.Config.Responses.RejectsSize(metadata.Size)
+	case http.StatusUnsupportedMediaType:
+		return d.Config.Responses.RejectsType(metadata.Classified().MediaType)
+	}
+	return ""
+}
+
+//-------------------------------------------------------------------------------------------------
+
 // responseRedirect handles redirection
 func (d *Download) responseRedirect(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	location := resp.Header.Get(headername.Location)
 
 	locURL, err := url.Parse(location)
 	if err != nil {
-		logger.Error("Parse location header failed",
+		logger.Download.Error("Parse location header failed",
 			slog.Any("url", item.URL),
 			slog.Int("code", resp.StatusCode),
 			slog.String("location", location),
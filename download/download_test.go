@@ -1,14 +1,23 @@
 package download
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"github.com/rickb777/expect"
 	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/download/ioutil"
+	"github.com/rickb777/goscrape2/filter"
+	"github.com/rickb777/goscrape2/mapping"
 	"github.com/rickb777/goscrape2/stubclient"
 	"github.com/rickb777/goscrape2/work"
 	"github.com/spf13/afero"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestProcessURL_200_HTML(t *testing.T) {
@@ -50,6 +59,117 @@ func TestProcessURL_200_HTML(t *testing.T) {
 		mustParse("https://example.org/page2/pix/photo.jpg"))
 }
 
+func TestProcessURL_200_HTML_legacyCharset(t *testing.T) {
+	page := "<html><head><title>Caf\xe9</title></head><body><a href=\"/menu.html\">Cr\xe8me br\xfbl\xe9e</a></body></html>"
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/cafe.html", "text/html; charset=ISO-8859-1", page)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/cafe.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/menu.html"))
+
+	saved, err := afero.ReadFile(fs, "cafe.html")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToBe(t, `<html><head><meta charset="utf-8"/><title>Café</title></head><body><a href="menu.html">Crème brûlée</a></body></html>`)
+}
+
+func TestProcessURL_200_HTML_streamed(t *testing.T) {
+	defer func(n int64) { htmlStreamingThreshold = n }(htmlStreamingThreshold)
+	htmlStreamingThreshold = 64
+
+	page := `<!DOCTYPE html>
+<HTML><head><meta charset="utf-8"></head>
+<body>
+<a href="https://example.org/">Home</a>
+<img src="pix/photo.jpg">
+</body></HTML>
+`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/page2/", "text/html", page)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/page2/")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Number(result.ContentLength).ToBe(t, int64(len(page)))
+	expect.Slice(result.References).ToHaveLength(t, 2)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/"),
+		mustParse("https://example.org/page2/pix/photo.jpg"))
+	expect.Any(result.Links["https://example.org/"]).ToBe(t, work.Link{Text: "Home", Source: "a href"})
+
+	saved, err := afero.ReadFile(fs, "page2/index.html")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToBe(t, strings.Replace(page, `"https://example.org/"`, `"../"`, 1))
+}
+
+func TestProcessURL_200_HTML_sniffed(t *testing.T) {
+	page := `<!DOCTYPE html><html><body><a href="https://example.org/contact">Contact</a></body></html>`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/about", "application/octet-stream", page)
+
+	fs := afero.NewMemMapFs()
+	store := db.OpenDB("/state", fs)
+	d := &Download{
+		ETagsDB:  store,
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/about")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.String(result.ContentType).ToBe(t, "text/html")
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/contact"))
+
+	// the declared type is stored as it is, apart from the sniffed type
+	metadata := store.Lookup(mustParse("https://example.org/about"))
+	expect.String(metadata.Content.MediaType).ToBe(t, "application/octet-stream")
+	expect.String(metadata.Sniffed.MediaType).ToBe(t, "text/html")
+
+	saved, err := afero.ReadFile(fs, "about.html")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToContain(t, `<a href="contact">Contact</a>`)
+}
+
+func TestProcessURL_304_HTML_extensionless(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusNotModified, "https://example.org/about", "", "")
+
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "about.html", []byte(`<html><body><a href="contact.html">Contact</a></body></html>`), 0644)
+
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/about")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusNotModified)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/contact.html"))
+}
+
 func TestProcessURL_200_CSS(t *testing.T) {
 	sample := `
 			div#d1 { background: url(/doc/gopher.png) no-repeat; height: 155px; }
@@ -78,3 +198,507 @@ func TestProcessURL_200_CSS(t *testing.T) {
 		mustParse("https://example.org/doc/gopher.png"),
 		mustParse("https://example.org/sub/food/cheese.png"))
 }
+
+func TestProcessURL_200_SVG(t *testing.T) {
+	sample := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <use xlink:href="/img/sprites.svg#icon"/>
+  <image href="photo.png"/>
+</svg>`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/sub/logo.svg", "image/svg+xml", sample)
+
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "sub/logo.svg", []byte("stale"), 0644) // replaced by the newer copy
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/sub/logo.svg")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToHaveLength(t, 2)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/img/sprites.svg"),
+		mustParse("https://example.org/sub/photo.png"))
+
+	saved, err := afero.ReadFile(fs, "sub/logo.svg")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToContain(t, `xlink:href="../img/sprites.svg#icon"`)
+}
+
+func TestProcessURL_200_JavaScript(t *testing.T) {
+	sample := `const logo = "https://example.org/img/logo.png"; load("./chunk.js");`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/js/app.js", "text/javascript", sample)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Scripts: config.ScriptsRewritten},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/js/app.js")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToHaveLength(t, 2)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/img/logo.png"),
+		mustParse("https://example.org/js/chunk.js"))
+
+	saved, err := afero.ReadFile(fs, "js/app.js")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToBe(t, `const logo = "/img/logo.png"; load("./chunk.js");`)
+}
+
+func TestProcessURL_200_HLS(t *testing.T) {
+	sample := "#EXTM3U\n#EXT-X-MAP:URI=\"/video/init.mp4\"\n#EXTINF:4,\nseg1.m4s\n#EXT-X-ENDLIST\n"
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/video/index.m3u8", "application/vnd.apple.mpegurl", sample)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/video/index.m3u8")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToHaveLength(t, 2)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/video/init.mp4"),
+		mustParse("https://example.org/video/seg1.m4s"))
+
+	saved, err := afero.ReadFile(fs, "video/index.m3u8")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToBe(t, "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\nseg1.m4s\n#EXT-X-ENDLIST\n")
+}
+
+const sampleFeed = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<title>Blog</title>
+<link>https://example.org/blog/</link>
+<item><link>https://example.org/blog/new.html</link><pubDate>Tue, 02 Jan 2024 10:00:00 GMT</pubDate></item>
+<item><link>https://example.org/blog/old.html</link><pubDate>Mon, 01 Jan 2024 10:00:00 GMT</pubDate></item>
+</channel>
+</rss>`
+
+func TestProcessURL_200_Feed(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/blog/index.rss", "application/rss+xml", sampleFeed)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/blog/index.rss")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToHaveLength(t, 3)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/blog/"),
+		mustParse("https://example.org/blog/new.html"),
+		mustParse("https://example.org/blog/old.html"))
+
+	saved, err := afero.ReadFile(fs, "blog/index.rss")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToContain(t, "<link>new.html</link>")
+	expect.String(string(saved)).ToContain(t, "<link>./</link>")
+}
+
+func TestProcessURL_200_Feed_update(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/blog/index.rss", "application/rss+xml", sampleFeed)
+
+	feedURL := mustParse("https://example.org/blog/index.rss")
+
+	fs := afero.NewMemMapFs()
+	etags := db.OpenDB("/state", fs)
+	etags.Store(feedURL, db.Item{Code: http.StatusOK, Latest: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)})
+
+	d := &Download{
+		Config:   config.Config{FeedUpdate: true},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		ETagsDB:  etags,
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: feedURL})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/blog/new.html"))
+	expect.Any(result.FeedLatest).ToBe(t, time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+
+	// the newest entry is only stored once it has been fetched
+	expect.Any(etags.Lookup(feedURL).Latest).ToBe(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+}
+
+func TestProcessURL_200_WebManifest(t *testing.T) {
+	sample := `{"name": "App", "icons": [{"src": "/icons/192.png", "sizes": "192x192"}, {"src": "icons/512.png"}]}`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/app/manifest.webmanifest", "application/manifest+json", sample)
+	stub.GivenHeader("https://example.org/app/manifest.webmanifest", "Link", `</css/app.css>; rel=preload; as=style, </app/>; rel=start`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/app/manifest.webmanifest")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToHaveLength(t, 3)
+	expect.Slice(result.References).ToContainAll(t,
+		mustParse("https://example.org/icons/192.png"),
+		mustParse("https://example.org/app/icons/512.png"),
+		mustParse("https://example.org/css/app.css"))
+
+	saved, err := afero.ReadFile(fs, "app/manifest.webmanifest")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToBe(t, `{"name": "App", "icons": [{"src": "../icons/192.png", "sizes": "192x192"}, {"src": "icons/512.png"}]}`)
+}
+
+func TestProcessURL_200_WebManifest_json(t *testing.T) {
+	sample := `{"name": "App", "icons": [{"src": "/icons/192.png", "sizes": "192x192"}]}`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/app/manifest.json", "application/json", sample)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	// referenced by <link rel="manifest">, so processed even though scripts are ignored
+	item := work.Item{URL: mustParse("https://example.org/app/manifest.json"), Manifest: true}
+	_, result, err := d.ProcessURL(context.Background(), item)
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/icons/192.png"))
+}
+
+func TestProcessURL_200_HTML_gzipOnly(t *testing.T) {
+	page := `<html><body><a href="/about.html">About</a></body></html>`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", page)
+
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "index.html", []byte("stale"), 0644)
+
+	d := &Download{
+		Config:   config.Config{Compression: mapping.CompressionOnly},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/about.html"))
+
+	expect.Bool(ioutil.FileExists(fs, "index.html")).ToBe(t, false)
+	saved, err := ioutil.ReadStoredFile(fs, "index.html")
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(saved)).ToContain(t, `<a href="about.html">About</a>`)
+}
+
+func TestProcessURL_200_CSS_gzipBoth(t *testing.T) {
+	sample := `body { background: url("/pix/bg.png"); }`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/style.css", "text/css", sample)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Compression: mapping.CompressionBoth},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/style.css")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+
+	plain, err := afero.ReadFile(fs, "style.css")
+	expect.Error(err).ToBeNil(t)
+
+	compressed, err := afero.ReadFile(fs, "style.css.gz")
+	expect.Error(err).ToBeNil(t)
+	gr, err := gzip.NewReader(bytes.NewReader(compressed))
+	expect.Error(err).ToBeNil(t)
+	decompressed, err := io.ReadAll(gr)
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(decompressed)).ToBe(t, string(plain))
+	expect.Number(result.FileSize).ToBe(t, int64(len(plain)+len(compressed)))
+}
+
+func TestProcessURL_304_HTML_gzipOnly(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusNotModified, "https://example.org/about.html", "", "")
+
+	fs := afero.NewMemMapFs()
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, _ = gw.Write([]byte(`<html><body><a href="contact.html">Contact</a></body></html>`))
+	_ = gw.Close()
+	_ = afero.WriteFile(fs, "about.html.gz", buf.Bytes(), 0644)
+
+	d := &Download{
+		Config:   config.Config{Compression: mapping.CompressionOnly},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/about.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusNotModified)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/contact.html"))
+}
+
+func TestProcessURL_200_rejected_declaredSize(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/big.zip", "application/zip", strings.Repeat("x", 2000))
+
+	fs := afero.NewMemMapFs()
+	store := db.OpenDB("/state", fs)
+
+	d := &Download{
+		Config:   config.Config{Responses: filter.ResponseFilter{MaxSize: 1000}},
+		ETagsDB:  store,
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	base, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Any(base).ToBe(t, mustParse("https://example.org/big.zip"))
+	expect.Number(result.StatusCode).ToBe(t, http.StatusTeapot)
+	expect.String(result.Skipped).ToBe(t, "size 2000 exceeds the maximum 1000")
+	expect.Bool(ioutil.FileExists(fs, "big.zip")).ToBe(t, false)
+
+	metadata := store.Lookup(mustParse("https://example.org/big.zip"))
+	expect.Number(metadata.Code).ToBe(t, http.StatusRequestEntityTooLarge)
+	expect.Number(metadata.Size).ToBe(t, 2000)
+
+	// the next run doesn't fetch it again, and reports it in the same way
+	base, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Any(base).ToBe(t, mustParse("https://example.org/big.zip"))
+	expect.Number(result.StatusCode).ToBe(t, http.StatusTeapot)
+	expect.String(result.Skipped).ToBe(t, "size 2000 exceeds the maximum 1000")
+
+	// unless the limit is raised
+	d.Config.Responses.MaxSize = 5000
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.String(result.Skipped).ToBe(t, "")
+	expect.Bool(ioutil.FileExists(fs, "big.zip")).ToBe(t, true)
+}
+
+func TestProcessURL_200_rejected_drained(t *testing.T) {
+	body := bytes.NewReader(make([]byte, 100000))
+	client := clientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{Request: req, StatusCode: http.StatusOK, ContentLength: int64(body.Len()),
+			Header: http.Header{"Content-Type": []string{"application/zip"}}, Body: io.NopCloser(body)}, nil
+	})
+
+	d := &Download{
+		Config:   config.Config{Responses: filter.ResponseFilter{MaxSize: 1000}},
+		Client:   client,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       afero.NewMemMapFs(),
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusTeapot)
+	expect.Number(body.Len()).ToBe(t, 100000-rejectedDrainLimit) // not read to the end
+}
+
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestProcessURL_200_rejected_streamedSize(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/big.bin", "application/octet-stream", strings.Repeat("x", 100000))
+	stub.GivenUnknownLength("https://example.org/big.bin")
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Responses: filter.ResponseFilter{MaxSize: 50000}},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.bin")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(result.Skipped).ToContain(t, "exceeds the maximum 50000")
+
+	// no partial file is left behind
+	files, _ := afero.ReadDir(fs, ".")
+	expect.Slice(files).ToBeEmpty(t)
+}
+
+func TestProcessURL_200_rejected_contentType(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/film", "video/mp4", "....ftypisom")
+
+	fs := afero.NewMemMapFs()
+	store := db.OpenDB("/state", fs)
+
+	d := &Download{
+		Config:   config.Config{Responses: filter.ResponseFilter{ExcludeTypes: []string{"video/*"}}},
+		ETagsDB:  store,
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/film")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusTeapot)
+	expect.String(result.Skipped).ToBe(t, "content type video/mp4 is excluded by video/*")
+	expect.Bool(ioutil.FileExists(fs, "film")).ToBe(t, false)
+	expect.Number(store.Lookup(mustParse("https://example.org/film")).Code).ToBe(t, http.StatusUnsupportedMediaType)
+}
+
+func TestProcessURL_200_HTML_noSave(t *testing.T) {
+	page := `<html><body><a href="/result/1.html">1</a></body></html>`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/search.html", "text/html", page)
+
+	rule, err := filter.ParseRule("nosave glob:/search.html")
+	expect.Error(err).ToBeNil(t)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Rules: filter.Rules{rule}},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/search.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/result/1.html"))
+	expect.Bool(ioutil.FileExists(fs, "search.html")).ToBe(t, false)
+}
+
+func TestProcessURL_200_spider(t *testing.T) {
+	page := `<html><body><a href="/big.zip">1</a></body></html>`
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/index.html", "text/html", page)
+	stub.GivenResponse(http.StatusOK, "https://example.org/big.zip", "application/zip", strings.Repeat("z", 10000))
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Spider: true},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/index.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.String(result.ContentType).ToBe(t, "text/html")
+	expect.Slice(result.References).ToBe(t, mustParse("https://example.org/big.zip"))
+	expect.Bool(ioutil.FileExists(fs, "index.html")).ToBe(t, false)
+
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip"), Depth: 1})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusOK)
+	expect.String(result.ContentType).ToBe(t, "application/zip")
+	expect.Number(result.ContentLength).ToBe(t, 0)
+	expect.Number(result.Unread).ToBe(t, 10000)
+	expect.Bool(ioutil.FileExists(fs, "big.zip")).ToBe(t, false)
+
+	stub.GivenUnknownLength("https://example.org/big.zip")
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/big.zip"), Depth: 1})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.ContentLength).ToBe(t, 0)
+	expect.Number(result.Unread).ToBe(t, -1)
+}
+
+func TestProcessURL_410_spider(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusGone, "https://example.org/old.html", "text/html", "")
+
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "old.html", []byte("<html></html>"), 0644)
+	_ = afero.WriteFile(fs, "old.html.gz", []byte("compressed"), 0644)
+
+	d := &Download{
+		Config:   config.Config{Spider: true},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/old.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Number(result.StatusCode).ToBe(t, http.StatusGone)
+
+	// the mirror is never touched in spider mode
+	expect.Bool(ioutil.FileExists(fs, "old.html")).ToBe(t, true)
+	expect.Bool(ioutil.FileExists(fs, "old.html.gz")).ToBe(t, true)
+
+	// nor if a rule says the URL should not be saved
+	rule, err := filter.ParseRule("nosave glob:/old.html")
+	expect.Error(err).ToBeNil(t)
+	d.Config = config.Config{Rules: filter.Rules{rule}}
+	_, _, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/old.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(ioutil.FileExists(fs, "old.html")).ToBe(t, true)
+
+	d.Config = config.Config{}
+	_, _, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/old.html")})
+
+	expect.Error(err).ToBeNil(t)
+	expect.Bool(ioutil.FileExists(fs, "old.html")).ToBe(t, false)
+	expect.Bool(ioutil.FileExists(fs, "old.html.gz")).ToBe(t, false)
+}
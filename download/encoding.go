@@ -0,0 +1,145 @@
+package download
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Decoder wraps a reader of content in a particular Content-Encoding with a reader of the
+// decoded content.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+type registeredDecoder struct {
+	name    string
+	decoder Decoder
+}
+
+// decoders lists the supported content codings in order of preference.
+var decoders = []registeredDecoder{
+	{name: "gzip", decoder: gzipDecoder},
+	{name: "deflate", decoder: deflateDecoder},
+	{name: "br", decoder: brotliDecoder},
+}
+
+// RegisterDecoder adds support for a content coding, or replaces the decoder for one that is
+// already supported. This must be done before any downloads start.
+func RegisterDecoder(name string, decoder Decoder) {
+	name = strings.ToLower(name)
+	for i, d := range decoders {
+		if d.name == name {
+			decoders[i].decoder = decoder
+			return
+		}
+	}
+	decoders = append(decoders, registeredDecoder{name: name, decoder: decoder})
+}
+
+// acceptEncoding gets the Accept-Encoding request header value listing the registered decoders.
+func acceptEncoding() string {
+	names := make([]string, len(decoders))
+	for i, d := range decoders {
+		names[i] = d.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func findDecoder(name string) Decoder {
+	for _, d := range decoders {
+		if d.name == name {
+			return d.decoder
+		}
+	}
+	return nil
+}
+
+// contentEncoding gets the normalised Content-Encoding of a response, which is blank if the
+// content is not encoded. When several codings were applied, they are listed in the order
+// they were applied.
+func contentEncoding(h http.Header) string {
+	var codings []string
+	for _, value := range h.Values(headername.ContentEncoding) {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return strings.Join(codings, ",")
+}
+
+// decode wraps a reader with the decoders for the content codings, undoing them in the
+// reverse of the order they were applied. Closing the result closes the decoders but not r.
+func decode(r io.Reader, encoding string) (io.ReadCloser, error) {
+	decoded := &decodedReader{Reader: r}
+	if encoding == "" {
+		return decoded, nil
+	}
+
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoder := findDecoder(codings[i])
+		if decoder == nil {
+			decoded.Close()
+			return nil, fmt.Errorf("unsupported content encoding %q", codings[i])
+		}
+
+		rc, err := decoder(decoded.Reader)
+		if err != nil {
+			decoded.Close()
+			return nil, fmt.Errorf("decoding %s: %w", codings[i], err)
+		}
+		decoded.Reader = rc
+		decoded.closers = append(decoded.closers, rc)
+	}
+
+	return decoded, nil
+}
+
+type decodedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decodedReader) Close() error {
+	var errs []error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		errs = append(errs, r.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func gzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// deflateDecoder handles the zlib format, as required for the deflate content coding, and
+// also raw deflate data, which some servers send instead.
+func deflateDecoder(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// isZlibHeader checks for the deflate compression method and the header checksum (RFC-1950).
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+func brotliDecoder(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
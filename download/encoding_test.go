@@ -0,0 +1,94 @@
+package download
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/rickb777/expect"
+)
+
+const encodingSample = "<html><body><p>Hello, world! Hello, world! Hello, world!</p></body></html>"
+
+func TestDecode(t *testing.T) {
+	cases := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	for encoding, newWriter := range cases {
+		encoded := encodeWith(newWriter, []byte(encodingSample))
+
+		r, err := decode(bytes.NewReader(encoded), encoding)
+		expect.Error(err).Info(encoding).ToBeNil(t)
+
+		decoded, err := io.ReadAll(r)
+		expect.Error(err).Info(encoding).ToBeNil(t)
+		expect.String(string(decoded)).Info(encoding).ToBe(t, encodingSample)
+		expect.Error(r.Close()).Info(encoding).ToBeNil(t)
+	}
+}
+
+func TestDecode_raw_deflate(t *testing.T) {
+	encoded := encodeWith(func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}, []byte(encodingSample))
+
+	r, err := decode(bytes.NewReader(encoded), "deflate")
+	expect.Error(err).ToBeNil(t)
+
+	decoded, err := io.ReadAll(r)
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(decoded)).ToBe(t, encodingSample)
+}
+
+func TestDecode_stacked(t *testing.T) {
+	// gzip was applied first, then br
+	gzipped := encodeWith(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, []byte(encodingSample))
+	encoded := encodeWith(func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }, gzipped)
+
+	h := http.Header{}
+	h.Set("Content-Encoding", "GZIP, identity, br")
+	encoding := contentEncoding(h)
+	expect.String(encoding).ToBe(t, "gzip,br")
+
+	r, err := decode(bytes.NewReader(encoded), encoding)
+	expect.Error(err).ToBeNil(t)
+
+	decoded, err := io.ReadAll(r)
+	expect.Error(err).ToBeNil(t)
+	expect.String(string(decoded)).ToBe(t, encodingSample)
+}
+
+func TestDecode_unsupported(t *testing.T) {
+	_, err := decode(strings.NewReader("abc"), "compress")
+	expect.Error(err).ToContain(t, `unsupported content encoding "compress"`)
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	saved := decoders
+	defer func() { decoders = saved }()
+	decoders = append([]registeredDecoder{}, decoders...)
+
+	RegisterDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil })
+	expect.String(acceptEncoding()).ToBe(t, "gzip, deflate, br, zstd")
+
+	RegisterDecoder("BR", func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil })
+	expect.String(acceptEncoding()).ToBe(t, "gzip, deflate, br, zstd")
+}
+
+func encodeWith(newWriter func(w io.Writer) io.WriteCloser, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	w := newWriter(buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
@@ -13,13 +13,11 @@ import (
 	"github.com/rickb777/acceptable/header"
 	"github.com/rickb777/acceptable/headername"
 	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/events"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/utc"
 )
 
-// Counters accumulates HTTP response status codes.
-var Counters = NewHistogram()
-
 // httpGet performs one HTTP 'get' request, with as many retries as needed, up to the
 // configured limit.
 //
@@ -55,7 +53,7 @@ func (d *Download) httpGet(ctx context.Context, u *url.URL, lastModified time.Ti
 		}
 	}
 
-	req.Header.Set(headername.AcceptEncoding, "gzip")
+	req.Header.Set(headername.AcceptEncoding, acceptEncoding())
 
 	if d.Config.UserAgent != "" {
 		req.Header.Set(headername.UserAgent, d.Config.UserAgent)
@@ -92,7 +90,7 @@ func (d *Download) doHttpGet(req *http.Request) (resp *http.Response, err error)
 			return nil, err
 		}
 
-		Counters.Increment(resp.StatusCode)
+		d.Stats.AddResponse(resp.StatusCode)
 
 		args := []any{slog.String("url", req.URL.String()), slog.Int("status", resp.StatusCode)}
 		args = addHeaderValue(args, resp.Header, headername.ContentType)
@@ -100,12 +98,14 @@ func (d *Download) doHttpGet(req *http.Request) (resp *http.Response, err error)
 		args = addHeaderValue(args, resp.Header, headername.LastModified)
 		args = addHeaderValue(args, resp.Header, headername.ContentEncoding)
 		args = addHeaderValue(args, resp.Header, headername.Vary)
-		logger.Debug(http.MethodGet, args...)
+		logger.Download.Debug(http.MethodGet, args...)
 
 		switch {
 		// 1xx status codes are never returned
 
 		case resp.StatusCode == http.StatusTooManyRequests:
+			d.Stats.AddThrottle()
+			d.Events.Retried(events.Retried{URL: req.URL.String(), Status: resp.StatusCode, Attempt: i + 1})
 			d.Lockdown.SlowDown()  // back off request rate whilst we're being throttled by the server
 			d.LoopDelay.SlowDown() // never return to the original speed
 			return resp, nil       // this URL will be re-tried later
@@ -138,7 +138,9 @@ func (d *Download) doHttpGet(req *http.Request) (resp *http.Response, err error)
 		}
 
 		if i+1 < tries {
-			logger.Warn(http.StatusText(resp.StatusCode),
+			d.Stats.AddRetry()
+			d.Events.Retried(events.Retried{URL: req.URL.String(), Status: resp.StatusCode, Attempt: i + 1})
+			logger.Download.Warn(http.StatusText(resp.StatusCode),
 				slog.String("url", req.URL.String()),
 				slog.Int("code", resp.StatusCode))
 		}
@@ -151,7 +153,7 @@ func (d *Download) doHttpGet(req *http.Request) (resp *http.Response, err error)
 
 func closeResponseBody(c io.Closer, u *url.URL) {
 	if err := c.Close(); err != nil {
-		logger.Error("Closing HTTP response body failed",
+		logger.Download.Error("Closing HTTP response body failed",
 			slog.Any("url", u),
 			slog.Any("error", err))
 	}
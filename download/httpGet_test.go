@@ -14,6 +14,7 @@ import (
 	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/db"
 	"github.com/rickb777/goscrape2/download/throttle"
+	"github.com/rickb777/goscrape2/stats"
 	"github.com/rickb777/goscrape2/stubclient"
 	"github.com/rickb777/goscrape2/utc"
 	"github.com/spf13/afero"
@@ -38,7 +39,7 @@ func TestGet200(t *testing.T) {
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusOK)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "Foo/Bar")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "Sat, 01 Jan 2000 01:01:01 UTC")
 	expect.String(resp.Request.Header.Get("X-Extra")).ToBe(t, "Hello")
@@ -62,7 +63,7 @@ func TestGet404(t *testing.T) {
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusNotFound)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "Foo/Bar")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "Sat, 01 Jan 2000 01:01:01 UTC")
 }
@@ -78,6 +79,7 @@ func TestGet429(t *testing.T) {
 		Client:   stub,
 		Auth:     "credentials",
 		Lockdown: throttle.New(0, 10, 10),
+		Stats:    stats.New(mustParse("http://example.org/")),
 	}
 
 	lastModified := time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)
@@ -86,10 +88,12 @@ func TestGet429(t *testing.T) {
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusTooManyRequests)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "Foo/Bar")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "Sat, 01 Jan 2000 01:01:01 UTC")
 	expect.Bool(d.Lockdown.IsNormal()).ToBeFalse(t)
+	expect.Number(d.Stats.Summary().Throttled).ToBe(t, 1)
+	expect.Map(d.Stats.Summary().Statuses).ToBe(t, map[int]int{429: 1})
 }
 
 func TestGet200RevalidateWhenExpired(t *testing.T) {
@@ -115,7 +119,7 @@ func TestGet200RevalidateWhenExpired(t *testing.T) {
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusOK)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "Foo/Bar")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "Sat, 01 Jan 2000 01:01:01 UTC")
 	expect.String(resp.Request.Header.Get("X-Extra")).ToBe(t, "Hello")
@@ -145,7 +149,7 @@ func TestGet200RevalidateWhenLaxIsNegative(t *testing.T) {
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusOK)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "Foo/Bar")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "Sat, 01 Jan 2000 01:01:01 UTC")
 	expect.String(resp.Request.Header.Get("X-Extra")).ToBe(t, "Hello")
@@ -219,16 +223,19 @@ func TestGet500(t *testing.T) {
 			Tries: 2,
 		},
 		Client: stub,
+		Stats:  stats.New(mustParse("http://example.org/")),
 	}
 
 	resp, err := d.httpGet(context.Background(), mustParse("http://example.org/"), time.Time{}, db.Item{})
 
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).ToBe(t, http.StatusInternalServerError)
-	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip")
+	expect.String(resp.Request.Header.Get(headername.AcceptEncoding)).ToBe(t, "gzip, deflate, br")
 	expect.String(resp.Request.Header.Get(headername.UserAgent)).ToBe(t, "")
 	expect.String(resp.Request.Header.Get(headername.IfModifiedSince)).ToBe(t, "")
 	expect.String(resp.Request.Header.Get("X-Extra")).ToBe(t, "")
+	expect.Number(d.Stats.Summary().Retries).ToBe(t, 1)
+	expect.Map(d.Stats.Summary().Statuses).ToBe(t, map[int]int{500: 2})
 }
 
 func mustParse(s string) *url.URL {
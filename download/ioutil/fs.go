@@ -2,6 +2,7 @@ package ioutil
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 
 	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/mapping"
 	"github.com/spf13/afero"
 )
 
@@ -20,7 +22,7 @@ func CreateDirectory(fs afero.Fs, path string) error {
 		return nil
 	}
 
-	logger.Debug("Creating dir", slog.String("path", path))
+	logger.Download.Debug("Creating dir", slog.String("path", path))
 	if err := fs.MkdirAll(path, os.ModePerm); err != nil {
 		return fmt.Errorf("creating directory '%s': %w", path, err)
 	}
@@ -34,7 +36,7 @@ func WriteFileAtomically(fs afero.Fs, filePath string, data io.Reader) (int64, e
 		return 0, err
 	}
 
-	logger.Debug("Creating file", slog.String("path", filePath))
+	logger.Download.Debug("Creating file", slog.String("path", filePath))
 
 	// writing the file may take much time, so write to a temporary file first
 	temporaryName := dir + randomName()
@@ -79,6 +81,61 @@ func ReadFile(fs afero.Fs, filePath string) ([]byte, error) {
 	return data.Bytes(), nil
 }
 
+// OpenStoredFile opens a downloaded file for reading. If the file itself is absent but it is
+// stored gzip-compressed instead, the compressed copy is opened and decompressed.
+func OpenStoredFile(fs afero.Fs, filePath string) (io.ReadCloser, error) {
+	f, err := fs.Open(filePath)
+	if err == nil || !os.IsNotExist(err) || !mapping.IsCompressible(filePath) {
+		return f, err
+	}
+
+	gf, gzErr := fs.Open(mapping.GzipFilePath(filePath))
+	if gzErr != nil {
+		return nil, err // report the original file as missing
+	}
+
+	gr, err := gzip.NewReader(gf)
+	if err != nil {
+		_ = gf.Close()
+		return nil, fmt.Errorf("decompressing file '%s': %w", mapping.GzipFilePath(filePath), err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{Reader: gr, Closer: gf}, nil
+}
+
+// ReadStoredFile reads a downloaded file, which might be stored gzip-compressed.
+func ReadStoredFile(fs afero.Fs, filePath string) ([]byte, error) {
+	f, err := OpenStoredFile(fs, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file '%s': %w", filePath, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading from file '%s': %w", filePath, err)
+	}
+
+	return data, nil
+}
+
+// StoredFileInfo gets information about a downloaded file, or its gzip-compressed copy if only
+// that exists.
+func StoredFileInfo(fs afero.Fs, filePath string) (os.FileInfo, error) {
+	fi, err := fs.Stat(filePath)
+	if err == nil || !os.IsNotExist(err) || !mapping.IsCompressible(filePath) {
+		return fi, err
+	}
+
+	if gfi, gzErr := fs.Stat(mapping.GzipFilePath(filePath)); gzErr == nil {
+		return gfi, nil
+	}
+	return nil, err
+}
+
 func FileExists(fs afero.Fs, filePath string) bool {
 	_, err := fs.Stat(filePath)
 	return !os.IsNotExist(err)
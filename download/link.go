@@ -0,0 +1,91 @@
+package download
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// linkHeaderRels lists the relations in HTTP Link headers that refer to resources needed by
+// the response, as opposed to other pages.
+var linkHeaderRels = []string{"preload", "modulepreload", "stylesheet"}
+
+// linkHeaderReferences gets the URLs from the HTTP Link headers (RFC-8288) of a response that
+// have one of the linkHeaderRels relations. They are resolved relative to the request URL.
+func linkHeaderReferences(resp *http.Response) work.Refs {
+	var refs work.Refs
+
+	for _, value := range resp.Header.Values("Link") {
+		for _, link := range parseLinkHeader(value) {
+			if !slices.ContainsFunc(strings.Fields(link.rel), func(rel string) bool {
+				return slices.Contains(linkHeaderRels, strings.ToLower(rel))
+			}) {
+				continue
+			}
+
+			u, err := resp.Request.URL.Parse(link.target)
+			if err != nil {
+				logger.Download.Error("Parsing Link header URL failed",
+					slog.String("url", link.target),
+					slog.Any("error", err))
+				continue
+			}
+
+			u.Fragment = ""
+			refs = append(refs, u)
+		}
+	}
+
+	return refs
+}
+
+type linkValue struct {
+	target string
+	rel    string
+}
+
+// parseLinkHeader splits a Link header into its comma-separated links, each of the form
+// `<target>; param=value; param="quoted value"`. Only the rel parameter is kept.
+func parseLinkHeader(header string) []linkValue {
+	var links []linkValue
+
+	for {
+		open := strings.IndexByte(header, '<')
+		if open < 0 {
+			return links
+		}
+		closing := strings.IndexByte(header[open:], '>')
+		if closing < 0 {
+			return links
+		}
+
+		link := linkValue{target: strings.TrimSpace(header[open+1 : open+closing])}
+		header = header[open+closing+1:]
+
+		// the parameters run up to the next comma that is not within quotes
+		end := len(header)
+		quoted := false
+		for i := 0; i < len(header); i++ {
+			if header[i] == '"' {
+				quoted = !quoted
+			} else if header[i] == ',' && !quoted {
+				end = i
+				break
+			}
+		}
+
+		for _, param := range strings.Split(header[:end], ";") {
+			name, value, found := strings.Cut(param, "=")
+			if found && strings.EqualFold(strings.TrimSpace(name), "rel") {
+				link.rel = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+
+		links = append(links, link)
+		header = header[end:]
+	}
+}
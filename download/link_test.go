@@ -0,0 +1,16 @@
+package download
+
+import (
+	"testing"
+
+	"github.com/rickb777/expect"
+)
+
+func Test_parseLinkHeader(t *testing.T) {
+	links := parseLinkHeader(`<https://example.org/a,b.css>; rel="preload stylesheet"; title="x, y", </font.woff2>;as=font;REL=preload,<next>`)
+
+	expect.Slice(links).ToBe(t,
+		linkValue{target: "https://example.org/a,b.css", rel: "preload stylesheet"},
+		linkValue{target: "/font.woff2", rel: "preload"},
+		linkValue{target: "next"})
+}
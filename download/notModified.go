@@ -6,9 +6,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"path"
-	"strings"
 
+	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/document"
 	"github.com/rickb777/goscrape2/download/ioutil"
 	"github.com/rickb777/goscrape2/logger"
@@ -17,18 +16,35 @@ import (
 )
 
 func (d *Download) response304(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
-	ext := strings.ToLower(path.Ext(item.URL.Path))
+	metadata := d.ETagsDB.Lookup(item.URL)
+	kind, contentType := classify(item.URL, metadata.Content, peekFile(d.Fs, item.FilePath))
+	kind = asReferenced(item, kind, contentType)
 
-	switch ext {
-	case ".html", ".htm":
+	switch kind {
+	case htmlContent:
 		return d.html304(item, resp)
 
-	case ".css":
+	case cssContent:
 		return d.css304(item, resp.StatusCode)
 
-	default:
-		if strings.HasSuffix(item.URL.Path, "/") {
-			return d.html304(item, resp)
+	case svgContent:
+		return d.svg304(item, resp.StatusCode)
+
+	case feedContent:
+		return d.feed304(item, resp.StatusCode)
+
+	case manifestContent:
+		return d.manifest304(item, resp.StatusCode)
+
+	case hlsContent:
+		return d.hls304(item, resp.StatusCode)
+
+	case dashContent:
+		return d.dash304(item, resp.StatusCode)
+
+	case scriptContent:
+		if d.Config.Scripts != config.ScriptsIgnored {
+			return d.script304(item, resp.StatusCode)
 		}
 	}
 
@@ -44,9 +60,9 @@ func (d *Download) html304(item work.Item, resp *http.Response) (*url.URL, *work
 	var references work.Refs
 
 	filePath := mapping.GetFilePath(item.URL, true)
-	data, err := ioutil.ReadFile(d.Fs, filePath)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
 	if err != nil {
-		logger.Debug("absent HTML file", slog.Any("error", err))
+		logger.Download.Debug("absent HTML file", slog.Any("error", err))
 		return nil, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
 	}
 
@@ -55,6 +71,8 @@ func (d *Download) html304(item work.Item, resp *http.Response) (*url.URL, *work
 		return nil, nil, fmt.Errorf("parsing HTML: %w", err)
 	}
 
+	doc.ScanScripts(d.Config.Scripts)
+
 	references, err = doc.FindReferences()
 	if err != nil {
 		return nil, nil, err
@@ -62,7 +80,7 @@ func (d *Download) html304(item work.Item, resp *http.Response) (*url.URL, *work
 
 	// use the URL that the website returned as new base url for the
 	// scrape, in case a redirect changed it (only for the start page)
-	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, References: references}, nil
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, References: references, Links: doc.Links()}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -71,9 +89,9 @@ func (d *Download) html304(item work.Item, resp *http.Response) (*url.URL, *work
 func (d *Download) css304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
 	var references work.Refs
 	filePath := mapping.GetFilePath(item.URL, false)
-	data, err := ioutil.ReadFile(d.Fs, filePath)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
 	if err != nil {
-		logger.Debug("absent CSS file", slog.Any("error", err))
+		logger.Download.Debug("absent CSS file", slog.Any("error", err))
 		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
 	}
 
@@ -81,3 +99,125 @@ func (d *Download) css304(item work.Item, statusCode int) (*url.URL, *work.Resul
 
 	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
 }
+
+//-------------------------------------------------------------------------------------------------
+
+// svg304 reads the SVG file from disk so that all the URLs it references can be scraped
+func (d *Download) svg304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent SVG file", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	doc, err := document.ParseSVG(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing SVG: %w", err)
+	}
+
+	references, err := doc.FindReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// script304 reads the JavaScript or JSON file from disk so that all the URLs it references can be scraped
+func (d *Download) script304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	var references work.Refs
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent script file", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	_, references = document.CheckScriptForUrls(item.URL, d.StartURL.Host, data, config.ScriptsScanned)
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// feed304 reads the RSS or Atom feed from disk so that all the URLs it references can be scraped
+func (d *Download) feed304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent feed file", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	doc, err := document.ParseFeed(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing feed: %w", err)
+	}
+
+	// an unchanged feed has no new entries, unless fetching them failed in a previous run
+	seen := d.ETagsDB.Lookup(item.URL).Latest
+	references := d.feedReferences(doc, seen)
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references, FeedLatest: newerThan(doc.Latest(), seen)}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// manifest304 reads the web app manifest from disk so that all the URLs it references can be scraped
+func (d *Download) manifest304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	var references work.Refs
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent web app manifest", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	_, references = document.CheckManifestForUrls(item.URL, d.StartURL.Host, data)
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// hls304 reads the HLS playlist from disk so that all the URLs it references can be scraped
+func (d *Download) hls304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	var references work.Refs
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent HLS playlist", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	_, references = document.CheckHLSForUrls(item.URL, d.StartURL.Host, data)
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// dash304 reads the DASH manifest from disk so that all the URLs it references can be scraped
+func (d *Download) dash304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+	filePath := mapping.GetFilePath(item.URL, false)
+	data, err := ioutil.ReadStoredFile(d.Fs, filePath)
+	if err != nil {
+		logger.Download.Debug("absent DASH manifest", slog.Any("error", err))
+		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
+	}
+
+	doc, err := document.ParseDASH(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing DASH: %w", err)
+	}
+
+	references, err := doc.FindReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
+}
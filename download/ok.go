@@ -3,71 +3,174 @@ package download
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/rickb777/acceptable/header"
 	"github.com/rickb777/acceptable/headername"
+	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/db"
 	"github.com/rickb777/goscrape2/document"
 	"github.com/rickb777/goscrape2/download/ioutil"
+	"github.com/rickb777/goscrape2/events"
+	"github.com/rickb777/goscrape2/filter"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/mapping"
 	"github.com/rickb777/goscrape2/work"
 )
 
 func (d *Download) response200(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
-	contentType := header.ParseContentTypeFromHeaders(resp.Header)
 	lastModified, _ := header.ParseHTTPDateTime(resp.Header.Get(headername.LastModified))
-	isGzip := resp.Header.Get(headername.ContentEncoding) == "gzip"
+	encoding := contentEncoding(resp.Header)
 
-	metadata := db.Item{Code: resp.StatusCode, Content: contentType, ETags: resp.Header.Get(headername.ETag)}
+	declared := header.ParseContentTypeFromHeaders(resp.Header)
+
+	// the declared size is checked before any of the body is read
+	if reason := d.Config.Responses.RejectsSize(resp.ContentLength); reason != "" {
+		rejected := db.Item{Code: http.StatusRequestEntityTooLarge, Content: declared, Size: resp.ContentLength}
+		return d.responseRejected(item, resp, rejected, reason)
+	}
+
+	// the actual size is checked while the body is read, in case it was not declared
+	var limiter *sizeLimiter
+	if d.Config.Responses.MaxSize > 0 {
+		limiter = &sizeLimiter{r: resp.Body, max: d.Config.Responses.MaxSize}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{Reader: limiter, Closer: resp.Body}
+	}
+
+	kind, contentType := classify(item.URL, declared, peekBody(resp, encoding))
+	kind = asReferenced(item, kind, contentType)
+	sniffed := sniffedType(declared, contentType)
+
+	if reason := d.Config.Responses.RejectsType(contentType.MediaType); reason != "" {
+		return d.responseRejected(item, resp, db.Item{Code: http.StatusUnsupportedMediaType, Content: declared, Sniffed: sniffed}, reason)
+	}
+
+	if d.Config.Spider && kind != htmlContent && kind != cssContent {
+		// only the pages and stylesheets are needed for discovering links; the rest of the
+		// body is not read, so the connection is dropped instead of being reused. Its declared
+		// length is kept for the listing, but not counted as transferred.
+		return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentType: contentType.MediaType, Unread: resp.ContentLength, Encoding: encoding}, nil
+	}
+
+	metadata := db.Item{Code: resp.StatusCode, Content: declared, Sniffed: sniffed, ETags: resp.Header.Get(headername.ETag)}
 	if expires := resp.Header.Get(headername.Expires); expires != "" {
 		metadata.Expires, _ = header.ParseHTTPDateTime(expires)
 	}
 
+	// remember the newest feed entry seen in previous runs
+	metadata.Latest = d.ETagsDB.Lookup(item.URL).Latest
+
 	d.ETagsDB.Store(item.URL, metadata)
 
-	switch {
-	case isHtml(contentType) || isXHtml(contentType):
-		return d.html200(item, resp, lastModified, contentType, isGzip)
+	baseURL, result, err := d.contentByKind(item, resp, kind, lastModified, contentType, metadata, encoding)
+	if result != nil {
+		result.ContentType = contentType.MediaType
+	}
+
+	if limiter != nil && limiter.exceeded {
+		// any partial file has been discarded already
+		rejected := db.Item{Code: http.StatusRequestEntityTooLarge, Content: declared, Sniffed: sniffed, Size: limiter.n}
+		return d.responseRejected(item, resp, rejected, d.Config.Responses.RejectsSize(limiter.n))
+	}
+
+	return baseURL, result, err
+}
 
-	case isCSS(contentType):
-		return d.css200(item, resp, lastModified, isGzip)
+// contentByKind writes the response body to a file, processing it according to its kind.
+func (d *Download) contentByKind(item work.Item, resp *http.Response, kind contentKind, lastModified time.Time, contentType header.ContentType, metadata db.Item, encoding string) (*url.URL, *work.Result, error) {
+	switch kind {
+	case htmlContent:
+		return d.html200(item, resp, lastModified, contentType, encoding)
 
-	//case isSVG(contentType):
-	//	return d.svg200(item, resp, lastModified, isGzip)
+	case cssContent:
+		return d.css200(item, resp, lastModified, encoding)
 
-	case contentType.Type() == "image" && d.Config.ImageQuality != 0:
-		return d.image200(item, resp, lastModified, contentType, isGzip)
+	case svgContent:
+		return d.svg200(item, resp, lastModified, encoding)
 
-	default:
-		return d.other200(item, resp, lastModified, isGzip)
+	case feedContent:
+		return d.feed200(item, resp, lastModified, metadata, encoding)
+
+	case manifestContent:
+		return d.manifest200(item, resp, lastModified, encoding)
+
+	case hlsContent:
+		return d.hls200(item, resp, lastModified, encoding)
+
+	case dashContent:
+		return d.dash200(item, resp, lastModified, encoding)
+
+	case scriptContent:
+		if d.Config.Scripts != config.ScriptsIgnored {
+			return d.script200(item, resp, lastModified, encoding)
+		}
+
+	case imageContent:
+		if d.Config.ImageQuality != 0 {
+			return d.image200(item, resp, lastModified, contentType, encoding)
+		}
 	}
+
+	return d.other200(item, resp, lastModified, encoding)
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) html200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
-	var references work.Refs
+// htmlStreamingThreshold is the size above which HTML documents are relinked as a stream
+// instead of being parsed into memory as a whole.
+var htmlStreamingThreshold int64 = 4 << 20
 
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
+func (d *Download) html200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, encoding string) (*url.URL, *work.Result, error) {
+	counter, body, err := decodedBody(resp, encoding)
 	if err != nil {
-		return nil, nil, fmt.Errorf("buffering %s: %w", contentType.String(), err)
+		return nil, nil, err
+	}
+	defer body.Close()
+
+	// read up to the threshold; most documents are smaller and go no further
+	buf := &bytes.Buffer{}
+	n, err := io.CopyN(buf, body, htmlStreamingThreshold+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("%s reading response body: %w", resp.Request.URL, err)
+	}
+
+	if n > htmlStreamingThreshold && document.CanStreamHTML(buf.Bytes(), contentType.String()) {
+		return d.htmlStream(item, resp, lastModified, io.MultiReader(buf, body), counter, encoding)
+	}
+
+	if _, err := io.Copy(buf, body); err != nil {
+		return nil, nil, fmt.Errorf("%s reading response body: %w", resp.Request.URL, err)
 	}
 
-	doc, err := document.ParseHTML(item.URL, d.StartURL, bytes.NewReader(data))
+	return d.htmlDOM(item, resp, lastModified, contentType, buf.Bytes(), counter.n, encoding)
+}
+
+// htmlDOM parses the whole document so that it can be relinked.
+func (d *Download) htmlDOM(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, data []byte, contentLength int64, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	doc, err := document.ParseHTMLWithContentType(item.URL, d.StartURL, bytes.NewReader(data), contentType.String())
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s: %w", contentType.String(), err)
 	}
 
+	doc.ScanScripts(d.Config.Scripts)
+
 	fixed, hasChanges, err := doc.FixURLReferences()
 	if err != nil {
-		logger.Error("Fixing file references failed",
+		logger.Download.Error("Fixing file references failed",
 			slog.String("url", item.String()),
 			slog.Any("error", err))
 		return nil, nil, nil
@@ -86,54 +189,85 @@ func (d *Download) html200(item work.Item, resp *http.Response, lastModified tim
 
 	// use the URL that the website returned as new base url for the
 	// scrape, in case a redirect changed it (only for the start page)
-	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Gzip: isGzip, References: references}, nil
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references, Links: doc.Links()}, nil
+}
+
+// htmlStream relinks the document while it is being written to its file.
+func (d *Download) htmlStream(item work.Item, resp *http.Response, lastModified time.Time, body io.Reader, counter *countingReader, encoding string) (*url.URL, *work.Result, error) {
+	type streamed struct {
+		references work.Refs
+		links      map[string]work.Link
+		err        error
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan streamed, 1)
+
+	go func() {
+		references, links, err := document.StreamHTML(item.URL, d.StartURL, body, pw, d.Config.Scripts)
+		_ = pw.CloseWithError(err)
+		done <- streamed{references: references, links: links, err: err}
+	}()
+
+	fileSize := d.storeFile(item.URL, mapping.GetFilePath(item.URL, true), pr, lastModified)
+	_ = pr.Close() // stops the goroutine if writing the file failed
+
+	result := <-done
+	if result.err != nil {
+		return nil, nil, fmt.Errorf("streaming HTML: %w", result.err)
+	}
+
+	logger.Download.Debug("HTML streamed", slog.String("url", item.String()), slog.Int64("size", fileSize))
+
+	// use the URL that the website returned as new base url for the
+	// scrape, in case a redirect changed it (only for the start page)
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Encoding: encoding, References: result.references, Links: result.links}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
 
-//func (d *Download) svg200(item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
-//	var references work.Refs
-//
-//	data, err := bufferEntireResponse(resp, isGzip)
-//	if err != nil {
-//		return nil, nil, fmt.Errorf("buffering SVG: %w", err)
-//	}
-//
-//	doc, err := document.ParseSVG(item.URL, d.StartURL, bytes.NewReader(data))
-//	if err != nil {
-//		return nil, nil, fmt.Errorf("SVG: %w", err)
-//	}
-//
-//	fixed, hasChanges, err := doc.FixURLReferences()
-//	if err != nil {
-//		logger.Error("Fixing file references failed",
-//			slog.String("url", item.String()),
-//			slog.Any("error", err))
-//		return nil, nil, nil
-//	}
-//
-//	if hasChanges {
-//		data = fixed
-//	}
-//	rdr := bytes.NewReader(data)
-//	d.storeDownload(item.URL, rdr, lastModified, true)
-//
-//	references, err = doc.FindReferences()
-//	if err != nil {
-//		return nil, nil, err
-//	}
-//
-//	// use the URL that the website returned as new base url for the
-//	// scrape, in case a redirect changed it (only for the start page)
-//	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, References: references}, nil
-//}
+func (d *Download) svg200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering SVG: %w", err)
+	}
+
+	doc, err := document.ParseSVG(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("SVG: %w", err)
+	}
+
+	fixed, hasChanges, err := doc.FixURLReferences()
+	if err != nil {
+		logger.Download.Error("Fixing file references failed",
+			slog.String("url", item.String()),
+			slog.Any("error", err))
+		return nil, nil, nil
+	}
+
+	if hasChanges {
+		data = fixed
+	}
+
+	// like pages, SVG documents are relinked, so any previous copy is replaced
+	fileSize := d.storeFile(item.URL, mapping.GetFilePath(item.URL, false), bytes.NewReader(data), lastModified)
+
+	references, err = doc.FindReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
+}
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) css200(item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
+func (d *Download) css200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
 	var references work.Refs
 
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
 	if err != nil {
 		return nil, nil, fmt.Errorf("buffering text/css: %w", err)
 	}
@@ -142,13 +276,152 @@ func (d *Download) css200(item work.Item, resp *http.Response, lastModified time
 
 	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Gzip: isGzip, References: references}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (d *Download) feed200(item work.Item, resp *http.Response, lastModified time.Time, metadata db.Item, encoding string) (*url.URL, *work.Result, error) {
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering feed: %w", err)
+	}
+
+	doc, err := document.ParseFeed(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("feed: %w", err)
+	}
+
+	fixed, hasChanges, err := doc.FixURLReferences()
+	if err != nil {
+		logger.Download.Error("Fixing file references failed",
+			slog.String("url", item.String()),
+			slog.Any("error", err))
+		return nil, nil, nil
+	}
+
+	if hasChanges {
+		data = fixed
+	}
+
+	// feeds change over time, so any previous copy is always replaced
+	fileSize := d.storeFile(item.URL, mapping.GetFilePath(item.URL, false), bytes.NewReader(data), lastModified)
+
+	references := d.feedReferences(doc, metadata.Latest)
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references, FeedLatest: newerThan(doc.Latest(), metadata.Latest)}, nil
+}
+
+// newerThan gets the latest time if it is after the time seen previously, or zero otherwise.
+func newerThan(latest, seen time.Time) time.Time {
+	if latest.After(seen) {
+		return latest
+	}
+	return time.Time{}
+}
+
+// feedReferences gets all the references in a feed, or, in feed-driven update mode, only
+// those of the entries that are newer than the ones seen previously.
+func (d *Download) feedReferences(doc *document.FeedDocument, seen time.Time) work.Refs {
+	if d.Config.FeedUpdate {
+		return doc.ReferencesSince(seen)
+	}
+
+	references, _ := doc.FindReferences()
+	return references
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (d *Download) manifest200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering web app manifest: %w", err)
+	}
+
+	data, references = document.CheckManifestForUrls(item.URL, d.StartURL.Host, data)
+
+	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (d *Download) hls200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering HLS playlist: %w", err)
+	}
+
+	data, references = document.CheckHLSForUrls(item.URL, d.StartURL.Host, data)
+
+	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (d *Download) dash200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering DASH manifest: %w", err)
+	}
+
+	doc, err := document.ParseDASH(item.URL, d.StartURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("DASH: %w", err)
+	}
+
+	fixed, hasChanges, err := doc.FixURLReferences()
+	if err != nil {
+		logger.Download.Error("Fixing file references failed",
+			slog.String("url", item.String()),
+			slog.Any("error", err))
+		return nil, nil, nil
+	}
+
+	if hasChanges {
+		data = fixed
+	}
+	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+
+	references, err = doc.FindReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) image200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
+func (d *Download) script200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	var references work.Refs
+
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buffering script: %w", err)
+	}
+
+	data, references = document.CheckScriptForUrls(item.URL, d.StartURL.Host, data, d.Config.Scripts)
+
+	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Encoding: encoding, References: references}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (d *Download) image200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, encoding string) (*url.URL, *work.Result, error) {
+	contentLength, data, err := bufferEntireResponse(resp, encoding)
 	if err != nil {
 		return nil, nil, fmt.Errorf("buffering %s: %w", contentType.String(), err)
 	}
@@ -160,31 +433,22 @@ func (d *Download) image200(item work.Item, resp *http.Response, lastModified ti
 
 	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Gzip: isGzip, FileSize: fileSize}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Encoding: encoding, FileSize: fileSize}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) other200(item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
-	counter := &countingReader{r: resp.Body}
-	var rdr io.Reader = counter
-
-	if isGzip {
-		gr, err := gzip.NewReader(rdr)
-		if err != nil {
-			logger.Error("Decompressing gzip response failed",
-				slog.Any("url", resp.Request.URL),
-				slog.Any("error", err))
-			return nil, nil, err
-		}
-		defer gr.Close() // this only closes the gzipper, not the response body
-		rdr = gr
+func (d *Download) other200(item work.Item, resp *http.Response, lastModified time.Time, encoding string) (*url.URL, *work.Result, error) {
+	counter, body, err := decodedBody(resp, encoding)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer body.Close()
 
 	// store without buffering entire file into memory
-	fileSize := d.storeDownload(item.URL, rdr, lastModified, false)
+	fileSize := d.storeDownload(item.URL, body, lastModified, false)
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Gzip: isGzip}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Encoding: encoding}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -194,22 +458,72 @@ func (d *Download) other200(item work.Item, resp *http.Response, lastModified ti
 func (d *Download) storeDownload(u *url.URL, data io.Reader, lastModified time.Time, isAPage bool) (fileSize int64) {
 	filePath := mapping.GetFilePath(u, isAPage)
 
-	if !isAPage && ioutil.FileExists(d.Fs, filePath) {
+	if !isAPage {
+		if _, err := ioutil.StoredFileInfo(d.Fs, filePath); !os.IsNotExist(err) {
+			return 0
+		}
+	}
+
+	return d.storeFile(u, filePath, data, lastModified)
+}
+
+// storeFile writes the download to a file, replacing any existing file. Compressible files
+// are also, or instead, stored gzip-compressed, depending on the configuration. Nothing is
+// written in spider mode or if a rule says the URL should not be saved. The file size is the
+// total size of the files written.
+func (d *Download) storeFile(u *url.URL, filePath string, data io.Reader, lastModified time.Time) (fileSize int64) {
+	if d.Config.Spider || d.Config.Rules.Action(u) == filter.NoSave {
+		discardData(data) // the data may be streamed
 		return 0
 	}
 
+	if d.Config.Compression == mapping.CompressionOff || !mapping.IsCompressible(filePath) {
+		return d.writeFile(u, filePath, data, lastModified)
+	}
+
+	gzipPath := mapping.GzipFilePath(filePath)
+
+	if d.Config.Compression == mapping.CompressionOnly {
+		compressed := gzipped(data)
+		fileSize = d.writeFile(u, gzipPath, compressed, lastModified)
+		_ = compressed.Close()    // stops the compressor if writing the file failed
+		_ = d.Fs.Remove(filePath) // any uncompressed copy from a previous run is obsolete
+		return fileSize
+	}
+
+	fileSize = d.writeFile(u, filePath, data, lastModified)
+
+	f, err := d.Fs.Open(filePath)
+	if err != nil {
+		return fileSize // already reported
+	}
+	defer f.Close()
+
+	compressed := gzipped(f)
+	fileSize += d.writeFile(u, gzipPath, compressed, lastModified)
+	_ = compressed.Close()
+
+	return fileSize
+}
+
+// writeFile writes data to a file, replacing any existing file.
+func (d *Download) writeFile(u *url.URL, filePath string, data io.Reader, lastModified time.Time) (fileSize int64) {
 	var err error
 	if fileSize, err = ioutil.WriteFileAtomically(d.Fs, filePath, data); err != nil {
-		logger.Error("Writing to file failed",
-			slog.String("URL", u.String()),
-			slog.String("file", filePath),
-			slog.Any("error", err))
+		if !errors.Is(err, errTooLarge) { // otherwise, this is reported as skipped
+			logger.Download.Error("Writing to file failed",
+				slog.String("URL", u.String()),
+				slog.String("file", filePath),
+				slog.Any("error", err))
+		}
 		return fileSize
 	}
 
+	d.Events.Written(events.Written{URL: u.String(), File: filepath.Clean(filePath), Size: fileSize})
+
 	if !lastModified.IsZero() {
 		if err := d.Fs.Chtimes(filePath, lastModified, lastModified); err != nil {
-			logger.Error("Updating file timestamps failed",
+			logger.Download.Error("Updating file timestamps failed",
 				slog.String("URL", u.String()),
 				slog.String("file", filePath),
 				slog.Any("error", err))
@@ -219,32 +533,56 @@ func (d *Download) storeDownload(u *url.URL, data io.Reader, lastModified time.T
 	return fileSize
 }
 
-//-------------------------------------------------------------------------------------------------
-
-func bufferEntireResponse(resp *http.Response, isGzip bool) (int64, []byte, error) {
-	counter := &countingReader{r: resp.Body}
-	var rdr io.Reader = counter
+// gzipped compresses the data as it is read.
+func gzipped(data io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
 
-	if isGzip {
-		gr, err := gzip.NewReader(rdr)
-		if err != nil {
-			logger.Error("Decompressing gzip response failed",
-				slog.Any("url", resp.Request.URL),
-				slog.Any("error", err))
-			return 0, nil, err
+	go func() {
+		gw, _ := gzip.NewWriterLevel(pw, gzip.BestCompression)
+		_, err := io.Copy(gw, data)
+		if err == nil {
+			err = gw.Close()
 		}
-		defer gr.Close() // this only closes the gzipper, not the response body
-		rdr = gr
+		_ = pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func bufferEntireResponse(resp *http.Response, encoding string) (int64, []byte, error) {
+	counter, body, err := decodedBody(resp, encoding)
+	if err != nil {
+		return 0, nil, err
 	}
+	defer body.Close()
 
 	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, rdr); err != nil {
+	if _, err := io.Copy(buf, body); err != nil {
 		return 0, nil, fmt.Errorf("%s reading response body: %w", resp.Request.URL, err)
 	}
 
 	return counter.n, buf.Bytes(), nil
 }
 
+// decodedBody gets the response body, decoding it if necessary. The counter tallies the
+// bytes received. Closing the body only closes the decoders, not the response body.
+func decodedBody(resp *http.Response, encoding string) (*countingReader, io.ReadCloser, error) {
+	counter := &countingReader{r: resp.Body}
+
+	body, err := decode(counter, encoding)
+	if err != nil {
+		logger.Download.Error("Decoding response failed",
+			slog.Any("url", resp.Request.URL),
+			slog.String("encoding", encoding),
+			slog.Any("error", err))
+		return nil, nil, err
+	}
+
+	return counter, body, nil
+}
+
 //-------------------------------------------------------------------------------------------------
 
 type countingReader struct {
@@ -258,6 +596,27 @@ func (r *countingReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
+// errTooLarge is the error when a response exceeds the maximum size.
+var errTooLarge = errors.New("maximum size exceeded")
+
+// sizeLimiter fails reading when more than the maximum number of bytes have been read.
+type sizeLimiter struct {
+	r        io.Reader
+	n        int64
+	max      int64
+	exceeded bool
+}
+
+func (r *sizeLimiter) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		r.exceeded = true
+		return n, errTooLarge
+	}
+	return n, err
+}
+
 //-------------------------------------------------------------------------------------------------
 
 func isHtml(contentType header.ContentType) bool {
@@ -275,3 +634,39 @@ func isCSS(contentType header.ContentType) bool {
 func isSVG(contentType header.ContentType) bool {
 	return contentType.MediaType == "image/svg+xml"
 }
+
+func isFeed(contentType header.ContentType) bool {
+	switch contentType.MediaType {
+	case "application/rss+xml", "application/atom+xml":
+		return true
+	}
+	return false
+}
+
+func isWebManifest(contentType header.ContentType) bool {
+	return contentType.MediaType == "application/manifest+json"
+}
+
+func isHLS(contentType header.ContentType) bool {
+	switch strings.ToLower(contentType.MediaType) {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return true
+	}
+	return false
+}
+
+func isDASH(contentType header.ContentType) bool {
+	return contentType.MediaType == "application/dash+xml"
+}
+
+func isJavaScript(contentType header.ContentType) bool {
+	switch contentType.MediaType {
+	case "application/javascript", "text/javascript", "application/x-javascript", "application/ecmascript", "text/ecmascript":
+		return true
+	}
+	return false
+}
+
+func isJSON(contentType header.ContentType) bool {
+	return contentType.MediaType == "application/json"
+}
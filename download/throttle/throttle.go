@@ -1,8 +1,11 @@
 package throttle
 
 import (
+	"log/slog"
 	"sync/atomic"
 	"time"
+
+	"github.com/rickb777/goscrape2/logger"
 )
 
 // Throttle is a delay timer with a [Sleep] method for pausing loops. It is controlled
@@ -15,6 +18,7 @@ type Throttle struct {
 	min     int64
 	initial int64
 	extra   int64
+	name    string
 }
 
 // New returns a new Throttle with the minimum, initial and extra values specified.
@@ -41,13 +45,31 @@ func New(minimum, initialStep, extraStep time.Duration) *Throttle {
 	return t
 }
 
+// Named sets the name used when changes to the delay are logged.
+func (t *Throttle) Named(name string) *Throttle {
+	if t != nil {
+		t.name = name
+	}
+	return t
+}
+
+func (t *Throttle) logChange(from, to int64) {
+	if from != to {
+		logger.Throttle.Debug("Delay changed", slog.String("throttle", t.name),
+			slog.Duration("from", time.Duration(from)), slog.Duration("to", time.Duration(to)))
+	}
+}
+
 // SlowDown increases the pause imposed when [Sleep] is called. The first time this is used,
 // the throttle increases its delay to the initial step. Subsequently, it adds the extra step.
 // This provides a linear back-off (n.b. not exponential).
 func (t *Throttle) SlowDown() {
 	if t != nil {
-		if !t.delay.CompareAndSwap(t.min, t.initial) {
-			t.delay.Add(t.extra)
+		if t.delay.CompareAndSwap(t.min, t.initial) {
+			t.logChange(t.min, t.initial)
+		} else {
+			d := t.delay.Add(t.extra)
+			t.logChange(d-t.extra, d)
 		}
 	}
 }
@@ -62,7 +84,9 @@ func (t *Throttle) SpeedUp() {
 			if newValue < t.min {
 				newValue = t.min
 			}
-			t.delay.CompareAndSwap(d, newValue)
+			if t.delay.CompareAndSwap(d, newValue) {
+				t.logChange(d, newValue)
+			}
 		}
 	}
 }
@@ -70,7 +94,7 @@ func (t *Throttle) SpeedUp() {
 // Reset reverts the loop delay to its minimum value.
 func (t *Throttle) Reset() {
 	if t != nil {
-		t.delay.Store(t.min)
+		t.logChange(t.delay.Swap(t.min), t.min)
 	}
 }
 
@@ -0,0 +1,52 @@
+package envfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/envfile"
+)
+
+func TestRead(t *testing.T) {
+	vars, err := envfile.Read(strings.NewReader(`
+# Environment file for Goscrape
+GOSCRAPE_URLS="https://example.org/ https://example.com/"
+
+; a comment
+GOSCRAPE_INCLUDE='/file/ /static/'
+GOSCRAPE_HEADERS="X-Token: \"abc\"|Accept-Language: en"
+  GOSCRAPE_LOOPDELAY = 250ms
+EMPTY=
+`))
+
+	expect.Error(err).Not().ToHaveOccurred(t)
+	expect.Map(vars).ToBe(t, map[string]string{
+		"GOSCRAPE_URLS":      "https://example.org/ https://example.com/",
+		"GOSCRAPE_INCLUDE":   "/file/ /static/",
+		"GOSCRAPE_HEADERS":   `X-Token: "abc"|Accept-Language: en`,
+		"GOSCRAPE_LOOPDELAY": "250ms",
+		"EMPTY":              "",
+	})
+}
+
+func TestRead_errors(t *testing.T) {
+	_, err := envfile.Read(strings.NewReader("A=1\nnot an assignment\n"))
+	expect.Error(err).ToContain(t, "line 2: expected KEY=VALUE")
+
+	_, err = envfile.Read(strings.NewReader(`A="1`))
+	expect.Error(err).ToContain(t, "line 1: unterminated quote")
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goscrape.conf")
+	expect.Error(os.WriteFile(path, []byte("GOSCRAPE_URLS=\"https://example.org/\"\nbad\n"), 0o644)).Not().ToHaveOccurred(t)
+
+	_, err := envfile.ReadFile(path)
+	expect.Error(err).ToContain(t, "goscrape.conf: line 2: expected KEY=VALUE")
+
+	_, err = envfile.ReadFile(path + ".missing")
+	expect.Error(err).ToHaveOccurred(t)
+}
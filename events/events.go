@@ -0,0 +1,101 @@
+// Package events defines the crawl event stream, which has one JSON object per line.
+//
+// The stream is versioned: within a version, fields may be added to the events, and new
+// types of event may be added, but existing fields are neither removed nor changed in
+// meaning. Consumers should ignore anything they don't recognise.
+package events
+
+import (
+	"time"
+)
+
+// Version is the version of the event stream, which is in every event.
+const Version = 1
+
+// The types of event.
+const (
+	TypeCrawlStarted  = "crawl.started"
+	TypeQueued        = "url.queued"
+	TypeFetched       = "url.fetched"
+	TypeSkipped       = "url.skipped"
+	TypeRetried       = "url.retried"
+	TypeWritten       = "file.written"
+	TypeCrawlFinished = "crawl.finished"
+)
+
+// Event is any of the events in the stream.
+type Event interface {
+	header() *Header
+}
+
+// Header holds the fields that are common to all events. They are filled in when the event
+// is emitted.
+type Header struct {
+	Version int       `json:"v"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Crawl   string    `json:"crawl"` // the start URL of the crawl
+}
+
+func (h *Header) header() *Header {
+	return h
+}
+
+// CrawlStarted is emitted when the crawl from a start URL begins.
+type CrawlStarted struct {
+	Header
+}
+
+// Queued is emitted when a URL is queued for fetching.
+type Queued struct {
+	Header
+	URL      string `json:"url"`
+	Referrer string `json:"referrer,omitempty"` // blank for start pages
+	Depth    int    `json:"depth"`
+}
+
+// Fetched is emitted when a response has been received and processed.
+type Fetched struct {
+	Header
+	URL         string    `json:"url"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"contentType,omitempty"`
+	Size        int64     `json:"size"`               // the number of bytes transferred
+	FileSize    int64     `json:"fileSize,omitempty"` // the number of bytes stored
+	Depth       int       `json:"depth"`
+	Started     time.Time `json:"started"`
+	Seconds     float64   `json:"seconds"` // the time taken, including processing
+}
+
+// Skipped is emitted when a URL is not fetched, or its response is abandoned.
+type Skipped struct {
+	Header
+	URL      string `json:"url"`
+	Referrer string `json:"referrer,omitempty"`
+	Reason   string `json:"reason"`           // a short name, e.g. "excluded" or "offhost"
+	Detail   string `json:"detail,omitempty"` // e.g. the rule that matched
+}
+
+// Retried is emitted when a request will be sent again, because of a server error or
+// because the server asked for requests to be slowed down.
+type Retried struct {
+	Header
+	URL     string `json:"url"`
+	Status  int    `json:"status"`
+	Attempt int    `json:"attempt"` // the attempt that failed, counting from 1
+}
+
+// Written is emitted when a file has been written to disk.
+type Written struct {
+	Header
+	URL  string `json:"url"`
+	File string `json:"file"` // relative to the directory for the host
+	Size int64  `json:"size"`
+}
+
+// CrawlFinished is emitted when the crawl from a start URL ends.
+type CrawlFinished struct {
+	Header
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"` // set if the crawl ended early
+}
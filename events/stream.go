@@ -0,0 +1,167 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/utc"
+)
+
+// writeTimeout limits how long a consumer can hold up the crawl when it stops reading.
+const writeTimeout = 5 * time.Second
+
+// deadliner is implemented by sockets and pipes, but not by regular files.
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// Stream writes events as JSON lines. It is safe for concurrent use. If it is nil, its
+// methods are no-ops.
+type Stream struct {
+	closer   io.Closer
+	deadline deadliner
+	timeout  time.Duration
+	enc      *json.Encoder
+	failed   bool
+	mu       sync.Mutex
+}
+
+// NewStream creates a stream that writes to w. If w supports write deadlines, each write
+// fails when it takes longer than a few seconds.
+func NewStream(w io.Writer) *Stream {
+	s := &Stream{enc: json.NewEncoder(w), timeout: writeTimeout}
+	s.deadline, _ = w.(deadliner)
+	return s
+}
+
+// Open opens a stream to a path. If the path is a Unix domain socket, the stream connects
+// to it; otherwise the file is opened for appending, creating it if necessary, which also
+// suits named pipes.
+func Open(path string) (*Stream, error) {
+	var (
+		w   io.WriteCloser
+		err error
+	)
+
+	if info, statErr := os.Stat(path); statErr == nil && info.Mode()&os.ModeSocket != 0 {
+		w, err = net.Dial("unix", path)
+	} else {
+		w, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewStream(w)
+	s.closer = w
+	return s, nil
+}
+
+// For gets a stream whose events belong to the crawl from a start URL.
+func (s *Stream) For(crawl string) *Crawl {
+	if s == nil {
+		return nil
+	}
+	return &Crawl{stream: s, crawl: crawl}
+}
+
+// emit fills in the header of an event and writes it. After a write fails or times out, the
+// error is logged and no more events are written, so that a consumer going away or stalling
+// does not stop the crawl.
+func (s *Stream) emit(crawl, eventType string, e Event) {
+	h := e.header()
+	h.Version = Version
+	h.Type = eventType
+	h.Time = utc.Now()
+	h.Crawl = crawl
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed {
+		return
+	}
+
+	if s.deadline != nil {
+		// regular files do not support deadlines, nor do they need them
+		_ = s.deadline.SetWriteDeadline(time.Now().Add(s.timeout))
+	}
+
+	if err := s.enc.Encode(e); err != nil {
+		s.failed = true
+		logger.Error("Event stream failed", slog.Any("error", err))
+	}
+}
+
+// Close closes the stream, if it was opened by Open.
+func (s *Stream) Close() error {
+	if s == nil || s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Crawl emits the events of the crawl from one start URL. If it is nil, its methods are
+// no-ops.
+type Crawl struct {
+	stream *Stream
+	crawl  string
+}
+
+// CrawlStarted emits a crawl.started event.
+func (c *Crawl) CrawlStarted() {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeCrawlStarted, &CrawlStarted{})
+	}
+}
+
+// Queued emits a url.queued event.
+func (c *Crawl) Queued(e Queued) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeQueued, &e)
+	}
+}
+
+// Fetched emits a url.fetched event.
+func (c *Crawl) Fetched(e Fetched) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeFetched, &e)
+	}
+}
+
+// Skipped emits a url.skipped event.
+func (c *Crawl) Skipped(e Skipped) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeSkipped, &e)
+	}
+}
+
+// Retried emits a url.retried event.
+func (c *Crawl) Retried(e Retried) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeRetried, &e)
+	}
+}
+
+// Written emits a file.written event.
+func (c *Crawl) Written(e Written) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeWritten, &e)
+	}
+}
+
+// CrawlFinished emits a crawl.finished event.
+func (c *Crawl) CrawlFinished(e CrawlFinished) {
+	if c != nil {
+		c.stream.emit(c.crawl, TypeCrawlFinished, &e)
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/utc"
+)
+
+func TestStream(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := utc.Now
+	defer func() { utc.Now = now }()
+	utc.Now = func() time.Time { return t0 }
+
+	buf := &strings.Builder{}
+	crawl := NewStream(buf).For("https://example.org/")
+
+	crawl.CrawlStarted()
+	crawl.Queued(Queued{URL: "https://example.org/a", Referrer: "https://example.org/", Depth: 1})
+	crawl.Skipped(Skipped{URL: "https://other.org/", Reason: "offhost", Detail: "other.org"})
+	crawl.CrawlFinished(CrawlFinished{Seconds: 1.5})
+
+	expect.String(buf.String()).ToBe(t,
+		`{"v":1,"type":"crawl.started","time":"2020-01-01T12:00:00Z","crawl":"https://example.org/"}`+"\n"+
+			`{"v":1,"type":"url.queued","time":"2020-01-01T12:00:00Z","crawl":"https://example.org/","url":"https://example.org/a","referrer":"https://example.org/","depth":1}`+"\n"+
+			`{"v":1,"type":"url.skipped","time":"2020-01-01T12:00:00Z","crawl":"https://example.org/","url":"https://other.org/","reason":"offhost","detail":"other.org"}`+"\n"+
+			`{"v":1,"type":"crawl.finished","time":"2020-01-01T12:00:00Z","crawl":"https://example.org/","seconds":1.5}`+"\n")
+}
+
+func TestOpen_unixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	listener, err := net.Listen("unix", path)
+	expect.Error(err).ToBeNil(t)
+	defer listener.Close()
+
+	received := make(chan Fetched, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var e Fetched
+		if scanner := bufio.NewScanner(conn); scanner.Scan() {
+			_ = json.Unmarshal(scanner.Bytes(), &e)
+		}
+		received <- e
+	}()
+
+	stream, err := Open(path)
+	expect.Error(err).ToBeNil(t)
+
+	stream.For("https://example.org/").Fetched(Fetched{URL: "https://example.org/", Status: 200, Size: 123})
+	expect.Error(stream.Close()).ToBeNil(t)
+
+	e := <-received
+	expect.String(e.Type).ToBe(t, TypeFetched)
+	expect.Number(e.Version).ToBe(t, Version)
+	expect.Number(e.Status).ToBe(t, 200)
+	expect.Number(e.Size).ToBe(t, 123)
+}
+
+func TestStream_stalledConsumer(t *testing.T) {
+	w, r := net.Pipe() // unbuffered, so writes block until read
+	defer r.Close()
+
+	stream := NewStream(w)
+	stream.timeout = 10 * time.Millisecond
+	crawl := stream.For("https://example.org/")
+
+	done := make(chan struct{})
+	go func() {
+		crawl.CrawlStarted()
+		crawl.Queued(Queued{URL: "https://example.org/a"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emit blocked on a stalled consumer")
+	}
+
+	expect.Bool(stream.failed).ToBeTrue(t)
+}
+
+func TestStream_nil(t *testing.T) {
+	var stream *Stream
+	crawl := stream.For("https://example.org/")
+	crawl.CrawlStarted()
+	crawl.Written(Written{URL: "https://example.org/", File: "index.html"})
+	expect.Error(stream.Close()).ToBeNil(t)
+}
@@ -0,0 +1,333 @@
+package explain
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rickb777/goscrape2/download/ioutil"
+	"github.com/spf13/afero"
+)
+
+// FileName is the name of the file holding the trail of the last run, which is kept in the
+// same directory as the ETags DB.
+const FileName = "goscrape-explain.txt"
+
+// Reason is why a URL was or wasn't crawled.
+type Reason int
+
+const (
+	Crawled     Reason = iota // queued for downloading
+	Relative                  // a relative reference, which is queued for downloading
+	NotHTTP                   // the scheme is not http or https
+	Duplicate                 // the same path was already seen
+	OffHost                   // the host differs from that of the start page
+	TooDeep                   // deeper than the depth limit
+	Excluded                  // a rule says it is skipped
+	NotIncluded               // none of the include rules matched it
+	NotFollowed               // a rule says the links in the referring page are not followed
+)
+
+var reasonNames = []string{"crawled", "relative", "scheme", "duplicate", "offhost", "depth", "excluded", "notincluded", "nofollow"}
+
+var reasonTexts = []string{
+	"crawled",
+	"crawled (relative reference)",
+	"not crawled: not an http or https URL",
+	"not crawled: already seen",
+	"not crawled: on a different host",
+	"not crawled: deeper than the depth limit",
+	"not crawled: excluded by a rule",
+	"not crawled: no include rule matched",
+	"not crawled: the links of the referring page are not followed",
+}
+
+// IsCrawled is true for the reasons that allow a URL to be crawled.
+func (r Reason) IsCrawled() bool {
+	return r == Crawled || r == Relative
+}
+
+func (r Reason) String() string {
+	return reasonTexts[r]
+}
+
+// Name gets the short name of the reason, as used in the trail file.
+func (r Reason) Name() string {
+	return reasonNames[r]
+}
+
+func parseReason(s string) (Reason, bool) {
+	i := slices.Index(reasonNames, s)
+	return Reason(i), i >= 0
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Entry records what was decided for a URL the first time it was referenced.
+type Entry struct {
+	URL      string
+	Referrer string // blank for start pages
+	Depth    int
+	Reason   Reason
+	Detail   string // e.g. the rule that matched
+	Seen     int    // the number of times the URL was referenced
+	Code     int    // the HTTP status code, if it was downloaded
+}
+
+func (e Entry) String() string {
+	var b strings.Builder
+	b.WriteString(e.Reason.String())
+	if e.Detail != "" {
+		fmt.Fprintf(&b, " (%s)", e.Detail)
+	}
+	if e.Code != 0 {
+		fmt.Fprintf(&b, ", status %d", e.Code)
+	}
+	fmt.Fprintf(&b, ", depth %d", e.Depth)
+	if e.Seen > 1 {
+		fmt.Fprintf(&b, ", referenced %d times", e.Seen)
+	}
+	return b.String()
+}
+
+// Trail records why each URL was or wasn't crawled, so that this can be explained later.
+// If the trail is nil, its methods are no-ops.
+type Trail struct {
+	entries map[string]*Entry
+	mu      sync.Mutex
+}
+
+// New creates an empty trail.
+func New() *Trail {
+	return &Trail{entries: make(map[string]*Entry)}
+}
+
+// keyOf gets the URL as a string without its fragment.
+func keyOf(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	return v.String()
+}
+
+// Record notes the decision made for a URL that was referenced by another (or by nobody, for
+// start pages). Only the first decision for each URL is kept; later ones are counted.
+func (t *Trail) Record(u, referrer *url.URL, depth int, reason Reason, detail string) {
+	if t == nil {
+		return // no-op if absent
+	}
+
+	if referrer != nil {
+		u = referrer.ResolveReference(u)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := keyOf(u)
+	if e, exists := t.entries[key]; exists {
+		e.Seen++
+		return
+	}
+
+	e := &Entry{URL: key, Depth: depth, Reason: reason, Detail: detail, Seen: 1}
+	if referrer != nil {
+		e.Referrer = keyOf(referrer)
+	}
+	t.entries[key] = e
+}
+
+// RecordStatus notes the HTTP status code of a URL that was downloaded.
+func (t *Trail) RecordStatus(u *url.URL, statusCode int) {
+	if t == nil {
+		return // no-op if absent
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, exists := t.entries[keyOf(u)]; exists {
+		e.Code = statusCode
+	}
+}
+
+// Lookup finds the entry for a URL.
+func (t *Trail) Lookup(u *url.URL) (Entry, bool) {
+	if t == nil {
+		return Entry{}, false // no-op if absent
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, exists := t.entries[keyOf(u)]
+	if !exists {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Chain gets the entry for a URL followed by those of its referrer, its referrer's referrer
+// and so on back to the start page. It is empty if the URL was never referenced.
+func (t *Trail) Chain(u *url.URL) []Entry {
+	if t == nil {
+		return nil // no-op if absent
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var chain []Entry
+	visited := make(map[string]bool)
+
+	for key := keyOf(u); key != "" && !visited[key]; {
+		visited[key] = true
+		e, exists := t.entries[key]
+		if !exists {
+			break
+		}
+		chain = append(chain, *e)
+		key = e.Referrer
+	}
+
+	return chain
+}
+
+// Explain writes the chain of entries for a URL in a human-readable form.
+func (t *Trail) Explain(w io.Writer, u *url.URL) error {
+	chain := t.Chain(u)
+	if len(chain) == 0 {
+		_, err := fmt.Fprintf(w, "%s\n  was not referenced in the last run\n", keyOf(u))
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "%s\n  %s\n", chain[0].URL, chain[0]); err != nil {
+		return err
+	}
+
+	for _, e := range chain[1:] {
+		if _, err := fmt.Fprintf(w, "  linked from %s\n    %s\n", e.URL, e); err != nil {
+			return err
+		}
+	}
+
+	if chain[len(chain)-1].Referrer == "" {
+		_, err := fmt.Fprintln(w, "  which is a start page")
+		return err
+	}
+
+	return nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Save writes the trail to its file in a given directory, replacing any earlier trail.
+// The URLs are sorted alphabetically.
+func (t *Trail) Save(fs afero.Fs, dir string) error {
+	if t == nil {
+		return nil // no-op if absent
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.entries))
+	for key := range t.entries {
+		keys = append(keys, key)
+	}
+
+	// the keys are sorted - not strictly necessary but it aids manual inspection
+	slices.Sort(keys)
+
+	buf := &bytes.Buffer{}
+	for _, key := range keys {
+		e := t.entries[key]
+		fmt.Fprintln(buf, strings.Join([]string{
+			e.URL,
+			e.Reason.Name(),
+			strconv.Itoa(e.Depth),
+			strconv.Itoa(e.Seen),
+			strconv.Itoa(e.Code),
+			dashIfBlank(e.Referrer),
+			dashIfBlank(e.Detail),
+		}, "\t"))
+	}
+
+	_, err := ioutil.WriteFileAtomically(fs, filepath.Join(dir, FileName), buf)
+	return err
+}
+
+// Load reads the trail saved in a given directory.
+func Load(fs afero.Fs, dir string) (*Trail, error) {
+	f, err := fs.Open(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := New()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := parseEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		t.entries[e.URL] = e
+	}
+
+	return t, s.Err()
+}
+
+func parseEntry(line string) (*Entry, error) {
+	parts := strings.Split(line, "\t")
+	if len(parts) != 7 {
+		return nil, fmt.Errorf("%s: expected 7 fields but got %d", line, len(parts))
+	}
+
+	reason, ok := parseReason(parts[1])
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown reason %q", line, parts[1])
+	}
+
+	depth, err1 := strconv.Atoi(parts[2])
+	seen, err2 := strconv.Atoi(parts[3])
+	code, err3 := strconv.Atoi(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("%s: malformed number", line)
+	}
+
+	return &Entry{
+		URL:      parts[0],
+		Reason:   reason,
+		Depth:    depth,
+		Seen:     seen,
+		Code:     code,
+		Referrer: blankIfDash(parts[5]),
+		Detail:   blankIfDash(parts[6]),
+	}, nil
+}
+
+func dashIfBlank(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func blankIfDash(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
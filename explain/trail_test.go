@@ -0,0 +1,79 @@
+package explain
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/spf13/afero"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, e := url.Parse(s)
+	if e != nil {
+		panic(e)
+	}
+	return u
+}
+
+func TestTrail_saveLoadExplain(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	start := mustParseURL("https://example.org/")
+	page := mustParseURL("https://example.org/a/")
+
+	trail := New()
+	trail.Record(start, nil, 0, Crawled, "")
+	trail.RecordStatus(start, 200)
+	trail.Record(mustParseURL("/a/#top"), start, 1, Crawled, "")
+	trail.RecordStatus(page, 200)
+	trail.Record(mustParseURL("b.html"), page, 2, Excluded, "skip path glob:/a/b*")
+	trail.Record(mustParseURL("https://example.org/a/b.html"), start, 1, Duplicate, "/a/b.html")
+
+	fs := afero.NewMemMapFs()
+	err := trail.Save(fs, "/state")
+	expect.Error(err).ToBeNil(t)
+
+	loaded, err := Load(fs, "/state")
+	expect.Error(err).ToBeNil(t)
+
+	entry, found := loaded.Lookup(mustParseURL("https://example.org/a/b.html"))
+	expect.Bool(found).ToBeTrue(t)
+	expect.Any(entry).ToBe(t, Entry{
+		URL:      "https://example.org/a/b.html",
+		Referrer: "https://example.org/a/",
+		Depth:    2,
+		Reason:   Excluded,
+		Detail:   "skip path glob:/a/b*",
+		Seen:     2,
+	})
+
+	buf := &strings.Builder{}
+	err = loaded.Explain(buf, mustParseURL("https://example.org/a/b.html#x"))
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, `https://example.org/a/b.html
+  not crawled: excluded by a rule (skip path glob:/a/b*), depth 2, referenced 2 times
+  linked from https://example.org/a/
+    crawled, status 200, depth 1
+  linked from https://example.org/
+    crawled, status 200, depth 0
+  which is a start page
+`)
+
+	buf.Reset()
+	err = loaded.Explain(buf, mustParseURL("https://example.org/c.html"))
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, "https://example.org/c.html\n  was not referenced in the last run\n")
+}
+
+func TestLoad_malformed(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/state/"+FileName, []byte("https://example.org/\tbogus\t0\t1\t0\t-\t-\n"), 0644)
+
+	_, err := Load(fs, "/state")
+	expect.Error(err).Not().ToBeNil(t)
+}
@@ -1,48 +1,287 @@
 package filter
 
 import (
-	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
 	"regexp"
+	"strings"
+	"unicode"
 
 	"github.com/rickb777/goscrape2/logger"
 )
 
-type Filter []*regexp.Regexp
+// Action is what happens to a URL that matches a rule.
+type Action int
 
-func New(regexps []string) ([]*regexp.Regexp, error) {
-	var errs []error
-	var compiled Filter
+const (
+	Include  Action = iota // fetched, saved and its links followed
+	Skip                   // not fetched at all
+	NoFollow               // fetched and saved, but its links are not followed
+	NoSave                 // fetched and its links followed, but not saved
+)
+
+var actionNames = []string{"include", "skip", "nofollow", "nosave"}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// Target is the part of a URL that a rule's pattern is matched against.
+type Target int
+
+const (
+	Path  Target = iota // the path, e.g. "/a/b.html"
+	URL                 // the whole URL, without any fragment
+	Host                // the host name and optional port
+	Query               // each query parameter, decoded, as "name=value"
+)
+
+var targetNames = []string{"path", "url", "host", "query"}
+
+func (t Target) String() string {
+	return targetNames[t]
+}
+
+// Rule matches URLs using a regular expression or glob pattern applied to part of the URL.
+type Rule struct {
+	Action  Action
+	Target  Target
+	pattern string         // as written
+	re      *regexp.Regexp // nil matches every URL
+}
+
+// NewRule makes a rule from a compiled regular expression.
+func NewRule(action Action, target Target, re *regexp.Regexp) Rule {
+	return Rule{Action: action, Target: target, pattern: re.String(), re: re}
+}
+
+// Otherwise makes a rule that matches every URL, which is useful as the last rule.
+func Otherwise(action Action) Rule {
+	return Rule{Action: action, pattern: "*"}
+}
+
+// ParseRule makes a rule from its textual form, "action [target] pattern", where
+//
+//   - the action is include, skip, nofollow or nosave;
+//   - the optional target is url, host, path (the default) or query;
+//   - the pattern is a regular expression, optionally written with a "re:" prefix, or a glob
+//     if it starts with "glob:".
+//
+// The pattern is the rest of the text after the target, so it may contain spaces, which match
+// the spaces in decoded paths and query parameters; the target must then be given. Regular
+// expressions match anywhere unless they are anchored; globs must match the whole target. In
+// a glob, "*" and "?" don't match "/" but "**" matches anything. Query rules match if any
+// "name=value" query parameter matches.
+//
+// For example, "skip host glob:ads.example.com", "nofollow path glob:/archive/**",
+// "skip query ^utm_" and "skip path re:^/my files/".
+func ParseRule(s string) (Rule, error) {
+	name, rest := cutField(s)
+	if rest == "" {
+		return Rule{}, fmt.Errorf("rule %q: expected action, optional target and pattern", s)
+	}
+
+	action, found := lookup(actionNames, name)
+	if !found {
+		return Rule{}, fmt.Errorf("rule %q: unknown action %q (expected one of %s)", s, name, strings.Join(actionNames, ", "))
+	}
+
+	target := 0 // Path
+	pattern := rest
+	if name, after := cutField(rest); after != "" {
+		target, found = lookup(targetNames, name)
+		if !found {
+			return Rule{}, fmt.Errorf("rule %q: unknown target %q (expected one of %s)", s, name, strings.Join(targetNames, ", "))
+		}
+		pattern = after
+	}
+
+	expr := strings.TrimPrefix(pattern, "re:")
+	if glob, isGlob := strings.CutPrefix(pattern, "glob:"); isGlob {
+		expr = globToRegexp(glob)
+	}
+
+	if Target(target) == Host {
+		expr = "(?i)" + expr // host names are case-insensitive
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+	}
+
+	return Rule{Action: Action(action), Target: Target(target), pattern: pattern, re: re}, nil
+}
+
+// cutField splits the first space-separated field from the rest of the text.
+func cutField(s string) (field, rest string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+func lookup(names []string, name string) (int, bool) {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
 
-	for _, exp := range regexps {
-		re, err := regexp.Compile(exp)
-		if err == nil {
-			compiled = append(compiled, re)
-		} else {
-			errs = append(errs, err)
+// globToRegexp converts a glob pattern to an anchored regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+
+		case '?':
+			b.WriteString("[^/]")
+
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
 		}
 	}
 
-	if len(errs) > 0 {
-		return nil, errors.Join(errs...)
+	b.WriteByte('$')
+	return b.String()
+}
+
+// Matches tests whether the rule applies to a URL.
+func (r Rule) Matches(u *url.URL) bool {
+	if r.re == nil {
+		return true
+	}
+
+	switch r.Target {
+	case URL:
+		v := *u
+		v.Fragment = ""
+		return r.re.MatchString(v.String())
+
+	case Host:
+		return r.re.MatchString(u.Host)
+
+	case Query:
+		for name, values := range u.Query() {
+			for _, value := range values {
+				if r.re.MatchString(name + "=" + value) {
+					return true
+				}
+			}
+		}
+		return false
+
+	default:
+		return r.re.MatchString(u.Path)
+	}
+}
+
+// MatchesAll is true for rules that match every URL, such as those made by Otherwise.
+func (r Rule) MatchesAll() bool {
+	return r.re == nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %s", r.Action, r.Target, r.pattern)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Rules is an ordered list of rules. The first rule that matches a URL decides what happens
+// to it; URLs that match no rule are included.
+type Rules []Rule
+
+// IncludeExclude makes rules equivalent to lists of regular expressions that include and
+// exclude paths. Exclusions take precedence. If there are any inclusions, paths that match
+// none of them are skipped.
+func IncludeExclude(includes, excludes []*regexp.Regexp) Rules {
+	var rules Rules
+
+	for _, re := range excludes {
+		rules = append(rules, NewRule(Skip, Path, re))
+	}
+
+	for _, re := range includes {
+		rules = append(rules, NewRule(Include, Path, re))
 	}
-	return compiled, nil
+
+	if len(includes) > 0 {
+		rules = append(rules, Otherwise(Skip))
+	}
+
+	return rules
 }
 
-func (filter Filter) Present() bool {
-	return len(filter) > 0
+// Action finds what should happen to a URL.
+func (rules Rules) Action(u *url.URL) Action {
+	if rule, found := rules.Match(u); found {
+		logger.Filter.Debug("Matched rule",
+			slog.String("url", u.String()),
+			slog.Any("rule", rule))
+		return rule.Action
+	}
+
+	return Include
 }
 
-func (filter Filter) Matches(url *url.URL, intent string) bool {
-	for _, re := range filter {
-		if re.MatchString(url.Path) {
-			logger.Debug(intent,
-				slog.String("url", url.String()),
-				slog.Any("expression", re))
-			return true
+// Match finds the first rule that matches a URL, if any.
+func (rules Rules) Match(u *url.URL) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(u) {
+			return rule, true
 		}
 	}
 
-	return false
+	return Rule{}, false
+}
+
+// String implements flag.Value.
+func (rules *Rules) String() string {
+	if rules == nil {
+		return ""
+	}
+
+	ss := make([]string, len(*rules))
+	for i, rule := range *rules {
+		ss[i] = rule.String()
+	}
+	return strings.Join(ss, "; ")
+}
+
+// Set implements flag.Value, adding a rule in its textual form (see ParseRule).
+func (rules *Rules) Set(s string) error {
+	rule, err := ParseRule(s)
+	if err != nil {
+		return err
+	}
+
+	*rules = append(*rules, rule)
+	return nil
 }
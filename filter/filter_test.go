@@ -0,0 +1,98 @@
+package filter
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestParseRule(t *testing.T) {
+	cases := []struct {
+		rule     string
+		url      string
+		expected bool
+	}{
+		{rule: "skip /private/", url: "https://example.org/a/private/b.html", expected: true},
+		{rule: "skip path re:^/private/", url: "https://example.org/a/private/b.html", expected: false},
+		{rule: "skip path glob:/private/*", url: "https://example.org/private/b.html", expected: true},
+		{rule: "skip path glob:/private/*", url: "https://example.org/private/a/b.html", expected: false},
+		{rule: "skip path glob:/private/**", url: "https://example.org/private/a/b.html", expected: true},
+		{rule: "skip path glob:/img/photo?.[jp][pn]g", url: "https://example.org/img/photo1.png", expected: true},
+		{rule: "skip path glob:/img/photo[!0-9].jpg", url: "https://example.org/img/photo1.jpg", expected: false},
+		{rule: "skip host glob:*.example.org", url: "https://cdn.example.org/a.js", expected: true},
+		{rule: "skip host glob:*.example.org", url: "https://example.org/a.js", expected: false},
+		{rule: "skip HOST glob:CDN.example.org", url: "https://cdn.Example.org/a.js", expected: true},
+		{rule: "skip host glob:cdn.example.org", url: "https://CDN.Example.org/a.js", expected: true},
+		{rule: "skip query glob:utm_*", url: "https://example.org/?id=1&utm_source=x", expected: true},
+		{rule: "skip query ^sort=", url: "https://example.org/?id=1&sort=name", expected: true},
+		{rule: "skip query ^sort=", url: "https://example.org/?resort=1", expected: false},
+		{rule: "skip url glob:https://example.org/*.pdf", url: "https://example.org/a.pdf#page=2", expected: true},
+		{rule: "skip url glob:https://example.org/*.pdf", url: "http://example.org/a.pdf", expected: false},
+		{rule: "skip path re:^/my files/", url: "https://example.org/my%20files/a.html", expected: true},
+		{rule: "skip path glob:/my files/*", url: "https://example.org/my%20files/a.html", expected: true},
+		{rule: "skip\tquery  q=a b", url: "https://example.org/?q=a+b", expected: true},
+	}
+
+	for _, c := range cases {
+		rule, err := ParseRule(c.rule)
+		expect.Error(err).Info(c.rule).ToBeNil(t)
+		expect.Bool(rule.Matches(mustParse(c.url))).Info(c.rule, c.url).ToBe(t, c.expected)
+	}
+}
+
+func TestParseRule_errors(t *testing.T) {
+	_, err := ParseRule("skip")
+	expect.Error(err).ToContain(t, "expected action, optional target and pattern")
+
+	_, err = ParseRule("ignore /a")
+	expect.Error(err).ToContain(t, `unknown action "ignore"`)
+
+	_, err = ParseRule("skip fragment /a")
+	expect.Error(err).ToContain(t, `unknown target "fragment"`)
+
+	_, err = ParseRule("skip /my files/")
+	expect.Error(err).ToContain(t, `unknown target "/my"`)
+
+	_, err = ParseRule("skip path (")
+	expect.Error(err).ToContain(t, "missing closing )")
+}
+
+func TestRules_Action(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var rules Rules
+	expect.Error(rules.Set("nofollow glob:/archive/**")).ToBeNil(t)
+	expect.Error(rules.Set("nosave path glob:/search")).ToBeNil(t)
+	rules = append(rules, IncludeExclude(
+		[]*regexp.Regexp{regexp.MustCompile("^/archive/"), regexp.MustCompile("^/news/")},
+		[]*regexp.Regexp{regexp.MustCompile("/drafts/")})...)
+
+	cases := map[string]Action{
+		"https://example.org/archive/2020/":      NoFollow,
+		"https://example.org/archive/drafts/":    NoFollow, // the first match wins
+		"https://example.org/search":             NoSave,
+		"https://example.org/news/a.html":        Include,
+		"https://example.org/news/drafts/b.html": Skip,
+		"https://example.org/about.html":         Skip, // not included
+	}
+
+	for u, expected := range cases {
+		expect.Number(rules.Action(mustParse(u))).Info(u).ToBe(t, expected)
+	}
+
+	expect.String(rules.String()).ToContain(t, "nofollow path glob:/archive/**; nosave path glob:/search; skip path /drafts/")
+	expect.Number(Rules{}.Action(mustParse("https://example.org/"))).ToBe(t, Include)
+}
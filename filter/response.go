@@ -0,0 +1,66 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResponseFilter rejects HTTP responses by their size or content type.
+type ResponseFilter struct {
+	MaxSize      int64    // largest acceptable content length in bytes; 0 for unlimited
+	IncludeTypes []string // media types such as "text/*"; if present, only these are accepted
+	ExcludeTypes []string // media types such as "video/*" or "application/zip" that are rejected
+}
+
+// Present reports whether any of the filters are in use.
+func (f ResponseFilter) Present() bool {
+	return f.MaxSize > 0 || len(f.IncludeTypes) > 0 || len(f.ExcludeTypes) > 0
+}
+
+// RejectsSize gets the reason why content of a given length is rejected, or blank if it is
+// acceptable.
+func (f ResponseFilter) RejectsSize(length int64) string {
+	if f.MaxSize > 0 && length > f.MaxSize {
+		return fmt.Sprintf("size %d exceeds the maximum %d", length, f.MaxSize)
+	}
+	return ""
+}
+
+// RejectsType gets the reason why content of a given media type is rejected, or blank if it
+// is acceptable. Exclusions take precedence over inclusions.
+func (f ResponseFilter) RejectsType(mediaType string) string {
+	for _, pattern := range f.ExcludeTypes {
+		if matchesMediaType(pattern, mediaType) {
+			return fmt.Sprintf("content type %s is excluded by %s", mediaType, pattern)
+		}
+	}
+
+	if len(f.IncludeTypes) == 0 {
+		return ""
+	}
+
+	for _, pattern := range f.IncludeTypes {
+		if matchesMediaType(pattern, mediaType) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("content type %s is not included", mediaType)
+}
+
+// matchesMediaType compares a media type with a pattern, which is a media type such as
+// "application/zip", a wildcard subtype such as "video/*", or "*/*".
+func matchesMediaType(pattern, mediaType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	mediaType = strings.ToLower(mediaType)
+
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+
+	if prefix, found := strings.CutSuffix(pattern, "/*"); found {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/rickb777/expect"
+)
+
+func TestResponseFilter_RejectsSize(t *testing.T) {
+	expect.String(ResponseFilter{}.RejectsSize(1<<40)).ToBe(t, "")
+	expect.String(ResponseFilter{MaxSize: 1000}.RejectsSize(-1)).ToBe(t, "")
+	expect.String(ResponseFilter{MaxSize: 1000}.RejectsSize(1000)).ToBe(t, "")
+	expect.String(ResponseFilter{MaxSize: 1000}.RejectsSize(1001)).ToBe(t, "size 1001 exceeds the maximum 1000")
+}
+
+func TestResponseFilter_RejectsType(t *testing.T) {
+	f := ResponseFilter{
+		IncludeTypes: []string{"text/*", "image/*", "application/pdf"},
+		ExcludeTypes: []string{"image/tiff"},
+	}
+
+	cases := map[string]string{
+		"text/html":       "",
+		"TEXT/CSS":        "",
+		"image/png":       "",
+		"application/pdf": "",
+		"image/tiff":      "content type image/tiff is excluded by image/tiff",
+		"video/mp4":       "content type video/mp4 is not included",
+		"textual/plain":   "content type textual/plain is not included",
+	}
+
+	for mediaType, expected := range cases {
+		expect.String(f.RejectsType(mediaType)).Info(mediaType).ToBe(t, expected)
+	}
+
+	expect.String(ResponseFilter{ExcludeTypes: []string{"*/*"}}.RejectsType("text/html")).ToBe(t, "content type text/html is excluded by */*")
+	expect.String(ResponseFilter{}.RejectsType("video/mp4")).ToBe(t, "")
+}
@@ -3,6 +3,7 @@ module github.com/rickb777/goscrape2
 go 1.25.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/beevik/etree v1.6.0
 	github.com/gorilla/css v1.0.1
 	github.com/gorilla/handlers v1.5.2
@@ -18,6 +19,7 @@ require (
 	github.com/sgreben/flagvar v1.10.2
 	github.com/spf13/afero v1.15.0
 	golang.org/x/net v0.52.0
+	golang.org/x/text v0.35.0
 )
 
 require (
@@ -30,7 +32,6 @@ require (
 	github.com/rickb777/plural v1.4.10 // indirect
 	go.opentelemetry.io/otel v1.43.0 // indirect
 	go.opentelemetry.io/otel/trace v1.43.0 // indirect
-	golang.org/x/text v0.35.0 // indirect
 )
 
 tool github.com/magefile/mage
@@ -16,12 +16,16 @@ type Refs []*url.URL
 type Index struct {
 	// key is HTML tag, value is a map of all its urls and the HTML nodes for it
 	data map[atom.Atom]map[string][]*html.Node
+
+	// key is URL, value is the tag and attribute where it was first found, e.g. "img srcset"
+	sources map[string]string
 }
 
 // New returns a new index.
 func New() *Index {
 	return &Index{
-		data: make(map[atom.Atom]map[string][]*html.Node),
+		data:    make(map[atom.Atom]map[string][]*html.Node),
+		sources: make(map[string]string),
 	}
 }
 
@@ -81,21 +85,21 @@ func (h *Index) indexChildren(baseURL *url.URL, node *html.Node) {
 			continue
 		}
 
-		var references []string
-
-		info, ok := Nodes[child.DataAtom]
-		if ok {
-			references = nodeAttributeURLs(baseURL, child, info.parser, info.Attributes...)
-		}
-
 		m, ok := h.data[child.DataAtom]
 		if !ok {
 			m = map[string][]*html.Node{}
 			h.data[child.DataAtom] = m
 		}
 
-		for _, reference := range references {
-			m[reference] = append(m[reference], child)
+		if info, ok := Nodes[child.DataAtom]; ok {
+			for _, attribute := range info.Attributes {
+				for _, reference := range nodeAttributeURLs(baseURL, child, info.parser, attribute) {
+					m[reference] = append(m[reference], child)
+					if _, exists := h.sources[reference]; !exists {
+						h.sources[reference] = child.Data + " " + attribute
+					}
+				}
+			}
 		}
 
 		h.indexChildren(baseURL, child)
@@ -136,6 +140,31 @@ func (h *Index) Nodes(tag atom.Atom) map[string][]*html.Node {
 	return map[string][]*html.Node{}
 }
 
+// Source returns the tag and attribute where a URL was first found, e.g. "img srcset", or
+// blank if it was not found.
+func (h *Index) Source(url string) string {
+	return h.sources[url]
+}
+
+// NodeURLs returns the resolved URLs in the attributes of a single element, without indexing it.
+func NodeURLs(baseURL *url.URL, node *html.Node) []string {
+	info, ok := Nodes[node.DataAtom]
+	if !ok {
+		return nil
+	}
+	return nodeAttributeURLs(baseURL, node, info.parser, info.Attributes...)
+}
+
+// NodeAttributeURLs returns the resolved URLs in one attribute of a single element, without
+// indexing it.
+func NodeAttributeURLs(baseURL *url.URL, node *html.Node, attribute string) []string {
+	info, ok := Nodes[node.DataAtom]
+	if !ok {
+		return nil
+	}
+	return nodeAttributeURLs(baseURL, node, info.parser, attribute)
+}
+
 // nodeAttributeURLs returns resolved URLs based on the base URL and the HTML node attribute values.
 func nodeAttributeURLs(baseURL *url.URL, node *html.Node,
 	parser nodeAttributeParser, attributeName ...string) []string {
@@ -145,6 +145,11 @@ func TestIndexImg(t *testing.T) {
 		expect.Slice(references).ToHaveLength(t, 1)
 		expect.String(references[0].String()).ToBe(t, "https://domain.com/bg.jpg")
 	}
+
+	expect.String(idx.Source("https://domain.com/test.jpg")).ToBe(t, "img src")
+	expect.String(idx.Source("https://domain.com/test-800w.jpg")).ToBe(t, "img srcset")
+	expect.String(idx.Source("https://domain.com/bg.jpg")).ToBe(t, "body background")
+	expect.String(idx.Source("https://domain.com/other.jpg")).ToBe(t, "")
 }
 
 func mustParse(s string) *url.URL {
@@ -154,3 +159,20 @@ func mustParse(s string) *url.URL {
 	}
 	return u
 }
+
+func TestNodeURLs(t *testing.T) {
+	base := mustParse("https://domain.com/dir/")
+
+	img := &html.Node{Type: html.ElementNode, DataAtom: atom.Img, Data: "img", Attr: []html.Attribute{
+		{Key: "src", Val: "a.jpg"},
+		{Key: "srcset", Val: "a-480w.jpg 480w, /a-800w.jpg 800w"},
+		{Key: "alt", Val: "b.jpg"},
+	}}
+	expect.Slice(NodeURLs(base, img)).ToBe(t,
+		"https://domain.com/dir/a.jpg",
+		"https://domain.com/dir/a-480w.jpg",
+		"https://domain.com/a-800w.jpg")
+
+	p := &html.Node{Type: html.ElementNode, DataAtom: atom.P, Data: "p"}
+	expect.Slice(NodeURLs(base, p)).ToBeEmpty(t)
+}
@@ -0,0 +1,267 @@
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rickb777/acceptable/headername"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/utc"
+	"github.com/rickb777/goscrape2/work"
+	"github.com/rickb777/process/v2"
+)
+
+// maxRedirects limits how many redirections are followed to find the final target.
+const maxRedirects = 10
+
+// Config controls the checking of links to other hosts.
+type Config struct {
+	Enabled     bool          // links to other hosts are only checked if enabled
+	Concurrency int           // number of concurrent checks; default 1
+	HostDelay   time.Duration // minimum interval between requests to the same host
+	TTL         time.Duration // how long results are cached in the state DB
+}
+
+// HttpClient sends HTTP requests; it must not follow redirections itself.
+type HttpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Result is the outcome of checking a link.
+type Result struct {
+	URL      *url.URL
+	Status   int           // the final status, or zero if the request failed
+	Location string        // the final target, if the URL was redirected
+	Took     time.Duration // the response time, including any redirections
+	Cached   bool          // true if the result came from a previous run
+	Err      error
+}
+
+// Checker checks each distinct link once, concurrently, using HEAD requests with a fallback
+// to ranged GET requests.
+type Checker struct {
+	config    Config
+	client    HttpClient
+	store     *db.DB
+	UserAgent string
+
+	seen        *work.Set[string]
+	queueIn     chan<- *url.URL
+	queueOut    <-chan *url.URL
+	pool        *process.Group
+	results     []Result
+	nextRequest map[string]time.Time // keyed by host
+	mu          sync.Mutex
+}
+
+// New creates a checker. The results are cached in the store, which may be nil.
+func New(cfg Config, client HttpClient, store *db.DB) *Checker {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+
+	in, out := process.WorkQueue[*url.URL](32)
+
+	return &Checker{
+		config:      cfg,
+		client:      client,
+		store:       store,
+		seen:        work.NewSet[string](),
+		queueIn:     in,
+		queueOut:    out,
+		pool:        process.NewGroup(),
+		nextRequest: make(map[string]time.Time),
+	}
+}
+
+// Start starts the checking, which continues until Wait is called and the queue is empty.
+func (c *Checker) Start(ctx context.Context) {
+	c.pool.GoNE(c.config.Concurrency, func(int) error {
+		for u := range c.queueOut {
+			result := c.check(ctx, u)
+			logResult(result)
+
+			c.mu.Lock()
+			c.results = append(c.results, result)
+			c.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// Check queues a link for checking, unless it was queued before. If the checker is nil, this
+// is a no-op.
+func (c *Checker) Check(u *url.URL) {
+	if c == nil {
+		return // no-op if absent
+	}
+
+	v := *u
+	v.Fragment = ""
+	if c.seen.AddIfAbsent(v.String()) {
+		c.queueIn <- &v
+	}
+}
+
+// Wait waits for all the queued links to be checked, then gets the results. No more links
+// can be checked afterwards.
+func (c *Checker) Wait() []Result {
+	if c == nil {
+		return nil // no-op if absent
+	}
+
+	close(c.queueIn)
+	c.pool.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func (c *Checker) check(ctx context.Context, u *url.URL) Result {
+	now := utc.Now()
+
+	if cached := c.store.LookupLink(u); cached.Expires.After(now) {
+		return Result{URL: u, Status: cached.Code, Location: cached.Location, Cached: true}
+	}
+
+	result := Result{URL: u}
+	target := u
+
+	for range maxRedirects {
+		status, location, err := c.request(ctx, target)
+		if err != nil {
+			result.Err = err
+			break
+		}
+
+		result.Status = status
+		if location == nil {
+			break
+		}
+
+		target = target.ResolveReference(location)
+		result.Location = target.String()
+	}
+
+	result.Took = utc.Now().Sub(now)
+
+	// failures are not cached because they are often transient
+	if result.Err == nil && c.config.TTL > 0 {
+		c.store.StoreLink(u, db.Item{Code: result.Status, Location: result.Location, Expires: now.Add(c.config.TTL)})
+	}
+
+	return result
+}
+
+// request sends a HEAD request, falling back to a GET request for only the first byte if that
+// fails, as it does with some servers. It gets the status and, for redirections, the location.
+func (c *Checker) request(ctx context.Context, u *url.URL) (int, *url.URL, error) {
+	resp, err := c.send(ctx, http.MethodHead, u)
+	if err != nil || resp.StatusCode >= 400 {
+		resp, err = c.send(ctx, http.MethodGet, u)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	status := resp.StatusCode
+	switch status {
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		status = http.StatusOK // the range was only used to minimise the traffic
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location, err := url.Parse(resp.Header.Get(headername.Location))
+		if err != nil || location.String() == "" {
+			return status, nil, nil
+		}
+		return status, location, nil
+	}
+
+	return status, nil, nil
+}
+
+func (c *Checker) send(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	if err := c.waitForHost(ctx, u.Host); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	if c.UserAgent != "" {
+		req.Header.Set(headername.UserAgent, c.UserAgent)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the first byte was requested, so this is cheap
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// waitForHost delays until the next request to a host is allowed.
+func (c *Checker) waitForHost(ctx context.Context, host string) error {
+	now := utc.Now()
+
+	c.mu.Lock()
+	next := c.nextRequest[host]
+	if next.Before(now) {
+		next = now
+	}
+	c.nextRequest[host] = next.Add(c.config.HostDelay)
+	c.mu.Unlock()
+
+	if delay := next.Sub(now); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func logResult(result Result) {
+	args := []any{
+		slog.String("url", result.URL.String()),
+		slog.Int("code", result.Status),
+	}
+	if result.Location != "" {
+		args = append(args, slog.String("location", result.Location))
+	}
+	if result.Cached {
+		args = append(args, slog.Bool("cached", true))
+	} else {
+		args = append(args, slog.String("took", result.Took.Round(time.Millisecond).String()))
+	}
+
+	switch {
+	case result.Err != nil:
+		logger.Warn("External link failed", append(args, slog.Any("error", result.Err))...)
+	case result.Status >= 400:
+		logger.Warn("External link broken", args...)
+	default:
+		logger.Info("External link", args...)
+	}
+}
@@ -0,0 +1,130 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/spf13/afero"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, e := url.Parse(s)
+	if e != nil {
+		panic(e)
+	}
+	return u
+}
+
+// fakeClient gives responses keyed by method and URL, e.g. "HEAD https://example.org/".
+type fakeClient struct {
+	responses map[string]*http.Response
+	requests  []string
+	mu        sync.Mutex
+}
+
+func (c *fakeClient) given(method, url string, status int, location string) {
+	if c.responses == nil {
+		c.responses = make(map[string]*http.Response)
+	}
+	resp := &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+	if location != "" {
+		resp.Header.Set("Location", location)
+	}
+	c.responses[method+" "+url] = resp
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests = append(c.requests, key)
+	if resp, exists := c.responses[key]; exists {
+		return resp, nil
+	}
+	return nil, errors.New("connection refused")
+}
+
+func TestChecker(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client := &fakeClient{}
+	client.given(http.MethodHead, "https://a.org/ok", http.StatusOK, "")
+	client.given(http.MethodHead, "https://a.org/nohead", http.StatusMethodNotAllowed, "")
+	client.given(http.MethodGet, "https://a.org/nohead", http.StatusPartialContent, "")
+	client.given(http.MethodHead, "https://b.org/old", http.StatusMovedPermanently, "/new")
+	client.given(http.MethodHead, "https://b.org/new", http.StatusFound, "https://c.org/final")
+	client.given(http.MethodHead, "https://c.org/final", http.StatusNotFound, "")
+	client.given(http.MethodGet, "https://c.org/final", http.StatusNotFound, "")
+
+	store := db.OpenDB("/state", afero.NewMemMapFs())
+	defer store.Close()
+
+	checker := New(Config{Concurrency: 2, TTL: time.Hour}, client, store)
+	checker.Start(context.Background())
+	checker.Check(mustParseURL("https://a.org/ok#frag"))
+	checker.Check(mustParseURL("https://a.org/ok"))
+	checker.Check(mustParseURL("https://a.org/nohead"))
+	checker.Check(mustParseURL("https://b.org/old"))
+	checker.Check(mustParseURL("https://d.org/down"))
+
+	results := make(map[string]Result)
+	for _, result := range checker.Wait() {
+		results[result.URL.String()] = result
+	}
+
+	expect.Map(results).ToHaveLength(t, 4)
+	expect.Number(results["https://a.org/ok"].Status).ToBe(t, http.StatusOK)
+	expect.Number(results["https://a.org/nohead"].Status).ToBe(t, http.StatusOK)
+	expect.Number(results["https://b.org/old"].Status).ToBe(t, http.StatusNotFound)
+	expect.String(results["https://b.org/old"].Location).ToBe(t, "https://c.org/final")
+	expect.Number(results["https://d.org/down"].Status).ToBe(t, 0)
+	expect.Error(results["https://d.org/down"].Err).Not().ToBeNil(t)
+
+	expect.Any(store.LookupLink(mustParseURL("https://b.org/old")).Location).ToBe(t, "https://c.org/final")
+	expect.Any(store.LookupLink(mustParseURL("https://d.org/down"))).ToBe(t, db.Item{})
+
+	// a second run uses the cache instead of the network, apart from the failure
+	client.requests = nil
+	checker = New(Config{TTL: time.Hour}, client, store)
+	checker.Start(context.Background())
+	checker.Check(mustParseURL("https://b.org/old"))
+	checker.Check(mustParseURL("https://d.org/down"))
+	results2 := checker.Wait()
+
+	expect.Slice(results2).ToHaveLength(t, 2)
+	expect.Bool(results2[0].Cached).ToBeTrue(t)
+	expect.Number(results2[0].Status).ToBe(t, http.StatusNotFound)
+	expect.Slice(client.requests).ToBe(t, "HEAD https://d.org/down", "GET https://d.org/down")
+}
+
+func TestChecker_hostDelay(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client := &fakeClient{}
+	client.given(http.MethodHead, "https://a.org/1", http.StatusOK, "")
+	client.given(http.MethodHead, "https://a.org/2", http.StatusOK, "")
+	client.given(http.MethodHead, "https://a.org/3", http.StatusOK, "")
+
+	checker := New(Config{Concurrency: 3, HostDelay: 20 * time.Millisecond}, client, nil)
+	before := time.Now()
+	checker.Start(context.Background())
+	checker.Check(mustParseURL("https://a.org/1"))
+	checker.Check(mustParseURL("https://a.org/2"))
+	checker.Check(mustParseURL("https://a.org/3"))
+	checker.Wait()
+
+	expect.Number(time.Since(before)).ToBeGreaterThanOrEqual(t, 40*time.Millisecond)
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Component is a part of the program whose log level can be set separately. Its lines are
+// marked with its name.
+type Component string
+
+const (
+	Main     Component = ""         // everything not in another component
+	Download Component = "download" // fetching and storing URLs
+	Document Component = "document" // parsing documents and rewriting their links
+	DB       Component = "db"       // the state database
+	Server   Component = "server"   // the webserver, including its access log
+	Throttle Component = "throttle" // changes to the request rate
+	Filter   Component = "filter"   // the rules that decide what happens to URLs
+)
+
+// Components lists the components whose levels can be set.
+var Components = []Component{Download, Document, DB, Server, Throttle, Filter}
+
+// levels holds the level of each component, or nil if only the Logger's handler filters
+// the lines, as in tests.
+var levels atomic.Pointer[map[Component]slog.Level]
+
+// ParseLevels parses the levels of components, keyed by name, e.g. "throttle": "debug".
+func ParseLevels(names map[string]string) (map[Component]slog.Level, error) {
+	parsed := make(map[Component]slog.Level, len(names))
+
+	for name, value := range names {
+		c := Component(strings.ToLower(name))
+		if !slices.Contains(Components, c) {
+			return nil, fmt.Errorf("unknown log component %q; use one of %s", name, componentNames())
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("log level for %s: %w", name, err)
+		}
+		parsed[c] = level
+	}
+
+	return parsed, nil
+}
+
+func componentNames() string {
+	names := make([]string, len(Components))
+	for i, c := range Components {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Enabled tests whether lines at a level are logged for the component.
+func (c Component) Enabled(level slog.Level) bool {
+	m := levels.Load()
+	if m == nil {
+		return true // the handler decides
+	}
+
+	minimum, found := (*m)[c]
+	if !found {
+		minimum = (*m)[Main]
+	}
+	return level >= minimum
+}
+
+func (c Component) Log(level slog.Level, msg string, args ...any) {
+	if !c.Enabled(level) {
+		return
+	}
+	if c != Main {
+		args = append(args, slog.String("component", string(c)))
+	}
+	Logger.Log(context.Background(), level, msg, args...)
+}
+
+func (c Component) Debug(msg string, args ...any) {
+	c.Log(slog.LevelDebug, msg, args...)
+}
+
+func (c Component) Info(msg string, args ...any) {
+	c.Log(slog.LevelInfo, msg, args...)
+}
+
+func (c Component) Warn(msg string, args ...any) {
+	c.Log(slog.LevelWarn, msg, args...)
+}
+
+func (c Component) Error(msg string, args ...any) {
+	c.Log(slog.LevelError, msg, args...)
+	errorCount.Add(1)
+}
+
+// Slog gets a standard logger for the component, for libraries that need one.
+func (c Component) Slog() *slog.Logger {
+	l := slog.New(&componentHandler{Handler: Logger.Handler(), component: c})
+	if c != Main {
+		l = l.With(slog.String("component", string(c)))
+	}
+	return l
+}
+
+// componentHandler filters lines by the level of a component.
+type componentHandler struct {
+	slog.Handler
+	component Component
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.component.Enabled(level) && h.Handler.Enabled(ctx, level)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{Handler: h.Handler.WithAttrs(attrs), component: h.component}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{Handler: h.Handler.WithGroup(name), component: h.component}
+}
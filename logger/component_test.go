@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels(map[string]string{"Throttle": "debug", "db": "error"})
+	expect.Error(err).Not().ToHaveOccurred(t)
+	expect.Map(levels).ToBe(t, map[Component]slog.Level{Throttle: slog.LevelDebug, DB: slog.LevelError})
+
+	_, err = ParseLevels(map[string]string{"nosuch": "debug"})
+	expect.Error(err).ToContain(t, "unknown log component")
+
+	_, err = ParseLevels(map[string]string{"server": "loud"})
+	expect.Error(err).ToContain(t, "log level for server")
+}
+
+func TestComponentLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	Logger = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	levels.Store(&map[Component]slog.Level{Main: slog.LevelWarn, Throttle: slog.LevelDebug})
+	defer func() {
+		Logger = slog.Default()
+		levels.Store(nil)
+	}()
+
+	Info("not shown")
+	Warn("main")
+	Download.Info("not shown")
+	Throttle.Debug("throttle", slog.Int("n", 1))
+	Server.Slog().Info("not shown")
+	Server.Slog().Warn("server")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expect.Slice(lines).ToHaveLength(t, 3)
+
+	var got []map[string]any
+	for _, line := range lines {
+		var m map[string]any
+		expect.Error(json.Unmarshal([]byte(line), &m)).Not().ToHaveOccurred(t)
+		got = append(got, m)
+	}
+
+	expect.Any(got[0]["msg"]).ToBe(t, "main")
+	expect.Any(got[0]["component"]).ToBe(t, nil)
+	expect.Any(got[1]["msg"]).ToBe(t, "throttle")
+	expect.Any(got[1]["component"]).ToBe(t, "throttle")
+	expect.Any(got[1]["n"]).ToBe(t, 1.0)
+	expect.Any(got[2]["msg"]).ToBe(t, "server")
+	expect.Any(got[2]["component"]).ToBe(t, "server")
+}
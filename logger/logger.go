@@ -6,16 +6,70 @@ import (
 	"fmt"
 	"github.com/rickb777/logrotate"
 	sloghttp "github.com/samber/slog-http"
+	"io"
 	"log/slog"
 	"os"
 	"sync/atomic"
 )
 
+// Format is the format of the log lines.
+type Format int
+
+const (
+	Logfmt Format = iota // key=value pairs, as written by slog.TextHandler
+	JSON                 // one JSON object per line
+)
+
+// Options controls the logger.
+type Options struct {
+	File   string                   // the log file name; "-" for stdout
+	Stdout io.Writer                // used for stdout if not nil
+	Format Format                   // the format of the log lines
+	Level  slog.Level               // the default level
+	Levels map[Component]slog.Level // the levels of specific components
+	Access AccessLog                // what the HTTP access log includes
+}
+
 // Create updates Logger to use a specific log file (or stdout), based
 // on a specified log file name.
-func Create(logFile string, opts *slog.HandlerOptions) {
-	logWriter := logrotate.MustLogWriterWithSignals(logFile, os.Stdout)
-	Logger = slog.New(slog.NewTextHandler(logWriter, opts))
+func Create(opts Options) {
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	logWriter := logrotate.MustLogWriterWithSignals(opts.File, stdout)
+
+	// the handler lets through the lowest of the levels; the components filter the rest
+	lowest := opts.Level
+	componentLevels := map[Component]slog.Level{Main: opts.Level}
+	for c, level := range opts.Levels {
+		componentLevels[c] = level
+		lowest = min(lowest, level)
+	}
+	levels.Store(&componentLevels)
+	accessLog = opts.Access
+
+	handlerOpts := &slog.HandlerOptions{Level: lowest}
+	if opts.Format == JSON {
+		Logger = slog.New(slog.NewJSONHandler(logWriter, handlerOpts))
+	} else {
+		Logger = slog.New(slog.NewTextHandler(logWriter, handlerOpts))
+	}
+}
+
+// AccessLog selects what the HTTP access log includes, in addition to the essentials.
+type AccessLog struct {
+	Disabled        bool // no access log at all
+	RequestID       bool
+	RequestHeaders  bool
+	ResponseHeaders bool
+}
+
+var accessLog = AccessLog{RequestHeaders: true}
+
+// HttpLogEnabled is false if the HTTP access log is disabled.
+func HttpLogEnabled() bool {
+	return !accessLog.Disabled
 }
 
 // HttpLogConfig provides configuration options for the HTTP logger, if used.
@@ -30,9 +84,9 @@ func HttpLogConfig() sloghttp.Config {
 		DefaultLevel:       slog.LevelInfo,
 		ClientErrorLevel:   slog.LevelWarn,
 		ServerErrorLevel:   slog.LevelError,
-		WithRequestID:      false,
-		WithRequestHeader:  true,
-		WithResponseHeader: false,
+		WithRequestID:      accessLog.RequestID,
+		WithRequestHeader:  accessLog.RequestHeaders,
+		WithResponseHeader: accessLog.ResponseHeaders,
 	}
 }
 
@@ -42,29 +96,27 @@ var errorCount atomic.Int64
 var Logger = slog.Default()
 
 func Log(level slog.Level, msg string, args ...any) {
-	Logger.Log(nil, level, msg, args...)
+	Main.Log(level, msg, args...)
 }
 
 func Debug(msg string, args ...any) {
-	Log(slog.LevelDebug, msg, args...)
+	Main.Debug(msg, args...)
 }
 
 func Info(msg string, args ...any) {
-	Log(slog.LevelInfo, msg, args...)
+	Main.Info(msg, args...)
 }
 
 func Warn(msg string, args ...any) {
-	Log(slog.LevelWarn, msg, args...)
+	Main.Warn(msg, args...)
 }
 
 func Error(msg string, args ...any) {
-	Log(slog.LevelError, msg, args...)
-	errorCount.Add(1)
+	Main.Error(msg, args...)
 }
 
 func Errorf(msg string, args ...any) {
-	Log(slog.LevelError, fmt.Sprintf(msg, args...))
-	errorCount.Add(1)
+	Main.Error(fmt.Sprintf(msg, args...))
 }
 
 var Exit = func(code int) {
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -11,19 +10,25 @@ import (
 	"net/http"
 	urlpkg "net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rickb777/goscrape2/config"
 	"github.com/rickb777/goscrape2/db"
-	"github.com/rickb777/goscrape2/download"
 	"github.com/rickb777/goscrape2/download/ioutil"
+	"github.com/rickb777/goscrape2/envfile"
+	"github.com/rickb777/goscrape2/filter"
 	"github.com/rickb777/goscrape2/images"
+	"github.com/rickb777/goscrape2/linkcheck"
 	"github.com/rickb777/goscrape2/logger"
-	"github.com/rickb777/goscrape2/scraper"
+	"github.com/rickb777/goscrape2/mapping"
+	"github.com/rickb777/goscrape2/progress"
 	"github.com/rickb777/goscrape2/server"
+	"github.com/rickb777/goscrape2/stats"
 	"github.com/rickb777/servefiles/v3"
 	"github.com/sgreben/flagvar"
 	"github.com/spf13/afero"
@@ -37,53 +42,109 @@ var (
 type Arguments struct {
 	URLs []*urlpkg.URL
 
-	Include   flagvar.Regexps
-	Exclude   flagvar.Regexps
-	Directory string
+	Rules       filter.Rules
+	Include     flagvar.Regexps
+	Exclude     flagvar.Regexps
+	IncludeType flagvar.Strings
+	ExcludeType flagvar.Strings
+	MaxSize     int64
+	Directory   string
 
 	Concurrency    int
 	Depth          int
 	ImageQuality   int
+	Scripts        flagvar.Enum
+	FeedUpdate     bool
+	Spider         string
+	SpiderFormat   flagvar.Enum
+	BrokenLinks    string
+	BrokenFormat   flagvar.Enum
+	Graph          string
+	GraphFormat    flagvar.Enum
+	Report         string
+	Progress       time.Duration
+	Events         string
+	External       bool
+	ExternalConc   int
+	ExternalDelay  time.Duration
+	ExternalTTL    time.Duration
+	Gzip           flagvar.Enum
 	RequestTimeout time.Duration
 	ConnectTimeout time.Duration
 	LoopDelay      time.Duration
 	LaxAge         time.Duration
 	Tries          int
 
-	Serve      bool
-	ServerPort int
+	Serve       bool
+	ServerPort  int
+	Socket      string
+	MetricsPath string
 
 	CookieFile     string
 	SaveCookieFile string
 
+	ConfigFile string
+
 	Headers   flagvar.Assignments
 	User      string
 	UserAgent string
 
-	LogFile string
-	Verbose bool
-	Debug   bool
+	LogFile   string
+	LogFormat flagvar.Enum
+	LogLevels flagvar.AssignmentsMap
+	AccessLog flagvar.EnumSetCSV
+	Verbose   bool
+	Debug     bool
 }
 
-func declareFlags() (Arguments, error) {
+func declareFlags(args []string) (Arguments, error) {
 	var arguments Arguments
 	arguments.Headers.Separator = ":"
-
-	if err := applyEnvList(&arguments.Include, "GOSCRAPE_INCLUDE", " "); err != nil {
-		return arguments, err
-	}
-
-	if err := applyEnvList(&arguments.Exclude, "GOSCRAPE_EXCLUDE", " "); err != nil {
-		return arguments, err
-	}
+	arguments.Scripts = flagvar.Enum{Choices: []string{"off", "scan", "rewrite"}, Value: "off"}
+	arguments.Gzip = flagvar.Enum{Choices: []string{"off", "both", "only"}, Value: "off"}
+	arguments.SpiderFormat = flagvar.Enum{Choices: []string{"csv", "jsonl"}, Value: "csv"}
+	arguments.BrokenFormat = flagvar.Enum{Choices: []string{"html", "csv", "json"}, Value: "html"}
+	arguments.GraphFormat = flagvar.Enum{Choices: []string{"dot", "graphml", "json"}, Value: "dot"}
+	arguments.LogFormat = flagvar.Enum{Choices: []string{"logfmt", "json"}, Value: "logfmt"}
+	arguments.AccessLog = flagvar.EnumSetCSV{Choices: []string{"none", "requestid", "requestheaders", "responseheaders"}, Value: map[string]bool{"requestheaders": true}}
 
 	flag.Var(&arguments.Include, "i", "only include URLs that match a `regular expression` (can be repeated)")
 	flag.Var(&arguments.Exclude, "x", "exclude URLs that match a `regular expression` (can be repeated)")
+	flag.Var(&arguments.Rules, "rule", "a `rule` \"action [target] pattern\" deciding what happens to matching URLs (can be repeated; the first match wins).\n"+
+		"The action is include, skip, nofollow (fetch but don't follow links) or nosave (follow links but don't save).\n"+
+		"The target is url, host, path (default) or query. The pattern is a regular expression, which may start with\n"+
+		"\"re:\", or a glob if it starts with \"glob:\", e.g. \"skip query glob:utm_*\". It is the rest of the rule, so it may\n"+
+		"contain spaces if the target is given. Rules take precedence over -x, which takes precedence over -i.")
+	flag.Var(&arguments.IncludeType, "includetype", "only keep responses with a content `type` such as text/* or application/pdf (can be repeated)")
+	flag.Var(&arguments.ExcludeType, "excludetype", "abandon responses with a content `type` such as video/* or application/zip (can be repeated)")
+	flag.Int64Var(&arguments.MaxSize, "maxsize", 0, "abandon responses larger than this many `bytes` (default unlimited)")
 	flag.StringVar(&arguments.Directory, "dir", "", "`directory` to write files to and to serve files from")
 
 	flag.IntVar(&arguments.Concurrency, "concurrency", 1, "the number of concurrent downloads")
 	flag.IntVar(&arguments.Depth, "depth", 0, "download depth limit (default unlimited)")
 	flag.IntVar(&arguments.ImageQuality, "imagequality", 0, "image quality reduction, minimum 1 to maximum 99 (re-encoding disabled by default)")
+	flag.Var(&arguments.Scripts, "scripts", "heuristic discovery of asset URLs in JavaScript, JSON and inline scripts; the `mode` is off, scan or rewrite.\nThe rewrite mode also makes absolute same-site URLs in scripts root-relative.")
+	flag.BoolVar(&arguments.FeedUpdate, "feedupdate", false, "only follow RSS and Atom entries that are newer than those seen in a previous run")
+	flag.StringVar(&arguments.Spider, "spider", "", "spider mode: discover URLs without saving anything, writing a list of every URL reached with its\n"+
+		"status, content type, size and depth to a `file` (\"-\" for stdout). Only HTML and CSS are fetched in full.")
+	flag.Var(&arguments.SpiderFormat, "spiderformat", "the `format` of the -spider list: csv or jsonl")
+	flag.StringVar(&arguments.BrokenLinks, "brokenlinks", "", "at the end, write a report of every URL that gave a 4xx or 5xx response or failed, with the pages\n"+
+		"that link to it and the link text, to a `file` (\"-\" for stdout)")
+	flag.Var(&arguments.BrokenFormat, "brokenformat", "the `format` of the -brokenlinks report: html, csv or json")
+	flag.StringVar(&arguments.Graph, "graph", "", "at the end, write the link graph of the crawl to a `file` (\"-\" for stdout). The nodes carry the status,\n"+
+		"depth, content type and size of each URL; the edges carry the element and attribute of each link.")
+	flag.Var(&arguments.GraphFormat, "graphformat", "the `format` of the -graph file: dot, graphml or json")
+	flag.DurationVar(&arguments.Progress, "progress", 30*time.Second, "the interval (with units, e.g. 1m) between progress log lines; in a terminal, a live progress line is\n"+
+		"shown instead, unless any output goes to stdout. Zero disables the progress.")
+	flag.StringVar(&arguments.Events, "events", "", "write a stream of crawl events as JSON lines to a `file`, named pipe or Unix domain socket, for\n"+
+		"other tools to react to in real time")
+	flag.StringVar(&arguments.Report, "report", "", "at the end, write a JSON report of each start URL's run to a `file` (\"-\" for stdout), with counts by status and\n"+
+		"content type, bytes transferred and stored, the slowest URLs, the largest files, retries, throttling and duration")
+	flag.BoolVar(&arguments.External, "external", false, "check each distinct link to another host once, using HEAD or a ranged GET, and report any that are broken")
+	flag.IntVar(&arguments.ExternalConc, "externalconcurrency", 4, "the number of concurrent -external checks")
+	flag.DurationVar(&arguments.ExternalDelay, "externaldelay", time.Second, "the minimum interval (with units, e.g. 500ms) between -external checks on the same host")
+	flag.DurationVar(&arguments.ExternalTTL, "externalttl", 24*time.Hour, "how long (with units, e.g. 12h) the result of each -external check is cached in the state DB")
+	flag.Var(&arguments.Gzip, "gzip", "store HTML, CSS, JavaScript, SVG and JSON files gzip-compressed (e.g. index.html.gz); the `mode` is off, both or only.\nThe both mode also keeps the uncompressed files. The webserver serves the compressed files with Content-Encoding.")
 	flag.DurationVar(&arguments.RequestTimeout, "timeout", 60*time.Second, "overall time limit (with units, e.g. 31s) for each HTTP request to connect and read the response\nThis is dependent on -connect and will always be greater than that timeout.")
 	flag.DurationVar(&arguments.ConnectTimeout, "connect", 30*time.Second, "time limit (with units, e.g. 1s) for each HTTP request to connect")
 	flag.DurationVar(&arguments.LoopDelay, "loopdelay", 0, "delay (with units, e.g. 1s) used between any two downloads")
@@ -91,20 +152,30 @@ func declareFlags() (Arguments, error) {
 	flag.IntVar(&arguments.Tries, "tries", 1, "the number of tries to download each file if the server gives a 5xx error")
 
 	flag.BoolVar(&arguments.Serve, "serve", false, "serve the website using a webserver.\nScraping will happen only on demand using the first URL you provide.")
-	flag.IntVar(&arguments.ServerPort, "port", 8080, "port to use for the webserver")
+	flag.IntVar(&arguments.ServerPort, "port", 8080, "port to use for the webserver, unless systemd socket activation passes it sockets")
+	flag.StringVar(&arguments.Socket, "socket", "", "the `path` of a Unix domain socket that the webserver also listens on, e.g. behind a reverse proxy")
+	flag.StringVar(&arguments.MetricsPath, "metrics", "/metrics", "the URL `path` where the webserver serves its metrics in the Prometheus text format;\nblank to disable them, e.g. if the website has a page with the same path")
 
 	flag.StringVar(&arguments.CookieFile, "cookies", "", "file containing the cookie content")
 	flag.StringVar(&arguments.SaveCookieFile, "savecookiefile", "", "file to save the cookie content")
 
+	flag.StringVar(&arguments.ConfigFile, "config", "", "an environment `file`, such as /etc/default/goscrape.conf, from which the GOSCRAPE_ variables are read\n"+
+		"instead of the environment. It is read again when the webserver is running and SIGUSR2 is received.")
 	flag.Var(&arguments.Headers, "H", "\"name:value\" HTTP header to use for scraping (can be repeated)")
 	flag.StringVar(&arguments.User, "user", "", "user[:password] to use for HTTP authentication")
 	flag.StringVar(&arguments.UserAgent, "useragent", "", "user agent to use for scraping")
 
 	flag.StringVar(&arguments.LogFile, "log", "-", `output log file; use "-" for stdout`)
+	flag.Var(&arguments.LogFormat, "logformat", "the `format` of the log: logfmt or json")
+	flag.Var(&arguments.LogLevels, "loglevel", "a `component=level` pair setting the log level of one component, overriding -v and -z (can be repeated).\n"+
+		"The components are download, document, db, server (including its access log), throttle and filter;\nthe levels are debug, info, warn and error.")
+	flag.Var(&arguments.AccessLog, "accesslog", "what the webserver access log includes, as a comma-separated `list` of\nrequestid, requestheaders and responseheaders, or none for no access log")
 	flag.BoolVar(&arguments.Verbose, "v", false, "verbose output")
 	flag.BoolVar(&arguments.Debug, "z", false, "debug output")
 
-	flag.Parse()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return arguments, err
+	}
 
 	setUsageInfo("Scrape a website and create an offline browsable version on the disk.")
 	return arguments, nil
@@ -114,9 +185,15 @@ func setUsageInfo(headline string) {
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), headline)
 		fmt.Fprintf(flag.CommandLine.Output(), "\nUsage:\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "  %s [options] [<url> ...]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s [options] [<url> ...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s explain <url> ...\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s filtertest [options] [<url> ...]\n\n", os.Args[0])
 		flag.PrintDefaults()
 		fmt.Fprintf(flag.CommandLine.Output(), `
+The explain command prints why each URL was or wasn't crawled in the last run, and which pages
+led to it. The filtertest command shows what the -rule, -i and -x options do to each URL, without
+downloading anything; the URLs are read from stdin if none are given.
+
 Options also accept '--'.
 
 Environment:
@@ -126,6 +203,10 @@ Environment:
 	Adds regular expressions to the -i include list (space separated)
   GOSCRAPE_EXCLUDE
 	Adds regular expressions to the -x exclude list (space separated)
+  GOSCRAPE_HEADERS
+	Adds "name:value" HTTP headers, like -H (separated by '|')
+  GOSCRAPE_LOOPDELAY
+	Sets the -loopdelay, unless that option is given
   HTTP_PROXY, HTTPS_PROXY
 	Controls the proxy used for outbound connections: either a complete URL or a "host[:port]", in which
 	case the "http" scheme is assumed. Authentication can be included with a complete URL.
@@ -145,24 +226,32 @@ Version `)
 //-------------------------------------------------------------------------------------------------
 
 func main() {
-	args, err := declareFlags()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "explain":
+			logger.Exit(explainURLs(os.Stdout, os.Args[2:]))
+		case "filtertest":
+			logger.Exit(filterTest(os.Stdout, os.Stdin, os.Args[2:]))
+		}
+	}
+
+	base, err := declareFlags(os.Args[1:])
 	if err != nil {
 		fmt.Printf("Invalid flags: %s\n", err)
 		logger.Exit(1)
 	}
 
-	createLogger(args)
+	term := createLogger(base)
 
-	allStartURLs := append(getenvList("GOSCRAPE_URLS", " "), flag.Args()...)
-
-	args.URLs, err = parseAll(allStartURLs)
+	args, err := applyEnvironment(base)
 	if err != nil {
-		fmt.Printf("Invalid URL: %s\n", err)
+		fmt.Printf("Config error: %s\n", err)
 		logger.Exit(1)
 	}
 
-	ctx := context.Background()
-	//ctx := app.Context() // provides signal handler cancellation
+	// stopping the service shuts the webserver down, which removes any Unix domain socket
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	if !args.Serve && len(args.URLs) == 0 {
 		setUsageInfo("Must provide -serve to run webserver and/or URLs to scrape")
@@ -176,22 +265,37 @@ func main() {
 		logger.Exit(1)
 	}
 
+	server.MetricsPath = args.MetricsPath
+
 	fs := afero.NewOsFs()
 
 	if !ioutil.FileExists(fs, cfg.Directory) {
 		db.DeleteFile(fs) // get rid of stale cache
 	}
 
+	var listeners server.Listeners
+	if args.Serve {
+		listeners, err = server.Listen(int16(args.ServerPort), args.Socket)
+		if err != nil {
+			fmt.Printf("Webserver error: %s\n", err)
+			logger.Exit(1)
+		}
+	}
+
 	if len(args.URLs) > 0 {
-		if err := scrapeURLs(ctx, fs, *cfg, args.SaveCookieFile, args.Serve, int16(args.ServerPort), args.URLs); err != nil {
+		c := &crawler{fs: fs, term: term, base: base, args: args, cfg: *cfg, serve: args.Serve, listeners: listeners}
+		c.recrawl = c.crawl
+		if err := c.run(ctx); err != nil {
 			logger.Error("Scraping execution error", slog.Any("error", err))
 		}
 
 	} else if args.Serve {
-		if err := server.ServeDirectory(ctx, nil, cfg.Directory, int16(args.ServerPort)); err != nil {
+		if err := server.ServeDirectory(ctx, nil, cfg.Directory, listeners); err != nil {
 			logger.Error("Server execution error", slog.Any("error", err))
 		}
 	}
+
+	listeners.Close() // in case the webserver did not start
 	logger.Exit(0)
 }
 
@@ -228,12 +332,26 @@ func buildConfig(args Arguments) (*config.Config, error) {
 	}
 
 	return &config.Config{
-		Includes: args.Include.Values,
-		Excludes: args.Exclude.Values,
+		Rules: slices.Concat(args.Rules, filter.IncludeExclude(args.Include.Values, args.Exclude.Values)),
+		Responses: filter.ResponseFilter{
+			MaxSize:      args.MaxSize,
+			IncludeTypes: args.IncludeType.Values,
+			ExcludeTypes: args.ExcludeType.Values,
+		},
+		External: linkcheck.Config{
+			Enabled:     args.External,
+			Concurrency: args.ExternalConc,
+			HostDelay:   args.ExternalDelay,
+			TTL:         args.ExternalTTL,
+		},
 
 		Concurrency:    args.Concurrency,
 		MaxDepth:       args.Depth,
 		ImageQuality:   images.ImageQuality(imageQuality),
+		Scripts:        scriptMode(args.Scripts.Value),
+		FeedUpdate:     args.FeedUpdate,
+		Spider:         args.Spider != "",
+		Compression:    compression(args.Gzip.Value),
 		RequestTimeout: args.RequestTimeout,
 		LoopDelay:      args.LoopDelay,
 		LaxAge:         args.LaxAge,
@@ -249,66 +367,38 @@ func buildConfig(args Arguments) (*config.Config, error) {
 	}, nil
 }
 
-func scrapeURLs(ctx context.Context, fs afero.Fs, cfg config.Config, saveCookieFile string, serve bool, serverPort int16, urls []*urlpkg.URL) error {
-	etagStore := db.Open()
-	defer etagStore.Close()
-
-	var webServer *http.Server
-	var errChan chan error
-
-	for i, url := range urls {
-		sc, err := scraper.New(cfg, url, afero.NewBasePathFs(fs, cfg.Directory))
-		if err != nil {
-			return fmt.Errorf("initializing scraper: %w", err)
-		}
-
-		sc.ETagsDB = etagStore
-
-		if serve && i == 0 {
-			webServer, errChan, err = server.LaunchWebserver(sc, cfg.Directory, serverPort)
-			if err != nil {
-				return fmt.Errorf("launching webserver: %w", err)
-			}
-		}
-
-		logger.Info("Scraping", slog.String("url", sc.URL.String()))
-		if err = sc.Start(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				logger.Exit(1)
-			}
-
-			var ue *urlpkg.Error
-			if errors.As(err, &ue) {
-				if serve {
-					logger.Warn("HTTP request failed",
-						slog.String("url", url.String()),
-						slog.Any("error", err))
-					continue // ignore because the webserver is operational
-				}
-			}
-
-			return fmt.Errorf("HTTP get %s failed: %w", url, err)
-		}
-
-		if saveCookieFile != "" {
-			if err := saveCookies(saveCookieFile, sc.Cookies()); err != nil {
-				return fmt.Errorf("saving cookies url=%s: %w", url, err)
-			}
-		}
+func scriptMode(value string) config.ScriptMode {
+	switch value {
+	case "scan":
+		return config.ScriptsScanned
+	case "rewrite":
+		return config.ScriptsRewritten
+	default:
+		return config.ScriptsIgnored
 	}
+}
 
-	reportHistogram()
-
-	return server.AwaitWebserver(ctx, webServer, errChan)
+func compression(value string) mapping.Compression {
+	switch value {
+	case "both":
+		return mapping.CompressionBoth
+	case "only":
+		return mapping.CompressionOnly
+	default:
+		return mapping.CompressionOff
+	}
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func reportHistogram() {
-	m := download.Counters.Map()
+func reportHistogram(summary stats.Summary) {
+	m := summary.Statuses
 	keys := slices.Collect(maps.Keys(m))
 	slices.Sort(keys)
-	logger.Warn("Scraping finished", slog.Int("response-codes", len(keys)))
+	logger.Warn("Scraping finished",
+		slog.String("url", summary.URL),
+		slog.String("took", time.Duration(summary.Seconds*float64(time.Second)).Round(time.Millisecond).String()),
+		slog.Int("response-codes", len(keys)))
 	for _, key := range keys {
 		n := m[key]
 		verb := "was"
@@ -319,19 +409,50 @@ func reportHistogram() {
 	}
 }
 
-func createLogger(args Arguments) {
-	opts := &slog.HandlerOptions{Level: slog.LevelWarn}
+// createLogger creates the logger. If the log is written to a terminal, the terminal is
+// returned so that it can also show the progress, unless that would disturb other output.
+func createLogger(args Arguments) *progress.Terminal {
+	opts := logger.Options{File: args.LogFile, Level: slog.LevelWarn}
 
 	if args.Debug {
 		opts.Level = slog.LevelDebug
-		servefiles.Debugf = func(format string, v ...interface{}) { logger.Debug(fmt.Sprintf(format, v...)) }
 	} else if args.Verbose {
 		opts.Level = slog.LevelInfo
-	} else {
-		opts.Level = slog.LevelWarn
 	}
 
-	logger.Create(args.LogFile, opts)
+	if args.LogFormat.Value == "json" {
+		opts.Format = logger.JSON
+	}
+
+	levels, err := logger.ParseLevels(args.LogLevels.Values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		logger.Exit(1)
+	}
+	opts.Levels = levels
+
+	opts.Access = logger.AccessLog{
+		Disabled:        args.AccessLog.Value["none"],
+		RequestID:       args.AccessLog.Value["requestid"],
+		RequestHeaders:  args.AccessLog.Value["requestheaders"],
+		ResponseHeaders: args.AccessLog.Value["responseheaders"],
+	}
+
+	var term *progress.Terminal
+	if args.LogFile == "-" && args.Progress > 0 && !slices.Contains([]string{args.Spider, args.BrokenLinks, args.Graph, args.Report}, "-") {
+		term = progress.NewTerminal(os.Stdout)
+		if term != nil {
+			opts.Stdout = term // a nil *Terminal would not be a nil io.Writer
+		}
+	}
+
+	logger.Create(opts)
+
+	if logger.Server.Enabled(slog.LevelDebug) {
+		servefiles.Debugf = func(format string, v ...interface{}) { logger.Server.Debug(fmt.Sprintf(format, v...)) }
+	}
+
+	return term
 }
 
 func readCookieFile(cookieFile string) ([]config.Cookie, error) {
@@ -385,8 +506,71 @@ func formatVersion(version, date string) string {
 
 //-------------------------------------------------------------------------------------------------
 
-func applyEnvList(f flag.Value, key, separator string) error {
-	value := strings.TrimSpace(os.Getenv(key))
+// applyEnvironment adds the settings from the GOSCRAPE_ variables to those from the command
+// line. The variables are read from the -config file if there is one, otherwise from the
+// environment. It is used again when the configuration is reloaded.
+func applyEnvironment(base Arguments) (Arguments, error) {
+	getenv := os.Getenv
+	if base.ConfigFile != "" {
+		vars, err := envfile.ReadFile(base.ConfigFile)
+		if err != nil {
+			return base, err
+		}
+		getenv = func(key string) string { return vars[key] }
+	}
+
+	// the lists are rebuilt so that those in base are unaltered
+	args := base
+	args.Include = flagvar.Regexps{}
+	args.Exclude = flagvar.Regexps{}
+	args.Headers = flagvar.Assignments{Separator: ":"}
+
+	if err := applyEnvList(&args.Include, getenv("GOSCRAPE_INCLUDE"), " "); err != nil {
+		return base, fmt.Errorf("GOSCRAPE_INCLUDE: %w", err)
+	}
+
+	if err := applyEnvList(&args.Exclude, getenv("GOSCRAPE_EXCLUDE"), " "); err != nil {
+		return base, fmt.Errorf("GOSCRAPE_EXCLUDE: %w", err)
+	}
+
+	if err := applyEnvList(&args.Headers, getenv("GOSCRAPE_HEADERS"), "|"); err != nil {
+		return base, fmt.Errorf("GOSCRAPE_HEADERS: %w", err)
+	}
+
+	args.Include.Values = append(args.Include.Values, base.Include.Values...)
+	args.Include.Texts = append(args.Include.Texts, base.Include.Texts...)
+	args.Exclude.Values = append(args.Exclude.Values, base.Exclude.Values...)
+	args.Exclude.Texts = append(args.Exclude.Texts, base.Exclude.Texts...)
+	args.Headers.Values = append(args.Headers.Values, base.Headers.Values...)
+	args.Headers.Texts = append(args.Headers.Texts, base.Headers.Texts...)
+
+	if delay := strings.TrimSpace(getenv("GOSCRAPE_LOOPDELAY")); delay != "" && !isFlagSet("loopdelay") {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return base, fmt.Errorf("GOSCRAPE_LOOPDELAY: %w", err)
+		}
+		args.LoopDelay = d
+	}
+
+	var err error
+	args.URLs, err = parseAll(append(splitList(getenv("GOSCRAPE_URLS"), " "), flag.Args()...))
+	if err != nil {
+		return base, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	return args, nil
+}
+
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		found = found || f.Name == name
+	})
+	return found
+}
+
+func applyEnvList(f flag.Value, value, separator string) error {
+	value = strings.TrimSpace(value)
 	if len(value) > 0 {
 		for _, s := range filterNonBlank(strings.Split(value, separator)) {
 			if err := f.Set(s); err != nil {
@@ -397,8 +581,8 @@ func applyEnvList(f flag.Value, key, separator string) error {
 	return nil
 }
 
-func getenvList(key, separator string) []string {
-	value := strings.TrimSpace(os.Getenv(key))
+func splitList(value, separator string) []string {
+	value = strings.TrimSpace(value)
 	if len(value) == 0 {
 		return nil
 	}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+func TestCreateLogger_stdoutNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	expect.Error(err).ToBeNil(t)
+	defer r.Close()
+
+	stdout, log := os.Stdout, logger.Logger
+	defer func() { os.Stdout, logger.Logger = stdout, log }()
+	os.Stdout = w
+
+	term := createLogger(Arguments{LogFile: "-", Progress: time.Second})
+	expect.Any(term).ToBeNil(t)
+
+	logger.Warn("Piped")
+	expect.Error(w.Close()).ToBeNil(t)
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	expect.Error(err).ToBeNil(t)
+	expect.String(line).ToContain(t, "msg=Piped")
+}
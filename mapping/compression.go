@@ -0,0 +1,36 @@
+package mapping
+
+import (
+	"github.com/rickb777/path"
+	"strings"
+)
+
+// GzipExtension is added to the names of files that are stored gzip-compressed.
+const GzipExtension = ".gz"
+
+// Compression controls whether compressible files are stored gzip-compressed.
+type Compression int
+
+const (
+	CompressionOff  Compression = iota // files are stored as they are
+	CompressionBoth                    // compressible files are stored both as they are and compressed
+	CompressionOnly                    // compressible files are stored compressed only
+)
+
+// compressibleExtensions lists the file extensions of the text formats that compress well.
+var compressibleExtensions = map[string]struct{}{
+	".htm": {}, ".html": {}, ".css": {}, ".js": {}, ".mjs": {}, ".svg": {}, ".json": {}, ".webmanifest": {},
+}
+
+// IsCompressible reports whether a file is a text format that is worth compressing, based on
+// its extension.
+func IsCompressible(filePath string) bool {
+	_, ext := path.SplitExt(filePath)
+	_, exists := compressibleExtensions[strings.ToLower(ext)]
+	return exists
+}
+
+// GzipFilePath gets the path of the gzip-compressed copy of a file.
+func GzipFilePath(filePath string) string {
+	return filePath + GzipExtension
+}
@@ -0,0 +1,25 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/rickb777/expect"
+)
+
+func TestIsCompressible(t *testing.T) {
+	cases := map[string]bool{
+		"./index.html":             true,
+		"./a/style.CSS":            true,
+		"./app.mjs":                true,
+		"./pix/logo.svg":           true,
+		"./site.webmanifest":       true,
+		"./pix/photo.jpg":          false,
+		"./archive.tar":            false,
+		"./index.html.gz":          false,
+		"./dir.with.dots/filename": false,
+	}
+
+	for filePath, expected := range cases {
+		expect.Bool(IsCompressible(filePath)).Info(filePath).ToBe(t, expected)
+	}
+}
@@ -0,0 +1,279 @@
+// Package metrics provides counters, gauges and histograms that are written in the Prometheus
+// text exposition format, without depending on the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector is a metric that can be registered.
+type Collector interface {
+	// Type is "counter", "gauge" or "histogram".
+	Type() string
+	// Write writes the samples of the metric, using its name.
+	Write(w io.Writer, name string) error
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Registry holds a set of metrics. It is an http.Handler that serves them. It is safe for
+// concurrent use.
+type Registry struct {
+	metrics []registered
+	mu      sync.Mutex
+}
+
+type registered struct {
+	name, help string
+	collector  Collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a metric. Nil collectors, including nil pointers, are ignored.
+func (r *Registry) Register(name, help string, c Collector) {
+	if c == nil || (reflect.ValueOf(c).Kind() == reflect.Pointer && reflect.ValueOf(c).IsNil()) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, registered{name: name, help: help, collector: c})
+}
+
+// Write writes all the metrics in the order they were registered.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.collector.Type()); err != nil {
+			return err
+		}
+		if err := m.collector.Write(w, m.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.Write(w)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Counter is a value that only increases. It is lock-free.
+type Counter struct {
+	value atomic.Int64
+}
+
+// Add increases the counter.
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value gets the current value.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) Type() string { return "counter" }
+
+func (c *Counter) Write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	return err
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// CounterVec is a set of counters distinguished by the value of one label.
+type CounterVec struct {
+	label  string
+	values map[string]int64
+	mu     sync.Mutex
+}
+
+// NewCounterVec creates a set of counters with a label.
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{label: label, values: make(map[string]int64)}
+}
+
+// Inc increases the counter for a label value by one.
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Values gets the current values, keyed by label value.
+func (c *CounterVec) Values() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.values)
+}
+
+func (c *CounterVec) Type() string { return "counter" }
+
+func (c *CounterVec) Write(w io.Writer, name string) error {
+	values := c.Values()
+	floats := make(map[string]float64, len(values))
+	for k, v := range values {
+		floats[k] = float64(v)
+	}
+	return writeLabelled(w, name, c.label, floats)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Func is a counter or gauge whose value is obtained when it is collected.
+type Func struct {
+	kind  string
+	value func() float64
+}
+
+// CounterFunc creates a counter whose value is obtained from a function.
+func CounterFunc(value func() float64) Func {
+	return Func{kind: "counter", value: value}
+}
+
+// GaugeFunc creates a gauge whose value is obtained from a function.
+func GaugeFunc(value func() float64) Func {
+	return Func{kind: "gauge", value: value}
+}
+
+func (f Func) Type() string { return f.kind }
+
+func (f Func) Write(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", name, formatFloat(f.value()))
+	return err
+}
+
+// LabelledFunc is a counter or gauge whose values for each value of a label are obtained
+// when it is collected.
+type LabelledFunc struct {
+	kind   string
+	label  string
+	values func() map[string]float64
+}
+
+// LabelledCounterFunc creates a labelled counter whose values are obtained from a function.
+func LabelledCounterFunc(label string, values func() map[string]float64) LabelledFunc {
+	return LabelledFunc{kind: "counter", label: label, values: values}
+}
+
+func (f LabelledFunc) Type() string { return f.kind }
+
+func (f LabelledFunc) Write(w io.Writer, name string) error {
+	return writeLabelled(w, name, f.label, f.values())
+}
+
+func writeLabelled(w io.Writer, name, label string, values map[string]float64) error {
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		if _, err := fmt.Fprintf(w, "%s{%s=%s} %s\n", name, label, quote(k), formatFloat(values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Histogram counts observations in buckets. If it is nil, its methods are no-ops.
+type Histogram struct {
+	upper  []float64 // the upper bounds of the buckets, ascending
+	counts []int64   // the count in each bucket, not cumulative; the last is +Inf
+	sum    float64
+	mu     sync.Mutex
+}
+
+// NewHistogram creates a histogram with buckets that have the given upper bounds.
+func NewHistogram(buckets ...float64) *Histogram {
+	upper := slices.Clone(buckets)
+	slices.Sort(upper)
+	return &Histogram{upper: upper, counts: make([]int64, len(upper)+1)}
+}
+
+// DefaultSeconds are buckets suitable for durations in seconds.
+var DefaultSeconds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return // no-op if absent
+	}
+
+	i, _ := slices.BinarySearch(h.upper, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+}
+
+func (h *Histogram) Type() string { return "histogram" }
+
+func (h *Histogram) Write(w io.Writer, name string) error {
+	h.mu.Lock()
+	counts := slices.Clone(h.counts)
+	sum := h.sum
+	h.mu.Unlock()
+
+	var cumulative int64
+	for i, count := range counts {
+		cumulative += count
+		le := math.Inf(1)
+		if i < len(h.upper) {
+			le = h.upper[i]
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(le), cumulative); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(sum), name, cumulative)
+	return err
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
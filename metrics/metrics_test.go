@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	served := &metrics.Counter{}
+	served.Add(1500)
+
+	fetches := metrics.NewCounterVec("code")
+	fetches.Inc("200")
+	fetches.Inc("404")
+	fetches.Inc("200")
+
+	latency := metrics.NewHistogram(0.1, 1)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	r := metrics.NewRegistry()
+	r.Register("served_bytes_total", "Bytes served.", served)
+	r.Register("fetches_total", "Fetches.", fetches)
+	r.Register("queue_length", "URLs waiting.", metrics.GaugeFunc(func() float64 { return 7 }))
+	r.Register("responses_total", "Responses.", metrics.LabelledCounterFunc("path", func() map[string]float64 {
+		return map[string]float64{`a"b`: 2}
+	}))
+	r.Register("fetch_seconds", "Fetch time.", latency)
+	r.Register("absent", "Not registered.", (*metrics.Histogram)(nil))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	expect.String(rec.Header().Get("Content-Type")).ToBe(t, metrics.ContentType)
+	expect.String(rec.Body.String()).ToBe(t, strings.TrimLeft(`
+# HELP served_bytes_total Bytes served.
+# TYPE served_bytes_total counter
+served_bytes_total 1500
+# HELP fetches_total Fetches.
+# TYPE fetches_total counter
+fetches_total{code="200"} 2
+fetches_total{code="404"} 1
+# HELP queue_length URLs waiting.
+# TYPE queue_length gauge
+queue_length 7
+# HELP responses_total Responses.
+# TYPE responses_total counter
+responses_total{path="a\"b"} 2
+# HELP fetch_seconds Fetch time.
+# TYPE fetch_seconds histogram
+fetch_seconds_bucket{le="0.1"} 1
+fetch_seconds_bucket{le="1"} 2
+fetch_seconds_bucket{le="+Inf"} 3
+fetch_seconds_sum 3.55
+fetch_seconds_count 3
+`, "\n"))
+}
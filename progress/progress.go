@@ -0,0 +1,210 @@
+// Package progress tracks how far a scraping run has got, and shows it either as a live
+// line in a terminal or as periodic log lines.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rickb777/goscrape2/download/throttle"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/utc"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// Progress counts the work done and to do in a scraping run. It is lock-free and safe for
+// concurrent use. If it is nil, its methods are no-ops.
+type Progress struct {
+	started  time.Time
+	fetched  atomic.Int64
+	queued   atomic.Int64
+	failed   atomic.Int64
+	bytes    atomic.Int64
+	active   atomic.Int64
+	lockdown atomic.Pointer[throttle.Throttle]
+}
+
+// New creates a tracker for a run that is starting now.
+func New() *Progress {
+	return &Progress{started: utc.Now()}
+}
+
+// Watch sets the throttle whose delay is shown.
+func (p *Progress) Watch(lockdown *throttle.Throttle) {
+	if p != nil {
+		p.lockdown.Store(lockdown)
+	}
+}
+
+// SetQueued sets the number of URLs waiting to be fetched.
+func (p *Progress) SetQueued(n int) {
+	if p != nil {
+		p.queued.Store(int64(n))
+	}
+}
+
+// Begin marks a worker as active.
+func (p *Progress) Begin() {
+	if p != nil {
+		p.active.Add(1)
+	}
+}
+
+// End marks a worker as idle.
+func (p *Progress) End() {
+	if p != nil {
+		p.active.Add(-1)
+	}
+}
+
+// AddResult counts a URL that has been fetched. Client and server errors are counted as
+// failures, but not rate limiting, which is retried.
+func (p *Progress) AddResult(result *work.Result) {
+	if p == nil {
+		return // no-op if absent
+	}
+
+	p.fetched.Add(1)
+	p.bytes.Add(result.ContentLength)
+
+	switch {
+	case result.StatusCode == http.StatusTeapot, result.StatusCode == http.StatusTooManyRequests:
+	case result.StatusCode >= 400:
+		p.failed.Add(1)
+	}
+}
+
+// AddFailure counts a URL that could not be fetched at all.
+func (p *Progress) AddFailure() {
+	if p != nil {
+		p.fetched.Add(1)
+		p.failed.Add(1)
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Snapshot is the state of a run at one moment.
+type Snapshot struct {
+	Fetched int64
+	Queued  int64
+	Failed  int64
+	Bytes   int64
+	Active  int64
+	Delay   time.Duration // the current throttle delay
+	Elapsed time.Duration
+}
+
+// Snapshot gets the current state of the run.
+func (p *Progress) Snapshot() Snapshot {
+	if p == nil {
+		return Snapshot{} // no-op if absent
+	}
+
+	return Snapshot{
+		Fetched: p.fetched.Load(),
+		Queued:  p.queued.Load(),
+		Failed:  p.failed.Load(),
+		Bytes:   p.bytes.Load(),
+		Active:  p.active.Load(),
+		Delay:   p.lockdown.Load().Delay(),
+		Elapsed: utc.Now().Sub(p.started),
+	}
+}
+
+// BytesPerSecond is the average transfer rate so far.
+func (s Snapshot) BytesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// ETA estimates the time remaining from the average rate at which URLs have been fetched
+// so far. It is zero if there is no estimate yet.
+func (s Snapshot) ETA() time.Duration {
+	if s.Fetched == 0 || s.Elapsed <= 0 {
+		return 0
+	}
+	perURL := s.Elapsed / time.Duration(s.Fetched)
+	return perURL * time.Duration(s.Queued)
+}
+
+// String formats the snapshot as a single line.
+func (s Snapshot) String() string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "fetched %d, queued %d, failed %d, %s/s, %d active", s.Fetched, s.Queued, s.Failed, formatBytes(s.BytesPerSecond()), s.Active)
+	if s.Delay > 0 {
+		fmt.Fprintf(buf, ", throttled %s", s.Delay.Round(time.Millisecond))
+	}
+	if eta := s.ETA().Round(time.Second); eta > 0 {
+		fmt.Fprintf(buf, ", ETA %s", eta)
+	}
+	return buf.String()
+}
+
+// LogAttrs gets the snapshot as log attributes.
+func (s Snapshot) LogAttrs() []any {
+	return []any{
+		slog.Int64("fetched", s.Fetched),
+		slog.Int64("queued", s.Queued),
+		slog.Int64("failed", s.Failed),
+		slog.Int64("bytesPerSecond", int64(s.BytesPerSecond())),
+		slog.Int64("active", s.Active),
+		slog.String("throttle", s.Delay.Round(time.Millisecond).String()),
+		slog.String("eta", s.ETA().Round(time.Second).String()),
+	}
+}
+
+func formatBytes(n float64) string {
+	const units = "KMGT"
+	if n < 1000 {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	i := -1
+	for n >= 1000 && i < len(units)-1 {
+		n /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f%cB", n, units[i])
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Show displays the progress until the context is done. If the terminal is not nil, it shows
+// a live line that is updated frequently. Otherwise, it logs a line at each interval, unless
+// the interval is zero.
+func (p *Progress) Show(ctx context.Context, term *Terminal, interval time.Duration) {
+	if p == nil || (term == nil && interval <= 0) {
+		return
+	}
+
+	if term != nil {
+		interval = terminalRefresh
+		defer term.Clear()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if term != nil {
+				term.Show(p.Snapshot().String())
+			} else {
+				logger.Info("Progress", p.Snapshot().LogAttrs()...)
+			}
+		}
+	}
+}
+
+// terminalRefresh is the interval between updates of the live line.
+const terminalRefresh = 250 * time.Millisecond
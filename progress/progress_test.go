@@ -0,0 +1,76 @@
+package progress
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/download/throttle"
+	"github.com/rickb777/goscrape2/utc"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func TestProgress(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := utc.Now
+	defer func() { utc.Now = now }()
+	utc.Now = func() time.Time { return t0 }
+
+	lockdown := throttle.New(0, 2*time.Second, time.Second)
+
+	p := New()
+	p.Watch(lockdown)
+	p.Begin()
+	p.Begin()
+	p.End()
+	p.SetQueued(30)
+
+	home := work.Item{URL: &url.URL{Scheme: "https", Host: "example.org", Path: "/"}}
+	p.AddResult(&work.Result{Item: home, StatusCode: 200, ContentLength: 15000})
+	p.AddResult(&work.Result{Item: home, StatusCode: 404})
+	p.AddResult(&work.Result{Item: home, StatusCode: 418})
+	p.AddResult(&work.Result{Item: home, StatusCode: 429})
+	p.AddFailure()
+	lockdown.SlowDown()
+
+	utc.Now = func() time.Time { return t0.Add(10 * time.Second) }
+
+	s := p.Snapshot()
+	expect.Any(s).ToBe(t, Snapshot{Fetched: 5, Queued: 30, Failed: 2, Bytes: 15000, Active: 1, Delay: 2 * time.Second, Elapsed: 10 * time.Second})
+	expect.Number(s.BytesPerSecond()).ToBe(t, 1500.0)
+	expect.Number(s.ETA()).ToBe(t, time.Minute)
+	expect.String(s.String()).ToBe(t, "fetched 5, queued 30, failed 2, 1.5KB/s, 1 active, throttled 2s, ETA 1m0s")
+}
+
+func TestSnapshot_String_atStart(t *testing.T) {
+	expect.String(Snapshot{Queued: 1, Active: 1}.String()).ToBe(t, "fetched 0, queued 1, failed 0, 0B/s, 1 active")
+}
+
+func TestProgress_nil(t *testing.T) {
+	var p *Progress
+	p.Begin()
+	p.SetQueued(3)
+	p.AddFailure()
+	expect.Any(p.Snapshot()).ToBe(t, Snapshot{})
+}
+
+func TestTerminal(t *testing.T) {
+	buf := &strings.Builder{}
+	term := &Terminal{w: buf}
+
+	term.Write([]byte("first\n"))
+	term.Show("fetched 1")
+	term.Write([]byte("second\n"))
+	term.Show("fetched 2")
+	term.Clear()
+	term.Write([]byte("third\n"))
+
+	expect.String(buf.String()).ToBe(t, "first\n"+
+		clearLine+"fetched 1"+
+		clearLine+"second\n"+"fetched 1"+
+		clearLine+"fetched 2"+
+		clearLine+
+		"third\n")
+}
@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// clearLine returns the cursor to the start of the line and erases the line.
+const clearLine = "\r\033[K"
+
+// Terminal is a writer for a terminal that keeps a status line at the bottom. Anything
+// written, such as log lines, appears above the status line. It is safe for concurrent use.
+type Terminal struct {
+	w    io.Writer
+	line string
+	mu   sync.Mutex
+}
+
+// NewTerminal creates a terminal writer, or returns nil if the file is not a terminal.
+func NewTerminal(f *os.File) *Terminal {
+	if !IsTerminal(f) {
+		return nil
+	}
+	return &Terminal{w: f}
+}
+
+// IsTerminal tests whether a file is a terminal (i.e. a character device).
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Write writes data above the status line.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.line == "" {
+		return t.w.Write(p)
+	}
+
+	if _, err := io.WriteString(t.w, clearLine); err != nil {
+		return 0, err
+	}
+
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	_, err = io.WriteString(t.w, t.line)
+	return n, err
+}
+
+// Show replaces the status line.
+func (t *Terminal) Show(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.line = line
+	_, _ = io.WriteString(t.w, clearLine+line)
+}
+
+// Clear removes the status line.
+func (t *Terminal) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.line != "" {
+		t.line = ""
+		_, _ = io.WriteString(t.w, clearLine)
+	}
+}
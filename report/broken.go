@@ -0,0 +1,210 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rickb777/goscrape2/work"
+)
+
+// Link is a hyperlink from one page to another.
+type Link struct {
+	Page string `json:"page"`
+	Text string `json:"text,omitempty"`
+}
+
+// BrokenLink is a URL that gave a 4xx or 5xx response or could not be fetched at all, with
+// all the pages that link to it.
+type BrokenLink struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"` // zero if the request failed
+	Error  string `json:"error,omitempty"`
+	Links  []Link `json:"links"`
+}
+
+// StatusText describes the status, or the error if the request failed.
+func (b BrokenLink) StatusText() string {
+	if b.Status == 0 {
+		return b.Error
+	}
+	return fmt.Sprintf("%d %s", b.Status, http.StatusText(b.Status))
+}
+
+// BrokenLinks collects the links between pages and the URLs that are broken during a crawl.
+// If it is nil, its methods are no-ops.
+type BrokenLinks struct {
+	links  map[string][]Link // keyed by target URL
+	broken map[string]BrokenLink
+	mu     sync.Mutex
+}
+
+// NewBrokenLinks creates an empty collection.
+func NewBrokenLinks() *BrokenLinks {
+	return &BrokenLinks{links: make(map[string][]Link), broken: make(map[string]BrokenLink)}
+}
+
+func keyOf(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	return v.String()
+}
+
+// AddLinks records the links from a downloaded page to all the URLs it references.
+func (b *BrokenLinks) AddLinks(result *work.Result) {
+	if b == nil {
+		return // no-op if absent
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	page := keyOf(result.Item.URL)
+	for _, ref := range result.References {
+		target := keyOf(result.Item.URL.ResolveReference(ref))
+		link := Link{Page: page, Text: result.Links[target].Text}
+		if !slices.Contains(b.links[target], link) {
+			b.links[target] = append(b.links[target], link)
+		}
+	}
+}
+
+// AddResult records the URL of a result if its status shows that it is broken. Skipped
+// items and retries are not broken; a later successful result for a URL clears it.
+func (b *BrokenLinks) AddResult(result *work.Result) {
+	if b == nil || result.StatusCode == http.StatusTeapot || result.StatusCode == http.StatusTooManyRequests {
+		return // no-op if absent or not broken
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := keyOf(result.Item.URL)
+	if result.StatusCode < 400 {
+		delete(b.broken, key)
+	} else {
+		b.broken[key] = BrokenLink{URL: key, Status: result.StatusCode}
+	}
+}
+
+// AddFailure records the URL of an item that could not be fetched.
+func (b *BrokenLinks) AddFailure(item work.Item, err error) {
+	if b == nil {
+		return // no-op if absent
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := keyOf(item.URL)
+	b.broken[key] = BrokenLink{URL: key, Error: err.Error()}
+}
+
+// Broken gets the broken URLs, sorted alphabetically, with the links to them.
+func (b *BrokenLinks) Broken() []BrokenLink {
+	if b == nil {
+		return nil // no-op if absent
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := make([]BrokenLink, 0, len(b.broken))
+	for key, broken := range b.broken {
+		broken.Links = slices.Clone(b.links[key])
+		if broken.Links == nil {
+			broken.Links = []Link{} // e.g. a start page
+		}
+		list = append(list, broken)
+	}
+
+	slices.SortFunc(list, func(a, b BrokenLink) int { return strings.Compare(a.URL, b.URL) })
+	return list
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Write writes the report in a given format, which is CSV, JSON or HTML.
+func (b *BrokenLinks) Write(w io.Writer, format Format) error {
+	switch format {
+	case JSON:
+		return b.writeJSON(w)
+	case HTML:
+		return b.writeHTML(w)
+	default:
+		return b.writeCSV(w)
+	}
+}
+
+// writeCSV writes a row for each link to a broken URL, or a single row without a page if
+// there are no links to it.
+func (b *BrokenLinks) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"url", "status", "error", "page", "text"})
+
+	for _, broken := range b.Broken() {
+		status := ""
+		if broken.Status != 0 {
+			status = strconv.Itoa(broken.Status)
+		}
+
+		links := broken.Links
+		if len(links) == 0 {
+			links = []Link{{}}
+		}
+
+		for _, link := range links {
+			_ = cw.Write([]string{broken.URL, status, broken.Error, link.Page, link.Text})
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (b *BrokenLinks) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b.Broken())
+}
+
+var brokenLinksTemplate = template.Must(template.New("broken").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Broken links</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Broken links</h1>
+{{if .}}<table>
+<thead><tr><th>URL</th><th>Status</th><th>Linked from</th></tr></thead>
+<tbody>
+{{range .}}<tr>
+<td><a href="{{.URL}}">{{.URL}}</a></td>
+<td>{{.StatusText}}</td>
+<td>{{range .Links}}<a href="{{.Page}}">{{.Page}}</a>{{if .Text}} &ldquo;{{.Text}}&rdquo;{{end}}<br>
+{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p>There are no broken links.</p>
+{{end}}</body>
+</html>
+`))
+
+func (b *BrokenLinks) writeHTML(w io.Writer) error {
+	return brokenLinksTemplate.Execute(w, b.Broken())
+}
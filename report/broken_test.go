@@ -0,0 +1,96 @@
+package report
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func brokenLinksFixture() *BrokenLinks {
+	home := mustParseURL("https://example.org/")
+	about := mustParseURL("https://example.org/about/")
+
+	b := NewBrokenLinks()
+	b.AddLinks(&work.Result{
+		Item:       work.Item{URL: home},
+		StatusCode: http.StatusOK,
+		References: []*url.URL{about, mustParseURL("https://example.org/old.html"), mustParseURL("https://example.org/down")},
+		Links:      map[string]work.Link{"https://example.org/old.html": {Text: "Old <news>", Source: "a href"}},
+	})
+	b.AddLinks(&work.Result{
+		Item:       work.Item{URL: about},
+		StatusCode: http.StatusOK,
+		References: []*url.URL{mustParseURL("/old.html#top")},
+	})
+
+	b.AddResult(&work.Result{Item: work.Item{URL: home}, StatusCode: http.StatusOK})
+	b.AddResult(&work.Result{Item: work.Item{URL: about}, StatusCode: http.StatusTeapot})
+	b.AddResult(&work.Result{Item: work.Item{URL: mustParseURL("https://example.org/old.html")}, StatusCode: http.StatusNotFound})
+	b.AddFailure(work.Item{URL: mustParseURL("https://example.org/down")}, errors.New("connection refused"))
+	return b
+}
+
+func TestBrokenLinks_Broken(t *testing.T) {
+	expect.Slice(brokenLinksFixture().Broken()).ToBe(t,
+		BrokenLink{URL: "https://example.org/down", Error: "connection refused", Links: []Link{{Page: "https://example.org/"}}},
+		BrokenLink{URL: "https://example.org/old.html", Status: 404, Links: []Link{
+			{Page: "https://example.org/", Text: "Old <news>"},
+			{Page: "https://example.org/about/"},
+		}},
+	)
+}
+
+func TestBrokenLinks_retried(t *testing.T) {
+	page := mustParseURL("https://example.org/busy.html")
+
+	b := NewBrokenLinks()
+	b.AddResult(&work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusTooManyRequests})
+	b.AddResult(&work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusOK})
+
+	expect.Slice(b.Broken()).ToBeEmpty(t)
+}
+
+func TestBrokenLinks_laterSuccess(t *testing.T) {
+	page := mustParseURL("https://example.org/flaky.html")
+
+	b := NewBrokenLinks()
+	b.AddResult(&work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusServiceUnavailable})
+	b.AddResult(&work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusNotModified})
+
+	expect.Slice(b.Broken()).ToBeEmpty(t)
+}
+
+func TestBrokenLinks_csv(t *testing.T) {
+	buf := &strings.Builder{}
+	err := brokenLinksFixture().Write(buf, CSV)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, `url,status,error,page,text
+https://example.org/down,,connection refused,https://example.org/,
+https://example.org/old.html,404,,https://example.org/,Old <news>
+https://example.org/old.html,404,,https://example.org/about/,
+`)
+}
+
+func TestBrokenLinks_json(t *testing.T) {
+	buf := &strings.Builder{}
+	err := NewBrokenLinks().Write(buf, JSON)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, "[]\n")
+}
+
+func TestBrokenLinks_html(t *testing.T) {
+	buf := &strings.Builder{}
+	err := brokenLinksFixture().Write(buf, HTML)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToContain(t, `<td>404 Not Found</td>`)
+	expect.String(buf.String()).ToContain(t, `<td>connection refused</td>`)
+	expect.String(buf.String()).ToContain(t, `<a href="https://example.org/">https://example.org/</a> &ldquo;Old &lt;news&gt;&rdquo;<br>`)
+}
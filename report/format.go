@@ -0,0 +1,13 @@
+package report
+
+// Format is the file format of a report.
+type Format int
+
+const (
+	CSV     Format = iota // comma-separated values with a header row
+	JSONL                 // one JSON object per line
+	JSON                  // a JSON document
+	HTML                  // a web page
+	DOT                   // a Graphviz graph
+	GraphML               // a GraphML document
+)
@@ -0,0 +1,217 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rickb777/goscrape2/work"
+)
+
+// Edge is a reference from a page to another URL.
+type Edge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Source string `json:"source,omitempty"` // where the reference was found, e.g. "a href"
+}
+
+// Graph collects the links between the URLs seen during a crawl. Its nodes are described by
+// rows, which have a zero status if the URL was not fetched. If the graph is nil, its methods
+// are no-ops.
+type Graph struct {
+	nodes map[string]Row
+	edges map[Edge]struct{}
+	mu    sync.Mutex
+}
+
+// NewGraph creates an empty graph.
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]Row), edges: make(map[Edge]struct{})}
+}
+
+// AddResult records the node for the result of a download.
+func (g *Graph) AddResult(result *work.Result) {
+	if g == nil {
+		return // no-op if absent
+	}
+
+	row := RowOf(result)
+	row.URL = keyOf(result.Item.URL)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nodes[row.URL] = row
+}
+
+// AddLinks records the edges from a downloaded page to all the URLs it references, whether
+// or not they are followed. A retry is not an edge: its only reference is its own URL. The
+// source of an edge is empty if it is not known, e.g. for references in stylesheets.
+func (g *Graph) AddLinks(result *work.Result) {
+	if g == nil || result.StatusCode == http.StatusTooManyRequests {
+		return // no-op if absent or retrying
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	from := keyOf(result.Item.URL)
+	for _, ref := range result.References {
+		to := keyOf(result.Item.URL.ResolveReference(ref))
+
+		source := result.Links[to].Source
+		if source == "" && result.IsRedirect() {
+			source = "redirect"
+		}
+
+		g.edges[Edge{From: from, To: to, Source: source}] = struct{}{}
+
+		if _, exists := g.nodes[to]; !exists {
+			g.nodes[to] = Row{URL: to, Size: -1, Depth: result.Item.Depth + 1}
+		}
+	}
+}
+
+// Nodes gets the nodes, sorted by URL.
+func (g *Graph) Nodes() []Row {
+	if g == nil {
+		return nil // no-op if absent
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nodes := make([]Row, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, node)
+	}
+
+	slices.SortFunc(nodes, func(a, b Row) int { return strings.Compare(a.URL, b.URL) })
+	return nodes
+}
+
+// Edges gets the edges, sorted by their ends.
+func (g *Graph) Edges() []Edge {
+	if g == nil {
+		return nil // no-op if absent
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	edges := make([]Edge, 0, len(g.edges))
+	for edge := range g.edges {
+		edges = append(edges, edge)
+	}
+
+	slices.SortFunc(edges, func(a, b Edge) int {
+		if c := strings.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.To, b.To); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Source, b.Source)
+	})
+	return edges
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Write writes the graph in a given format, which is DOT, GraphML or JSON.
+func (g *Graph) Write(w io.Writer, format Format) error {
+	switch format {
+	case JSON:
+		return g.writeJSON(w)
+	case GraphML:
+		return g.writeGraphML(w)
+	default:
+		return g.writeDOT(w)
+	}
+}
+
+func (g *Graph) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes []Row  `json:"nodes"`
+		Edges []Edge `json:"edges"`
+	}{Nodes: g.Nodes(), Edges: g.Edges()})
+}
+
+// writeDOT writes the graph for Graphviz. The URLs that were not fetched are dashed.
+func (g *Graph) writeDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph crawl {")
+	fmt.Fprintln(bw, "  node [shape=box];")
+
+	for _, node := range g.Nodes() {
+		fmt.Fprintf(bw, "  %s [status=%d, depth=%d, type=%s, size=%d", dotQuote(node.URL), node.Status, node.Depth, dotQuote(node.ContentType), node.Size)
+		if node.Status == 0 {
+			fmt.Fprint(bw, ", style=dashed")
+		}
+		fmt.Fprintln(bw, "];")
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(bw, "  %s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Source))
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+const graphMLHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="url" for="node" attr.name="url" attr.type="string"/>
+  <key id="status" for="node" attr.name="status" attr.type="int"/>
+  <key id="depth" for="node" attr.name="depth" attr.type="int"/>
+  <key id="type" for="node" attr.name="type" attr.type="string"/>
+  <key id="size" for="node" attr.name="size" attr.type="long"/>
+  <key id="source" for="edge" attr.name="source" attr.type="string"/>
+  <graph id="crawl" edgedefault="directed">
+`
+
+const graphMLFooter = `  </graph>
+</graphml>
+`
+
+// writeGraphML writes the graph as GraphML, with the URLs as node data because they are
+// not valid XML IDs.
+func (g *Graph) writeGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(graphMLHeader)
+
+	ids := make(map[string]string)
+	for i, node := range g.Nodes() {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.URL] = id
+		fmt.Fprintf(bw, `    <node id="%s"><data key="url">%s</data><data key="status">%d</data><data key="depth">%d</data><data key="type">%s</data><data key="size">%d</data></node>`+"\n",
+			id, xmlEscape(node.URL), node.Status, node.Depth, xmlEscape(node.ContentType), node.Size)
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(bw, `    <edge source="%s" target="%s"><data key="source">%s</data></edge>`+"\n",
+			ids[edge.From], ids[edge.To], xmlEscape(edge.Source))
+	}
+
+	bw.WriteString(graphMLFooter)
+	return bw.Flush()
+}
+
+func xmlEscape(s string) string {
+	buf := &strings.Builder{}
+	_ = xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,121 @@
+package report
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func graphFixture() *Graph {
+	home := mustParseURL("https://example.org/")
+	style := mustParseURL("https://example.org/style.css")
+
+	g := NewGraph()
+
+	homeResult := &work.Result{
+		Item:          work.Item{URL: home},
+		StatusCode:    http.StatusOK,
+		ContentType:   "text/html",
+		ContentLength: 1234,
+		References:    []*url.URL{style, mustParseURL("https://example.org/a&b.html#top")},
+		Links: map[string]work.Link{
+			"https://example.org/style.css": {Source: "link href"},
+			"https://example.org/a&b.html":  {Text: "A & B", Source: "a href"},
+		},
+	}
+	g.AddResult(homeResult)
+	g.AddLinks(homeResult)
+
+	styleResult := &work.Result{
+		Item:        work.Item{URL: style, Depth: 1},
+		StatusCode:  http.StatusOK,
+		ContentType: "text/css",
+		References:  []*url.URL{mustParseURL("/bg.png")},
+	}
+	g.AddResult(styleResult)
+	g.AddLinks(styleResult)
+
+	return g
+}
+
+func TestGraph_nodes_and_edges(t *testing.T) {
+	g := graphFixture()
+
+	expect.Slice(g.Nodes()).ToBe(t,
+		Row{URL: "https://example.org/", Status: 200, ContentType: "text/html", Size: 1234},
+		Row{URL: "https://example.org/a&b.html", Size: -1, Depth: 1},
+		Row{URL: "https://example.org/bg.png", Size: -1, Depth: 2},
+		Row{URL: "https://example.org/style.css", Status: 200, ContentType: "text/css", Depth: 1},
+	)
+
+	expect.Slice(g.Edges()).ToBe(t,
+		Edge{From: "https://example.org/", To: "https://example.org/a&b.html", Source: "a href"},
+		Edge{From: "https://example.org/", To: "https://example.org/style.css", Source: "link href"},
+		Edge{From: "https://example.org/style.css", To: "https://example.org/bg.png"},
+	)
+}
+
+func TestGraph_retried(t *testing.T) {
+	page := mustParseURL("https://example.org/busy.html")
+
+	g := NewGraph()
+	retry := &work.Result{
+		Item:       work.Item{URL: page},
+		StatusCode: http.StatusTooManyRequests,
+		References: []*url.URL{page},
+	}
+	g.AddResult(retry)
+	g.AddLinks(retry)
+
+	expect.Slice(g.Edges()).ToBeEmpty(t)
+	expect.Slice(g.Nodes()).ToHaveLength(t, 1)
+}
+
+func TestGraph_dot(t *testing.T) {
+	buf := &strings.Builder{}
+	err := graphFixture().Write(buf, DOT)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, `digraph crawl {
+  node [shape=box];
+  "https://example.org/" [status=200, depth=0, type="text/html", size=1234];
+  "https://example.org/a&b.html" [status=0, depth=1, type="", size=-1, style=dashed];
+  "https://example.org/bg.png" [status=0, depth=2, type="", size=-1, style=dashed];
+  "https://example.org/style.css" [status=200, depth=1, type="text/css", size=0];
+  "https://example.org/" -> "https://example.org/a&b.html" [label="a href"];
+  "https://example.org/" -> "https://example.org/style.css" [label="link href"];
+  "https://example.org/style.css" -> "https://example.org/bg.png" [label=""];
+}
+`)
+}
+
+func TestGraph_graphml(t *testing.T) {
+	buf := &strings.Builder{}
+	err := graphFixture().Write(buf, GraphML)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToContain(t, `<node id="n1"><data key="url">https://example.org/a&amp;b.html</data><data key="status">0</data><data key="depth">1</data><data key="type"></data><data key="size">-1</data></node>`)
+	expect.String(buf.String()).ToContain(t, `<edge source="n3" target="n2"><data key="source"></data></edge>`)
+	expect.String(buf.String()).ToContain(t, "</graphml>\n")
+}
+
+func TestGraph_json(t *testing.T) {
+	buf := &strings.Builder{}
+	err := graphFixture().Write(buf, JSON)
+
+	expect.Error(err).ToBeNil(t)
+	expect.String(buf.String()).ToContain(t, `"nodes": [`)
+	expect.String(buf.String()).ToContain(t, `"from": "https://example.org/style.css",
+      "to": "https://example.org/bg.png"
+    }`)
+}
+
+func TestGraph_nil(t *testing.T) {
+	var g *Graph
+	g.AddResult(&work.Result{Item: work.Item{URL: mustParseURL("https://example.org/")}})
+	expect.Slice(g.Nodes()).ToBeEmpty(t)
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/rickb777/goscrape2/work"
+)
+
+// Row describes a URL reached by a crawl.
+type Row struct {
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"type,omitempty"`
+	Size        int64  `json:"size"` // -1 if unknown
+	Depth       int    `json:"depth"`
+}
+
+var csvHeader = []string{"url", "status", "type", "size", "depth"}
+
+// Listing writes a row for every URL reached by a crawl. If the listing is nil, its methods
+// are no-ops.
+type Listing struct {
+	format  Format
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+	err     error
+	mu      sync.Mutex
+}
+
+// NewListing creates a listing that writes in a given format, which is CSV or JSONL.
+func NewListing(w io.Writer, format Format) *Listing {
+	if format == JSONL {
+		return &Listing{format: format, json: json.NewEncoder(w)}
+	}
+	return &Listing{format: format, csv: csv.NewWriter(w)}
+}
+
+// RowOf gets the row describing the result of a download.
+func RowOf(result *work.Result) Row {
+	size := result.ContentLength
+	if result.Unread != 0 {
+		size = result.Unread // the body was not read, but its length may have been declared
+	} else if size == 0 && result.StatusCode != http.StatusOK {
+		size = -1 // nothing was received, so the size of the resource is not known
+	}
+	return Row{
+		URL:         result.Item.URL.String(),
+		Status:      result.StatusCode,
+		ContentType: result.ContentType,
+		Size:        size,
+		Depth:       result.Item.Depth,
+	}
+}
+
+// Add writes the row for the result of a download. Any error is reported by Flush.
+func (l *Listing) Add(result *work.Result) {
+	if l == nil {
+		return // no-op if absent
+	}
+
+	row := RowOf(result)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return
+	}
+
+	if l.format == JSONL {
+		l.err = l.json.Encode(row)
+		return
+	}
+
+	if !l.started {
+		l.started = true
+		l.err = l.csv.Write(csvHeader)
+	}
+
+	size := ""
+	if row.Size >= 0 {
+		size = strconv.FormatInt(row.Size, 10)
+	}
+
+	if l.err == nil {
+		l.err = l.csv.Write([]string{row.URL, strconv.Itoa(row.Status), row.ContentType, size, strconv.Itoa(row.Depth)})
+	}
+}
+
+// Flush ensures all the rows have been written, returning the first error, if any.
+func (l *Listing) Flush() error {
+	if l == nil {
+		return nil // no-op if absent
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.csv != nil && l.err == nil {
+		if !l.started {
+			l.started = true
+			l.err = l.csv.Write(csvHeader)
+		}
+		l.csv.Flush()
+		l.err = l.csv.Error()
+	}
+
+	return l.err
+}
@@ -0,0 +1,63 @@
+package report
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, e := url.Parse(s)
+	if e != nil {
+		panic(e)
+	}
+	return u
+}
+
+var results = []*work.Result{
+	{Item: work.Item{URL: mustParseURL("https://example.org/")}, StatusCode: http.StatusOK, ContentType: "text/html", ContentLength: 1234},
+	{Item: work.Item{URL: mustParseURL("https://example.org/a,b.pdf"), Depth: 1}, StatusCode: http.StatusOK, ContentType: "application/pdf", Unread: -1},
+	{Item: work.Item{URL: mustParseURL("https://example.org/big.zip"), Depth: 1}, StatusCode: http.StatusOK, ContentType: "application/zip", Unread: 10000},
+	{Item: work.Item{URL: mustParseURL("https://example.org/gone"), Depth: 1}, StatusCode: http.StatusNotFound},
+}
+
+func TestListing_csv(t *testing.T) {
+	buf := &strings.Builder{}
+	listing := NewListing(buf, CSV)
+	for _, result := range results {
+		listing.Add(result)
+	}
+
+	expect.Error(listing.Flush()).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, `url,status,type,size,depth
+https://example.org/,200,text/html,1234,0
+"https://example.org/a,b.pdf",200,application/pdf,,1
+https://example.org/big.zip,200,application/zip,10000,1
+https://example.org/gone,404,,,1
+`)
+}
+
+func TestListing_jsonl(t *testing.T) {
+	buf := &strings.Builder{}
+	listing := NewListing(buf, JSONL)
+	for _, result := range results {
+		listing.Add(result)
+	}
+
+	expect.Error(listing.Flush()).ToBeNil(t)
+	expect.String(buf.String()).ToBe(t, `{"url":"https://example.org/","status":200,"type":"text/html","size":1234,"depth":0}
+{"url":"https://example.org/a,b.pdf","status":200,"type":"application/pdf","size":-1,"depth":1}
+{"url":"https://example.org/big.zip","status":200,"type":"application/zip","size":10000,"depth":1}
+{"url":"https://example.org/gone","status":404,"size":-1,"depth":1}
+`)
+}
+
+func TestListing_nil(t *testing.T) {
+	var listing *Listing
+	listing.Add(results[0])
+	expect.Error(listing.Flush()).ToBeNil(t)
+}
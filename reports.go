@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/events"
+	"github.com/rickb777/goscrape2/explain"
+	"github.com/rickb777/goscrape2/linkcheck"
+	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/progress"
+	"github.com/rickb777/goscrape2/report"
+	"github.com/rickb777/goscrape2/scraper"
+	"github.com/rickb777/goscrape2/stats"
+	"github.com/rickb777/goscrape2/work"
+	"github.com/spf13/afero"
+)
+
+// reports are the records of a scraping run, which are completed when it finishes, and the
+// display of its progress.
+type reports struct {
+	trail        *explain.Trail
+	listing      *report.Listing
+	listingFile  io.WriteCloser
+	broken       *report.BrokenLinks
+	brokenFile   string
+	brokenFormat report.Format
+	graph        *report.Graph
+	graphFile    string
+	graphFormat  report.Format
+	runs         []*stats.Stats
+	runsFile     string
+	external     *linkcheck.Checker
+	events       *events.Stream
+	term         *progress.Terminal
+	interval     time.Duration
+}
+
+func openReports(args Arguments, term *progress.Terminal) (*reports, error) {
+	r := &reports{
+		term:         term,
+		interval:     args.Progress,
+		trail:        explain.New(),
+		brokenFile:   args.BrokenLinks,
+		brokenFormat: reportFormat(args.BrokenFormat.Value),
+		graphFile:    args.Graph,
+		graphFormat:  reportFormat(args.GraphFormat.Value),
+		runsFile:     args.Report,
+	}
+
+	if args.Spider != "" {
+		f, err := createOutput(args.Spider)
+		if err != nil {
+			return nil, fmt.Errorf("spider: %w", err)
+		}
+		r.listingFile = f
+		r.listing = report.NewListing(f, reportFormat(args.SpiderFormat.Value))
+	}
+
+	if args.Events != "" {
+		stream, err := events.Open(args.Events)
+		if err != nil {
+			return nil, fmt.Errorf("events: %w", err)
+		}
+		r.events = stream
+	}
+
+	if args.BrokenLinks != "" {
+		r.broken = report.NewBrokenLinks()
+	}
+
+	if args.Graph != "" {
+		r.graph = report.NewGraph()
+	}
+
+	return r, nil
+}
+
+// startExternal starts checking the links to other hosts, if enabled.
+func (r *reports) startExternal(ctx context.Context, cfg config.Config, store *db.DB) {
+	if !cfg.External.Enabled {
+		return
+	}
+
+	client := &http.Client{
+		Timeout: cfg.RequestTimeout,
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	r.external = linkcheck.New(cfg.External, client, store)
+	r.external.UserAgent = cfg.UserAgent
+	r.external.Start(ctx)
+}
+
+// attach makes a scraper contribute to the reports.
+func (r *reports) attach(sc *scraper.Scraper) {
+	sc.Trail = r.trail
+	sc.Listing = r.listing
+	sc.Broken = r.broken
+	sc.Graph = r.graph
+	sc.External = r.external
+	sc.Progress = progress.New()
+	sc.Events = r.events.For(sc.URL.String())
+	r.runs = append(r.runs, sc.Stats)
+}
+
+// showProgress shows the progress of a scraper until the returned function is called.
+func (r *reports) showProgress(ctx context.Context, sc *scraper.Scraper) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		sc.Progress.Show(ctx, r.term, r.interval)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// finish waits for any links to other hosts to be checked, then writes the reports.
+func (r *reports) finish(fs afero.Fs) {
+	for _, result := range r.external.Wait() {
+		r.trail.RecordStatus(result.URL, result.Status)
+		if result.Err != nil {
+			r.broken.AddFailure(work.Item{URL: result.URL}, result.Err)
+		} else {
+			r.broken.AddResult(&work.Result{Item: work.Item{URL: result.URL}, StatusCode: result.Status})
+		}
+	}
+
+	if err := r.trail.Save(fs, db.StateDir()); err != nil {
+		logger.Warn("Cannot save explain trail", slog.Any("error", err))
+	}
+
+	if r.listing != nil {
+		if err := errors.Join(r.listing.Flush(), r.listingFile.Close()); err != nil {
+			logger.Error("Cannot write spider list", slog.Any("error", err))
+		}
+	}
+
+	if r.broken != nil {
+		if err := writeOutput(r.brokenFile, func(w io.Writer) error { return r.broken.Write(w, r.brokenFormat) }); err != nil {
+			logger.Error("Cannot write broken links report", slog.String("file", r.brokenFile), slog.Any("error", err))
+		}
+	}
+
+	summaries := make([]stats.Summary, len(r.runs))
+	for i, run := range r.runs {
+		summaries[i] = run.Summary()
+		reportHistogram(summaries[i])
+	}
+
+	if r.runsFile != "" {
+		if err := writeOutput(r.runsFile, func(w io.Writer) error { return writeRunReport(w, summaries) }); err != nil {
+			logger.Error("Cannot write report", slog.String("file", r.runsFile), slog.Any("error", err))
+		}
+	}
+
+	if err := r.events.Close(); err != nil {
+		logger.Error("Cannot close event stream", slog.Any("error", err))
+	}
+
+	if r.graph != nil {
+		if err := writeOutput(r.graphFile, func(w io.Writer) error { return r.graph.Write(w, r.graphFormat) }); err != nil {
+			logger.Error("Cannot write link graph", slog.String("file", r.graphFile), slog.Any("error", err))
+		}
+	}
+}
+
+// writeRunReport writes the statistics of each start URL's run as a JSON document.
+func writeRunReport(w io.Writer, summaries []stats.Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Version string          `json:"version"`
+		Runs    []stats.Summary `json:"runs"`
+	}{Version: version, Runs: summaries})
+}
+
+func reportFormat(value string) report.Format {
+	switch value {
+	case "jsonl":
+		return report.JSONL
+	case "json":
+		return report.JSON
+	case "html":
+		return report.HTML
+	case "dot":
+		return report.DOT
+	case "graphml":
+		return report.GraphML
+	default:
+		return report.CSV
+	}
+}
+
+// createOutput creates a file, or uses stdout if the name is "-".
+func createOutput(fileName string) (io.WriteCloser, error) {
+	if fileName == "-" {
+		return nopCloser{Writer: os.Stdout}, nil
+	}
+	return os.Create(fileName)
+}
+
+func writeOutput(fileName string, write func(w io.Writer) error) error {
+	f, err := createOutput(fileName)
+	if err != nil {
+		return err
+	}
+	return errors.Join(write(f), f.Close())
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -1,19 +1,50 @@
 package scraper
 
 import (
-	"github.com/rickb777/goscrape2/work"
+	"fmt"
+	"net/http"
 	"net/url"
+
+	"github.com/rickb777/goscrape2/events"
+	"github.com/rickb777/goscrape2/explain"
+	"github.com/rickb777/goscrape2/filter"
+	"github.com/rickb777/goscrape2/work"
 )
 
-// shouldURLBeDownloaded checks whether a page should be downloaded.
+// shouldURLBeDownloaded checks whether a page should be downloaded, recording the decision
+// in the trail. Links to other hosts are checked instead, if enabled. The referrer is nil for
+// start pages.
+func (sc *Scraper) shouldURLBeDownloaded(item, referrer *url.URL, depth int) bool {
+	reason, detail := sc.decide(item, depth)
+	sc.Trail.Record(item, referrer, depth, reason, detail)
+	if reason == explain.OffHost {
+		sc.External.Check(item)
+	}
+	if !reason.IsCrawled() && reason != explain.Duplicate {
+		sc.emitSkipped(item, referrer, reason, detail)
+	}
+	return reason.IsCrawled()
+}
+
+// emitSkipped emits an event for a reference that is not crawled.
+func (sc *Scraper) emitSkipped(item, referrer *url.URL, reason explain.Reason, detail string) {
+	event := events.Skipped{URL: item.String(), Reason: reason.Name(), Detail: detail}
+	if referrer != nil {
+		event.URL = referrer.ResolveReference(item).String()
+		event.Referrer = referrer.String()
+	}
+	sc.Events.Skipped(event)
+}
+
+// decide works out whether a page should be downloaded, and why.
 // nolint: cyclop
-func (sc *Scraper) shouldURLBeDownloaded(item *url.URL, depth int) bool {
+func (sc *Scraper) decide(item *url.URL, depth int) (explain.Reason, string) {
 	if item.Scheme == "" && item.Host == "" {
-		return true
+		return explain.Relative, ""
 	}
 
 	if item.Scheme != "http" && item.Scheme != "https" {
-		return false
+		return explain.NotHTTP, item.Scheme
 	}
 
 	p := item.String()
@@ -25,33 +56,47 @@ func (sc *Scraper) shouldURLBeDownloaded(item *url.URL, depth int) bool {
 	}
 
 	if !sc.processed.AddIfAbsent(p) { // was already downloaded or checked?
-		return false
+		return explain.Duplicate, p
 	}
 
 	if item.Host != sc.URL.Host {
-		return false
+		return explain.OffHost, item.Host
 	}
 
 	if depth > sc.config.MaxDepth {
-		return false
+		return explain.TooDeep, fmt.Sprintf("limit %d", sc.config.MaxDepth)
 	}
 
-	if sc.includes.Present() && !sc.includes.Matches(item, "Including URL") {
-		return false
+	rule, found := sc.config.Rules.Match(item)
+	switch {
+	case !found || rule.Action != filter.Skip:
+		return explain.Crawled, ""
+	case rule.MatchesAll():
+		return explain.NotIncluded, ""
+	default:
+		return explain.Excluded, rule.String()
 	}
-
-	if sc.excludes.Present() && sc.excludes.Matches(item, "Skipping URL") {
-		return false
-	}
-
-	return true
 }
 
+// partitionResult separates the references that should be downloaded from the rest. None of
+// the links in a page are followed if a rule says so, but redirections and retries still are.
 func (sc *Scraper) partitionResult(result *work.Result, depth int) {
+	if hasContent(result.StatusCode) {
+		if rule, found := sc.config.Rules.Match(result.Item.URL); found && rule.Action == filter.NoFollow {
+			for _, ref := range result.References {
+				sc.Trail.Record(ref, result.Item.URL, depth, explain.NotFollowed, rule.String())
+				sc.emitSkipped(ref, result.Item.URL, explain.NotFollowed, rule.String())
+			}
+			result.Excluded = append(result.Excluded, result.References...)
+			result.References = nil
+			return
+		}
+	}
+
 	included := make([]*url.URL, 0, len(result.References))
 
 	for _, ref := range result.References {
-		if sc.shouldURLBeDownloaded(ref, depth) {
+		if sc.shouldURLBeDownloaded(ref, result.Item.URL, depth) {
 			included = append(included, ref)
 		} else {
 			result.Excluded = append(result.Excluded, ref)
@@ -60,3 +105,11 @@ func (sc *Scraper) partitionResult(result *work.Result, depth int) {
 
 	result.References = included
 }
+
+func hasContent(statusCode int) bool {
+	switch statusCode {
+	case http.StatusOK, http.StatusNotModified, http.StatusTeapot:
+		return true
+	}
+	return false
+}
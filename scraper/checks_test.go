@@ -3,15 +3,18 @@ package scraper
 import (
 	"fmt"
 	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/explain"
 	"github.com/rickb777/goscrape2/filter"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/stubclient"
+	"github.com/rickb777/goscrape2/work"
 	"github.com/rickb777/servefiles/v3"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"sync"
 	"testing"
 )
@@ -51,27 +54,90 @@ func TestShouldURLBeDownloaded(t *testing.T) {
 	expect.Any(scraper).Not().ToBeNil(t)
 
 	scraper.processed.Add("/ok/done")
-	scraper.includes, _ = filter.New([]string{"/ok"})
-	scraper.excludes, _ = filter.New([]string{"/../bad"})
+	scraper.config.Rules = filter.IncludeExclude([]*regexp.Regexp{regexp.MustCompile("/ok")}, []*regexp.Regexp{regexp.MustCompile("/../bad")})
+
+	scraper.Trail = explain.New()
+	referrer := mustParseURL("https://example.org/")
 
 	cases := []struct {
 		item     *url.URL
 		depth    int
 		expected bool
+		reason   explain.Reason
 	}{
-		{item: mustParseURL("http://example.org/ok/wanted"), expected: true},
-		{item: mustParseURL("http://example.org/ok/nottoodeep"), depth: 10, expected: true},
-		{item: mustParseURL("http://example.org/ok/toodeep"), depth: 11, expected: false},
-		{item: mustParseURL("http://example.org/oktoodeep"), depth: 12, expected: false},
-		{item: mustParseURL("http://example.org/other"), depth: 1, expected: false},
-		{item: mustParseURL("ftp://example.org/ok"), expected: false},
-		{item: mustParseURL("https://example.org/ok/done"), expected: false},
-		{item: mustParseURL("https://other.org/ok"), expected: false},
-		{item: mustParseURL("https://example.org/ok/bad"), expected: false},
+		{item: mustParseURL("http://example.org/ok/wanted"), expected: true, reason: explain.Crawled},
+		{item: mustParseURL("http://example.org/ok/nottoodeep"), depth: 10, expected: true, reason: explain.Crawled},
+		{item: mustParseURL("http://example.org/ok/toodeep"), depth: 11, expected: false, reason: explain.TooDeep},
+		{item: mustParseURL("http://example.org/oktoodeep"), depth: 12, expected: false, reason: explain.TooDeep},
+		{item: mustParseURL("http://example.org/other"), depth: 1, expected: false, reason: explain.NotIncluded},
+		{item: mustParseURL("ftp://example.org/ok"), expected: false, reason: explain.NotHTTP},
+		{item: mustParseURL("https://example.org/ok/done"), expected: false, reason: explain.Duplicate},
+		{item: mustParseURL("https://other.org/ok"), expected: false, reason: explain.OffHost},
+		{item: mustParseURL("https://example.org/ok/bad"), expected: false, reason: explain.Excluded},
 	}
 
 	for _, c := range cases {
-		result := scraper.shouldURLBeDownloaded(c.item, c.depth)
+		result := scraper.shouldURLBeDownloaded(c.item, referrer, c.depth)
 		expect.Bool(result).I(c.item.String()).ToBe(t, c.expected)
+
+		entry, found := scraper.Trail.Lookup(c.item)
+		expect.Bool(found).I(c.item.String()).ToBeTrue(t)
+		expect.Number(entry.Reason).I(c.item.String()).ToBe(t, c.reason)
+		expect.String(entry.Referrer).I(c.item.String()).ToBe(t, "https://example.org/")
 	}
 }
+
+func TestPartitionResult_rules(t *testing.T) {
+	setup()
+
+	stub := &stubclient.Client{}
+	scraper := newTestScraper(t, "https://example.org/", stub)
+
+	rule1, _ := filter.ParseRule("skip query glob:utm_*")
+	rule2, _ := filter.ParseRule("nofollow path glob:/archive/**")
+	scraper.config.Rules = filter.Rules{rule1, rule2}
+	scraper.Trail = explain.New()
+
+	page := work.Result{
+		Item:       work.Item{URL: mustParseURL("https://example.org/news/")},
+		StatusCode: http.StatusOK,
+		References: []*url.URL{
+			mustParseURL("https://example.org/news/a.html"),
+			mustParseURL("https://example.org/news/b.html?utm_source=feed"),
+			mustParseURL("https://example.org/archive/2020/"),
+		},
+	}
+
+	scraper.partitionResult(&page, 1)
+
+	expect.Slice(page.References).ToBe(t,
+		mustParseURL("https://example.org/news/a.html"),
+		mustParseURL("https://example.org/archive/2020/"))
+	expect.Slice(page.Excluded).ToBe(t, mustParseURL("https://example.org/news/b.html?utm_source=feed"))
+
+	archive := work.Result{
+		Item:       work.Item{URL: mustParseURL("https://example.org/archive/2020/")},
+		StatusCode: http.StatusOK,
+		References: []*url.URL{mustParseURL("https://example.org/archive/2020/jan.html")},
+	}
+
+	scraper.partitionResult(&archive, 2)
+
+	expect.Slice(archive.References).ToBeEmpty(t)
+
+	entry, _ := scraper.Trail.Lookup(mustParseURL("https://example.org/archive/2020/jan.html"))
+	expect.Number(entry.Reason).ToBe(t, explain.NotFollowed)
+	expect.String(entry.Detail).ToBe(t, "nofollow path glob:/archive/**")
+	expect.Slice(archive.Excluded).ToBe(t, mustParseURL("https://example.org/archive/2020/jan.html"))
+
+	// redirections are still followed
+	redirect := work.Result{
+		Item:       work.Item{URL: mustParseURL("https://example.org/archive/old")},
+		StatusCode: http.StatusMovedPermanently,
+		References: []*url.URL{mustParseURL("https://example.org/news/c.html")},
+	}
+
+	scraper.partitionResult(&redirect, 2)
+
+	expect.Slice(redirect.References).ToBe(t, mustParseURL("https://example.org/news/c.html"))
+}
@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"time"
+
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// feedEntries tracks the entries referenced by feeds, so that the time of the newest entry
+// of a feed is only stored once all its entries have been fetched. Otherwise, feed-driven
+// updates would skip any entries that failed in later runs. It is used only by the goroutine
+// that handles the results, so it needs no locking.
+type feedEntries struct {
+	etags   *db.DB
+	entries map[string]*pendingFeed // keyed by entry URL
+}
+
+type pendingFeed struct {
+	url     *urlpkg.URL
+	latest  time.Time
+	pending int
+	failed  bool
+}
+
+func newFeedEntries(etags *db.DB) *feedEntries {
+	return &feedEntries{etags: etags, entries: make(map[string]*pendingFeed)}
+}
+
+// add starts tracking the entries of a feed, which are the references that were queued.
+func (fe *feedEntries) add(result *work.Result) {
+	if result.FeedLatest.IsZero() {
+		return // not a feed, or it has no new entries
+	}
+
+	feed := &pendingFeed{url: result.Item.URL, latest: result.FeedLatest}
+	for _, ref := range result.References {
+		key := ref.String()
+		if _, exists := fe.entries[key]; !exists {
+			fe.entries[key] = feed
+			feed.pending++
+		}
+	}
+
+	if feed.pending == 0 {
+		fe.store(feed) // nothing to wait for
+	}
+}
+
+// done records the result of fetching an entry. When it is the last entry of its feed, the
+// time of the newest entry is stored, unless any of the entries failed.
+func (fe *feedEntries) done(result *work.Result) {
+	key := result.Item.URL.String()
+	feed, found := fe.entries[key]
+	if !found || result.StatusCode == http.StatusTooManyRequests {
+		return // not an entry, or it will be tried again
+	}
+
+	delete(fe.entries, key)
+	if result.StatusCode >= 400 && result.StatusCode != http.StatusTeapot {
+		feed.failed = true
+	}
+
+	feed.pending--
+	if feed.pending == 0 && !feed.failed {
+		fe.store(feed)
+	}
+}
+
+// store updates the record of a feed. There is none if the state database was unavailable or
+// the feed was not fetched, in which case there is nothing to update.
+func (fe *feedEntries) store(feed *pendingFeed) {
+	metadata := fe.etags.Lookup(feed.url)
+	if metadata.Code != 0 && feed.latest.After(metadata.Latest) {
+		metadata.Latest = feed.latest
+		fe.etags.Store(feed.url, metadata)
+	}
+}
@@ -16,8 +16,13 @@ import (
 	"github.com/rickb777/goscrape2/db"
 	"github.com/rickb777/goscrape2/download"
 	"github.com/rickb777/goscrape2/download/throttle"
-	"github.com/rickb777/goscrape2/filter"
+	"github.com/rickb777/goscrape2/events"
+	"github.com/rickb777/goscrape2/explain"
+	"github.com/rickb777/goscrape2/linkcheck"
 	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/progress"
+	"github.com/rickb777/goscrape2/report"
+	"github.com/rickb777/goscrape2/stats"
 	"github.com/rickb777/goscrape2/utc"
 	"github.com/rickb777/goscrape2/work"
 	"github.com/rickb777/process/v2"
@@ -35,14 +40,35 @@ type Scraper struct {
 	Client download.HttpClient
 	Fs     afero.Fs // filesystem
 
-	includes filter.Filter
-	excludes filter.Filter
-
 	// key is the URL of page or asset
 	processed *work.Set[string]
 
 	// ETagsDB stores ETags (hashes of file state) for each URL
 	ETagsDB *db.DB
+
+	// Trail records why each URL was or wasn't crawled
+	Trail *explain.Trail
+
+	// Listing lists every URL reached, in spider mode
+	Listing *report.Listing
+
+	// Broken collects the broken links
+	Broken *report.BrokenLinks
+
+	// Graph collects the links between URLs
+	Graph *report.Graph
+
+	// External checks the links to other hosts
+	External *linkcheck.Checker
+
+	// Stats collects the statistics of this scraper's run
+	Stats *stats.Stats
+
+	// Progress tracks how far the run has got
+	Progress *progress.Progress
+
+	// Events receives the events of the crawl as they happen
+	Events *events.Crawl
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -73,10 +99,8 @@ func New(cfg config.Config, url *urlpkg.URL, fs afero.Fs) (*Scraper, error) {
 		Client: client,
 		Fs:     fs, // filesystem can be replaced with in-memory filesystem for testing
 
-		includes: cfg.Includes,
-		excludes: cfg.Excludes,
-
 		processed: work.NewSet[string](),
+		Stats:     stats.New(url),
 	}
 
 	if s.config.Username != "" {
@@ -117,25 +141,47 @@ func (sc *Scraper) Downloader() *download.Download {
 		Auth:      sc.auth,
 		Client:    sc.Client,
 		Fs:        afero.NewBasePathFs(sc.Fs, sc.URL.Host),
-		Lockdown:  throttle.New(0, 10*time.Second, 2*time.Second),
-		LoopDelay: throttle.New(sc.config.LoopDelay, time.Millisecond, time.Millisecond/2),
+		Lockdown:  throttle.New(0, 10*time.Second, 2*time.Second).Named("lockdown"),
+		LoopDelay: throttle.New(sc.config.LoopDelay, time.Millisecond, time.Millisecond/2).Named("loopdelay"),
+		Stats:     sc.Stats,
+		Events:    sc.Events,
 	}
 }
 
 //-------------------------------------------------------------------------------------------------
 
 // Start starts the scraping.
-func (sc *Scraper) Start(ctx context.Context) error {
+func (sc *Scraper) Start(ctx context.Context) (err error) {
+	sc.Stats.Begin()
+	defer sc.Stats.End()
+
+	started := utc.Now()
+	sc.Events.CrawlStarted()
+	defer func() {
+		finished := events.CrawlFinished{Seconds: utc.Now().Sub(started).Seconds()}
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		sc.Events.CrawlFinished(finished)
+	}()
+
 	d := sc.Downloader()
+	sc.Progress.Watch(d.Lockdown)
 
 	firstItem := work.Item{URL: sc.URL}
 
-	if !sc.shouldURLBeDownloaded(firstItem.URL, 0) {
+	if !sc.shouldURLBeDownloaded(firstItem.URL, nil, 0) {
 		return fmt.Errorf("start page is excluded from downloading: %s", firstItem.URL)
 	}
 
+	sc.Events.Queued(events.Queued{URL: firstItem.URL.String()})
+
+	sc.Progress.Begin()
 	redirect, firstResult, err := d.ProcessURL(ctx, firstItem)
+	sc.Progress.End()
 	if err != nil {
+		sc.Broken.AddFailure(firstItem, err)
+		sc.Progress.AddFailure()
 		return err
 	}
 
@@ -170,15 +216,19 @@ func (sc *Scraper) Start(ctx context.Context) error {
 					if !open {
 						return nil // normal 'clean' termination
 					} else {
+						sc.Progress.Begin()
 						_, result, err := d.ProcessURL(ctx, item)
+						sc.Progress.End()
 						if err != nil {
 							if !errors.Is(err, context.Canceled) {
 								logger.Error("Failed", slog.String("item", item.String()), slog.Any("error", err))
+								sc.Broken.AddFailure(item, err)
+								sc.Progress.AddFailure()
 							}
 							return err
 						}
 
-						logResult(result)
+						sc.recordResult(item, result)
 
 						results <- *result
 					}
@@ -194,17 +244,27 @@ func (sc *Scraper) Start(ctx context.Context) error {
 	// work done/remaining work to do. When it terminates, it closes the workQueueIn channel,
 	// causing all the pool goroutines to terminate.
 	go func() {
+		feeds := newFeedEntries(sc.ETagsDB)
 		todo := 1 // first page references
 		for result := range results {
 			todo--
+			feeds.done(&result)
 			newDepth := result.Item.Depth + 1
+			if linksFromPage(&result) {
+				sc.Broken.AddLinks(&result)
+			}
+			sc.Graph.AddLinks(&result)
 			sc.partitionResult(&result, newDepth)
 			logger.Debug("Partitioned", slog.Any("item", result.Item), slog.Any("include", result.References), slog.Any("exclude", result.Excluded))
 			for _, ref := range result.References {
 				u := absoluteURL(ref, result)
-				workQueueIn <- work.Item{URL: u, Referrer: result.Item.URL, Depth: newDepth}
+				// the event comes first, so that it cannot follow the events of fetching the item
+				sc.Events.Queued(events.Queued{URL: u.String(), Referrer: result.Item.URL.String(), Depth: newDepth})
+				workQueueIn <- work.Item{URL: u, Referrer: result.Item.URL, Depth: newDepth, Manifest: isManifest(&result, u)}
 			}
+			feeds.add(&result)
 			todo += len(result.References)
+			sc.Progress.SetQueued(todo)
 			if todo == 0 {
 				break
 			}
@@ -213,7 +273,7 @@ func (sc *Scraper) Start(ctx context.Context) error {
 	}()
 
 	// start the ball rolling: this creates the first batch of work items
-	logResult(firstResult)
+	sc.recordResult(firstItem, firstResult)
 	results <- *firstResult
 
 	// all the pool processes are busy until this unblocks.
@@ -238,8 +298,58 @@ func absoluteURL(u *urlpkg.URL, result work.Result) *urlpkg.URL {
 	return u
 }
 
+// linksFromPage tests whether the references of a result are links from its page, rather than
+// a retry of the same URL or the target of a redirection.
+func linksFromPage(result *work.Result) bool {
+	if result.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return !result.IsRedirect() || len(result.Links) > 0
+}
+
+// isManifest tests whether a reference is to a web app manifest. Redirections and retries
+// keep the kind of the item they came from.
+func isManifest(result *work.Result, u *urlpkg.URL) bool {
+	if result.IsRedirect() || result.StatusCode == http.StatusTooManyRequests {
+		return result.Item.Manifest
+	}
+	return result.Links[u.String()].HasRel("manifest")
+}
+
 //-------------------------------------------------------------------------------------------------
 
+// recordResult logs the result of downloading an item and adds it to the statistics, progress,
+// events, trail, listing, broken links and graph.
+func (sc *Scraper) recordResult(item work.Item, result *work.Result) {
+	logResult(result)
+	took := utc.Now().Sub(result.Item.StartTime)
+	sc.Stats.AddResult(result, took)
+	emitResult(sc.Events, result, took)
+	sc.Progress.AddResult(result)
+	sc.Trail.RecordStatus(item.URL, result.StatusCode)
+	sc.Listing.Add(result)
+	sc.Broken.AddResult(result)
+	sc.Graph.AddResult(result)
+}
+
+func emitResult(crawl *events.Crawl, result *work.Result, took time.Duration) {
+	if result.Skipped != "" {
+		crawl.Skipped(events.Skipped{URL: result.Item.URL.String(), Reason: "response", Detail: result.Skipped})
+		return
+	}
+
+	crawl.Fetched(events.Fetched{
+		URL:         result.Item.URL.String(),
+		Status:      result.StatusCode,
+		ContentType: result.ContentType,
+		Size:        result.ContentLength,
+		FileSize:    result.FileSize,
+		Depth:       result.Item.Depth,
+		Started:     result.Item.StartTime,
+		Seconds:     took.Seconds(),
+	})
+}
+
 func logResult(result *work.Result) {
 	// using a func result so that it can be applied transparently to the major method call sites, above
 	var args = []any{
@@ -257,8 +367,13 @@ func logResult(result *work.Result) {
 	if result.FileSize > 0 {
 		args = append(args, slog.Int64("fileSize", result.FileSize))
 	}
-	if result.Gzip {
-		args = append(args, slog.String("enc", "gzip"))
+	if result.Encoding != "" {
+		args = append(args, slog.String("enc", result.Encoding))
+	}
+	if result.Skipped != "" {
+		args = append(args, slog.String("reason", result.Skipped))
+		logger.Info("Skipped", args...)
+		return
 	}
 	logger.Log(chooseLevel(result.StatusCode), statusText(result.StatusCode), args...)
 }
@@ -2,13 +2,20 @@ package scraper
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	urlpkg "net/url"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rickb777/expect"
 	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/db"
+	"github.com/rickb777/goscrape2/events"
 	"github.com/rickb777/goscrape2/stubclient"
+	"github.com/rickb777/goscrape2/work"
 	"github.com/spf13/afero"
 )
 
@@ -117,3 +124,121 @@ func TestScraperAttributes(t *testing.T) {
 	slices.Sort(actualProcessed)
 	expect.Slice(actualProcessed).ToBe(t, expectedProcessed...)
 }
+
+func TestScraperEvents(t *testing.T) {
+	indexPage := `<html><body><a href="/about">About</a> <a href="https://other.org/">Other</a></body></html>`
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", indexPage)
+	stub.GivenResponse(http.StatusNotFound, "https://example.org/about", "text/html", "")
+
+	buf := &strings.Builder{}
+	scraper := newTestScraper(t, "https://example.org/", stub)
+	scraper.Events = events.NewStream(buf).For("https://example.org/")
+
+	err := scraper.Start(context.Background())
+	expect.Error(err).ToBeNil(t)
+
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var header events.Header
+		expect.Error(json.Unmarshal([]byte(line), &header)).ToBeNil(t)
+		types = append(types, header.Type)
+	}
+
+	slices.Sort(types)
+	expect.Slice(types).ToBe(t,
+		events.TypeCrawlFinished,
+		events.TypeCrawlStarted,
+		events.TypeWritten,
+		events.TypeFetched,
+		events.TypeFetched,
+		events.TypeQueued,
+		events.TypeQueued,
+		events.TypeSkipped,
+	)
+	expect.String(buf.String()).ToContain(t, `"type":"url.skipped","time":`)
+	expect.String(buf.String()).ToContain(t, `"url":"https://other.org/","referrer":"https://example.org/","reason":"offhost","detail":"other.org"`)
+}
+
+func TestScraperFeedUpdate(t *testing.T) {
+	feed := `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<item><link>https://example.org/blog/new.html</link><pubDate>Tue, 02 Jan 2024 10:00:00 GMT</pubDate></item>
+<item><link>https://example.org/blog/old.html</link><pubDate>Mon, 01 Jan 2024 10:00:00 GMT</pubDate></item>
+</channel>
+</rss>`
+
+	seen := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	cases := map[int]time.Time{
+		http.StatusOK:                  time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+		http.StatusNotFound:            seen, // so that the entry is tried again next time
+		http.StatusInternalServerError: seen,
+	}
+
+	for code, expected := range cases {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(http.StatusOK, "https://example.org/blog/index.rss", "application/rss+xml", feed)
+		stub.GivenResponse(code, "https://example.org/blog/new.html", "text/html", "<html></html>")
+
+		feedURL := mustParseURL("https://example.org/blog/index.rss")
+
+		scraper := newTestScraper(t, feedURL.String(), stub)
+		scraper.config.FeedUpdate = true
+		scraper.ETagsDB = db.OpenDB("/state", afero.NewMemMapFs())
+		scraper.ETagsDB.Store(feedURL, db.Item{Code: http.StatusOK, Latest: seen})
+
+		err := scraper.Start(context.Background())
+		expect.Error(err).ToBeNil(t)
+
+		expect.Any(scraper.ETagsDB.Lookup(feedURL).Latest).I(code).ToBe(t, expected)
+	}
+}
+
+func TestFeedEntries_noRecord(t *testing.T) {
+	feedURL := mustParseURL("https://example.org/blog/index.rss")
+	etags := db.OpenDB("/state", afero.NewMemMapFs())
+
+	feeds := newFeedEntries(etags)
+	feeds.add(&work.Result{Item: work.Item{URL: feedURL}, StatusCode: http.StatusNotModified, FeedLatest: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	expect.Any(etags.Lookup(feedURL)).ToBe(t, db.Item{})
+}
+
+func TestScraperManifestAsJSON(t *testing.T) {
+	indexPage := `<html><head><link rel="manifest" href="/app.json"></head><body></body></html>`
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", indexPage)
+	stub.GivenResponse(http.StatusOK, "https://example.org/app.json", "application/json", `{"icons": [{"src": "/icon.png"}]}`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/icon.png", "image/png", "")
+
+	scraper := newTestScraper(t, "https://example.org/", stub)
+
+	err := scraper.Start(context.Background())
+	expect.Error(err).ToBeNil(t)
+
+	actualProcessed := scraper.processed.Slice()
+	slices.Sort(actualProcessed)
+	expect.Slice(actualProcessed).ToBe(t, "/", "/app.json", "/icon.png")
+}
+
+func TestLinksFromPage(t *testing.T) {
+	page := mustParseURL("https://example.org/page.html")
+	other := mustParseURL("https://example.org/other.html")
+
+	cases := map[string]struct {
+		result   work.Result
+		expected bool
+	}{
+		"page":     {work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusOK, References: []*urlpkg.URL{other}}, true},
+		"retry":    {work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusTooManyRequests, References: []*urlpkg.URL{page}}, false},
+		"redirect": {work.Result{Item: work.Item{URL: page}, StatusCode: http.StatusMovedPermanently, References: []*urlpkg.URL{other}}, false},
+	}
+
+	for name, c := range cases {
+		expect.Bool(linksFromPage(&c.result)).I(name).ToBe(t, c.expected)
+	}
+}
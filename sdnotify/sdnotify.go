@@ -0,0 +1,106 @@
+// Package sdnotify implements the systemd notification protocol, which lets a service with
+// Type=notify report when it is ready, what it is doing, and that it is still alive for the
+// WatchdogSec setting. If the service is not run by systemd, the notifications are no-ops.
+//
+// See https://www.freedesktop.org/software/systemd/man/sd_notify.html
+package sdnotify
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/goscrape2/logger"
+)
+
+// Notify sends a state, e.g. "READY=1", to the socket given by $NOTIFY_SOCKET. It reports
+// whether the state was sent; false with no error means that there is no socket.
+func Notify(state string) (bool, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+
+	// abstract sockets are written with a leading '@'
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// send sends a state, logging any failure because the service carries on regardless.
+func send(state string) {
+	if _, err := Notify(state); err != nil {
+		logger.Warn("systemd notification failed", slog.String("state", state), slog.Any("error", err))
+	}
+}
+
+// Ready tells systemd that the service has finished starting up.
+func Ready() {
+	send("READY=1")
+}
+
+// Status tells systemd what the service is doing, as shown by systemctl status.
+func Status(status string) {
+	send("STATUS=" + strings.ReplaceAll(status, "\n", " "))
+}
+
+// Watchdog tells systemd that the service is still alive.
+func Watchdog() {
+	send("WATCHDOG=1")
+}
+
+// WatchdogInterval gets the interval within which systemd expects Watchdog to be called,
+// which is zero if the watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0 // meant for another process
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+// StartWatchdog calls Watchdog at half the watchdog interval until the context is done, but
+// only while alive reports that the service is working, so that systemd restarts it when it
+// is not. It does nothing if the watchdog is not enabled.
+func StartWatchdog(ctx context.Context, alive func() bool) {
+	interval := WatchdogInterval() / 2
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if alive() {
+					Watchdog()
+				}
+			}
+		}
+	}()
+}
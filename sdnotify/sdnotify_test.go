@@ -0,0 +1,88 @@
+package sdnotify_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/sdnotify"
+)
+
+// listen creates a Unix datagram socket standing in for systemd.
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	expect.Error(err).Not().ToHaveOccurred(t)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	expect.Error(err).Not().ToHaveOccurred(t)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listen(t)
+
+	sdnotify.Ready()
+	expect.String(receive(t, conn)).ToBe(t, "READY=1")
+
+	sdnotify.Status("Scraping\nhttp://example.org/")
+	expect.String(receive(t, conn)).ToBe(t, "STATUS=Scraping http://example.org/")
+
+	sdnotify.Watchdog()
+	expect.String(receive(t, conn)).ToBe(t, "WATCHDOG=1")
+}
+
+func TestNotify_noSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := sdnotify.Notify("READY=1")
+	expect.Bool(sent).ToBeFalse(t)
+	expect.Error(err).Not().ToHaveOccurred(t)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	expect.Number(sdnotify.WatchdogInterval()).ToBe(t, 0)
+
+	t.Setenv("WATCHDOG_USEC", "2000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	expect.Number(sdnotify.WatchdogInterval()).ToBe(t, 2*time.Second)
+
+	t.Setenv("WATCHDOG_PID", "1")
+	expect.Number(sdnotify.WatchdogInterval()).ToBe(t, 0)
+}
+
+func TestStartWatchdog(t *testing.T) {
+	conn := listen(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var alive atomic.Bool
+	sdnotify.StartWatchdog(ctx, alive.Load)
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := conn.Read(buf)
+	expect.Error(err).I("not alive").ToHaveOccurred(t)
+
+	alive.Store(true)
+	expect.String(receive(t, conn)).ToBe(t, "WATCHDOG=1")
+}
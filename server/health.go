@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rickb777/goscrape2/scraper"
+)
+
+const (
+	HealthPath = "/healthz"
+	ReadyPath  = "/readyz"
+)
+
+// health answers the liveness and readiness probes. The webserver is alive whenever it can
+// answer; it is ready when its listener is up and the state database, if used, is loaded.
+type health struct {
+	listening atomic.Bool
+	sc        *scraper.Scraper
+}
+
+// notReady gives the reason the webserver is not ready, or blank if it is.
+func (h *health) notReady() string {
+	switch {
+	case !h.listening.Load():
+		return "listener is not up"
+	case h.sc != nil && h.sc.ETagsDB != nil && !h.sc.ETagsDB.Loaded():
+		return "state database is not loaded"
+	}
+	return ""
+}
+
+func (h *health) serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *health) serveReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if reason := h.notReady(); reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, reason)
+		return
+	}
+
+	fmt.Fprintln(w, "ready")
+}
+
+// Ready tests whether a webserver is ready by asking its own readiness probe, which also shows
+// that it can still handle requests. It is used by the systemd watchdog.
+func Ready(server *http.Server) bool {
+	w := &probeWriter{header: make(http.Header)}
+	r, _ := http.NewRequest(http.MethodGet, ReadyPath, nil)
+	server.Handler.ServeHTTP(w, r)
+	return w.code == http.StatusOK
+}
+
+// probeWriter records the status of a response and discards its body.
+type probeWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *probeWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *probeWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+func (w *probeWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
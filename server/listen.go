@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/rickb777/goscrape2/activation"
+	"github.com/rickb777/goscrape2/logger"
+)
+
+// AdminSocket is the name of the sockets passed by systemd that serve only the metrics and
+// probes, set by FileDescriptorName in the .socket unit.
+const AdminSocket = "admin"
+
+// Listeners are the sockets that the webserver accepts connections on.
+type Listeners struct {
+	Web   []net.Listener // serve the website, the metrics and the probes
+	Admin []net.Listener // serve only the metrics and the probes
+}
+
+// Close closes all the listeners, which also removes the Unix domain socket.
+func (l Listeners) Close() {
+	for _, listener := range append(l.Web, l.Admin...) {
+		_ = listener.Close()
+	}
+}
+
+// Listen gets the listeners for the webserver. If systemd passed any sockets, they are used
+// and the port is ignored; otherwise, the webserver listens on the TCP port. Either way, it
+// also listens on a Unix domain socket if a path is given.
+func Listen(port int16, unixSocket string) (Listeners, error) {
+	var l Listeners
+
+	sockets, err := activation.Listeners()
+	if err != nil {
+		return l, err
+	}
+
+	for _, s := range sockets {
+		logger.Server.Debug("Using socket from systemd", slog.String("name", s.Name), slog.String("address", s.Addr().String()))
+		if s.Name == AdminSocket {
+			l.Admin = append(l.Admin, s.Listener)
+		} else {
+			l.Web = append(l.Web, s.Listener)
+		}
+	}
+
+	if len(sockets) == 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return l, err
+		}
+		l.Web = append(l.Web, listener)
+	}
+
+	if unixSocket != "" {
+		listener, err := listenUnix(unixSocket)
+		if err != nil {
+			l.Close()
+			return Listeners{}, err
+		}
+		l.Web = append(l.Web, listener)
+	}
+
+	return l, nil
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	// a socket left behind by a previous run would prevent listening
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the owner and its group may connect, so a reverse proxy needs to be in the group;
+	// the socket file is removed when the listener is closed
+	if err := os.Chmod(path, 0o660); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// adminListener marks its connections so that they are only given the metrics and probes.
+type adminListener struct {
+	net.Listener
+}
+
+type adminConn struct {
+	net.Conn
+}
+
+func (l adminListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return adminConn{Conn: c}, nil
+}
+
+type adminKey struct{}
+
+func markAdmin(ctx context.Context, c net.Conn) context.Context {
+	if _, ok := c.(adminConn); ok {
+		return context.WithValue(ctx, adminKey{}, true)
+	}
+	return ctx
+}
+
+func isAdmin(r *http.Request) bool {
+	admin, _ := r.Context().Value(adminKey{}).(bool)
+	return admin
+}
+
+// addressOf describes where a listener can be reached.
+func addressOf(l net.Listener) string {
+	if tcp, ok := l.Addr().(*net.TCPAddr); ok {
+		return fmt.Sprintf("http://%s:%d", hostname(), tcp.Port)
+	}
+	return l.Addr().Network() + ":" + l.Addr().String()
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/rickb777/goscrape2/metrics"
+	"github.com/rickb777/goscrape2/scraper"
+)
+
+// MetricsPath is where the webserver serves its metrics in the Prometheus text format. If it
+// is blank, the metrics are not served.
+var MetricsPath = "/metrics"
+
+// serverMetrics are the metrics of the webserver, and of the scraper behind it if there is one.
+type serverMetrics struct {
+	registry  *metrics.Registry
+	requests  *metrics.Counter
+	served    *metrics.Counter
+	fetches   *metrics.CounterVec
+	fetchTime *metrics.Histogram
+}
+
+func newServerMetrics(sc *scraper.Scraper) *serverMetrics {
+	m := &serverMetrics{
+		registry:  metrics.NewRegistry(),
+		requests:  &metrics.Counter{},
+		served:    &metrics.Counter{},
+		fetches:   metrics.NewCounterVec("code"),
+		fetchTime: metrics.NewHistogram(metrics.DefaultSeconds...),
+	}
+
+	m.registry.Register("goscrape_served_requests_total", "Requests handled by the webserver.", m.requests)
+	m.registry.Register("goscrape_served_bytes_total", "Bytes in the bodies of the webserver's responses.", m.served)
+	m.registry.Register("goscrape_served_cache_hit_ratio", "The fraction of requests that were served without fetching from the origin.",
+		metrics.GaugeFunc(m.hitRatio))
+
+	if sc == nil {
+		return m
+	}
+
+	m.registry.Register("goscrape_ondemand_fetches_total", "Requests fetched from the origin on demand, by status code.", m.fetches)
+	m.registry.Register("goscrape_ondemand_fetch_seconds", "The time taken to fetch requests from the origin on demand.", m.fetchTime)
+	m.registry.Register("goscrape_responses_total", "Responses from the origin, by status code.",
+		metrics.LabelledCounterFunc("code", func() map[string]float64 {
+			statuses := sc.Stats.Summary().Statuses
+			values := make(map[string]float64, len(statuses))
+			for code, n := range statuses {
+				values[strconv.Itoa(code)] = float64(n)
+			}
+			return values
+		}))
+	m.registry.Register("goscrape_downloaded_bytes_total", "Bytes downloaded from the origin.",
+		metrics.CounterFunc(func() float64 { return float64(sc.Stats.Summary().Transferred) }))
+	m.registry.Register("goscrape_throttle_delay_seconds", "The delay imposed because the origin asked for fewer requests.",
+		metrics.GaugeFunc(func() float64 { return sc.Progress.Snapshot().Delay.Seconds() }))
+	m.registry.Register("goscrape_queue_length", "URLs waiting to be fetched.",
+		metrics.GaugeFunc(func() float64 { return float64(sc.Progress.Snapshot().Queued) }))
+
+	if sc.ETagsDB != nil {
+		m.registry.Register("goscrape_db_records", "Records in the state database.",
+			metrics.GaugeFunc(func() float64 { return float64(sc.ETagsDB.Len()) }))
+		m.registry.Register("goscrape_db_flush_seconds", "The time taken to write the state database to disk.", sc.ETagsDB.FlushTimes())
+	}
+
+	return m
+}
+
+// hitRatio is the fraction of requests that did not need fetching on demand.
+func (m *serverMetrics) hitRatio() float64 {
+	requests := m.requests.Value()
+	if requests == 0 {
+		return 0
+	}
+
+	var misses int64
+	for _, n := range m.fetches.Values() {
+		misses += n
+	}
+	return float64(requests-misses) / float64(requests)
+}
+
+// count is middleware that counts the requests and the bytes served.
+func (m *serverMetrics) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requests.Inc()
+		next.ServeHTTP(&countingWriter{ResponseWriter: w, served: m.served}, r)
+	})
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	served *metrics.Counter
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.served.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,18 +1,28 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"mime"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/rickb777/acceptable/headername"
 	"github.com/rickb777/goscrape2/db"
 	"github.com/rickb777/goscrape2/logger"
+	"github.com/rickb777/goscrape2/mapping"
 	"github.com/rickb777/goscrape2/scraper"
+	"github.com/rickb777/goscrape2/sdnotify"
 	"github.com/rickb777/goscrape2/work"
 	"github.com/rickb777/servefiles/v3"
 	sloghttp "github.com/samber/slog-http"
@@ -25,9 +35,16 @@ const (
 )
 
 // set more mime types in the browser, this fixes .asp files not being
-// downloaded but handled as html.
+// downloaded but handled as html. Streaming media files and web app manifests
+// need their types so that the offline copies work in a browser.
 var mimeTypes = map[string]string{
-	".asp": "text/html; charset=utf-8",
+	".asp":  "text/html; charset=utf-8",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".m4s":  "video/iso.segment",
+	".ts":   "video/mp2t",
+
+	".webmanifest": "application/manifest+json",
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -35,19 +52,27 @@ var mimeTypes = map[string]string{
 // onDemand is a HTTP handler that processes 404-not found requests by trying to download
 // the missing items from the origin server.
 type onDemand struct {
-	sc   *scraper.Scraper
-	next http.Handler
+	sc      *scraper.Scraper
+	metrics *serverMetrics
+	next    http.Handler
 }
 
 func (h *onDemand) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	url := h.sc.URL.ResolveReference(r.URL)
 	d := h.sc.Downloader()
+	started := time.Now()
 	_, result, err := d.ProcessURL(r.Context(), work.Item{URL: url, Depth: 1})
+	h.metrics.fetchTime.Observe(time.Since(started).Seconds())
 
 	if err != nil {
+		h.metrics.fetches.Inc("error")
 		http.Error(w, "Bad gateway: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	h.metrics.fetches.Inc(strconv.Itoa(result.StatusCode))
 
-	} else if result.StatusCode == http.StatusNotFound {
+	if result.StatusCode == http.StatusNotFound {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 
 	} else if minRedirectCode <= result.StatusCode && result.StatusCode <= maxRedirectCode {
@@ -66,6 +91,59 @@ func (h *onDemand) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 //-------------------------------------------------------------------------------------------------
 
+// decompressor serves files that are stored gzip-compressed only to clients that don't accept
+// gzip, decompressing them on the fly. Everything else is handled by the next handler.
+type decompressor struct {
+	fs   afero.Fs
+	next http.Handler
+}
+
+func (h *decompressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+	if strings.HasSuffix(name, "/") {
+		name += servefiles.IndexPage
+	}
+
+	if !mapping.IsCompressible(name) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	f, err := h.fs.Open(mapping.GzipFilePath(name))
+	if err != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		logger.Server.Error("Decompressing file failed", slog.String("file", fi.Name()), slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer gr.Close()
+
+	// compressible files are small enough to be decompressed in memory
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		logger.Server.Error("Decompressing file failed", slog.String("file", fi.Name()), slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add(headername.Vary, headername.AcceptEncoding)
+	http.ServeContent(w, r, name, fi.ModTime(), bytes.NewReader(data))
+}
+
+//-------------------------------------------------------------------------------------------------
+
 // redirecter uses the cache database to decide which URLs to redirect and where to redirect those
 // URls. Everything else is handled by the next handler.
 type redirecter struct {
@@ -90,30 +168,64 @@ func (h *redirecter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 //-------------------------------------------------------------------------------------------------
 
-func ServeDirectory(ctx context.Context, sc *scraper.Scraper, path string, port int16) error {
-	server, errChan, err := LaunchWebserver(sc, path, port)
+// ServeDirectory runs the webserver until the context is done. The systemd watchdog, if
+// enabled, is fed while the webserver is ready.
+func ServeDirectory(ctx context.Context, sc *scraper.Scraper, path string, listeners Listeners) error {
+	server, errChan, err := LaunchWebserver(sc, path, listeners)
 	if err != nil {
 		return err
 	}
 
+	sdnotify.StartWatchdog(ctx, func() bool { return Ready(server) })
 	return AwaitWebserver(ctx, server, errChan)
 }
 
-func LaunchWebserver(sc *scraper.Scraper, path string, port int16) (*http.Server, chan error, error) {
-	logger.Info("Serving directory",
+// LaunchWebserver starts the webserver in the background on all the listeners, at which
+// point systemd is told that the service is ready.
+func LaunchWebserver(sc *scraper.Scraper, path string, listeners Listeners) (*http.Server, chan error, error) {
+	all := append(slices.Clone(listeners.Web), listeners.Admin...)
+	if len(all) == 0 {
+		return nil, nil, errors.New("no listeners for the webserver")
+	}
+
+	addresses := make([]string, len(all))
+	for i, l := range all {
+		addresses[i] = addressOf(l)
+	}
+	logger.Server.Info("Serving directory",
 		slog.String("path", path),
-		slog.String("address", fmt.Sprintf("http://%s:%d", hostname(), port)))
+		slog.String("address", strings.Join(addresses, " ")))
 
-	handler := constructAssetServer(sc, path)
-	handler = &redirecter{eTagsDB: sc.ETagsDB, scheme: sc.URL.Scheme, host: sc.URL.Host, next: handler}
-	handler = sloghttp.NewWithConfig(logger.Logger, logger.HttpLogConfig())(handler)
+	m := newServerMetrics(sc)
+	handler := constructAssetServer(sc, path, m)
+	if sc != nil {
+		handler = &redirecter{eTagsDB: sc.ETagsDB, scheme: sc.URL.Scheme, host: sc.URL.Host, next: handler}
+	}
+	handler = m.count(handler)
+	if logger.HttpLogEnabled() {
+		handler = sloghttp.NewWithConfig(logger.Server.Slog(), logger.HttpLogConfig())(handler)
+	}
 	handler = handlers.RecoveryHandler()(handler)
-	server := newWebserver(port, handler)
 
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- server.ListenAndServe()
-	}()
+	h := &health{sc: sc}
+	server := newWebserver(handler, m.registry, h)
+
+	errChan := make(chan error, len(all))
+	for _, l := range listeners.Web {
+		go func() {
+			errChan <- server.Serve(l)
+		}()
+	}
+	for _, l := range listeners.Admin {
+		go func() {
+			errChan <- server.Serve(adminListener{Listener: l})
+		}()
+	}
+
+	h.listening.Store(true)
+	sdnotify.Ready()
+	sdnotify.Status("Serving " + strings.Join(addresses, " "))
+
 	return server, errChan, nil
 }
 
@@ -130,34 +242,62 @@ func AwaitWebserver(ctx context.Context, server *http.Server, errChan chan error
 		return nil
 
 	case err := <-errChan:
+		_ = server.Close() // closes the other listeners, removing any Unix domain socket
 		return fmt.Errorf("webserver: %w", err)
 	}
 }
 
-func newWebserver(port int16, fileServer http.Handler) *http.Server {
+// newWebserver routes the requests. Connections to the admin listeners only get the metrics
+// and probes.
+func newWebserver(fileServer, metricsServer http.Handler, h *health) *http.Server {
+	admin := http.NewServeMux()
+	admin.HandleFunc(HealthPath, h.serveHealth)
+	admin.HandleFunc(ReadyPath, h.serveReady)
+	if MetricsPath != "" {
+		admin.Handle(MetricsPath, metricsServer)
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/", fileServer)
+	mux.Handle(HealthPath, admin)
+	mux.Handle(ReadyPath, admin)
+	if MetricsPath != "" {
+		mux.Handle(MetricsPath, admin)
+	}
 
-	addr := fmt.Sprintf(":%d", port)
-	return &http.Server{Addr: addr, Handler: mux}
+	return &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdmin(r) {
+				admin.ServeHTTP(w, r)
+			} else {
+				mux.ServeHTTP(w, r)
+			}
+		}),
+		ConnContext: markAdmin,
+	}
 }
 
-func constructAssetServer(sc *scraper.Scraper, path string) http.Handler {
+// constructAssetServer builds the file server. Files stored gzip-compressed are served as they
+// are to clients that accept gzip, and decompressed for other clients.
+func constructAssetServer(sc *scraper.Scraper, path string, m *serverMetrics) http.Handler {
 	var fileServer http.Handler
 	if sc == nil {
 		fs := afero.NewBasePathFs(afero.NewOsFs(), path)
-		fileServer = servefiles.NewAssetHandlerFS(fs)
+		assets := servefiles.NewAssetHandlerFS(fs)
+		assets.NotFound = &decompressor{fs: fs, next: http.NotFoundHandler()}
+		fileServer = assets
 	} else {
-		fileServer = assetHandlerWith404Handler(sc)
+		fileServer = assetHandlerWith404Handler(sc, m)
 	}
 	return fileServer
 }
 
-func assetHandlerWith404Handler(sc *scraper.Scraper) http.Handler {
+func assetHandlerWith404Handler(sc *scraper.Scraper, m *serverMetrics) http.Handler {
 	fs := afero.NewBasePathFs(sc.Fs, sc.URL.Host)
-	secondary := servefiles.NewAssetHandlerFS(fs) // secondary has default 404 handler
+	secondary := servefiles.NewAssetHandlerFS(fs)
+	secondary.NotFound = &decompressor{fs: fs, next: http.NotFoundHandler()}
 	primary := servefiles.NewAssetHandlerFS(fs)
-	primary.NotFound = &onDemand{sc: sc, next: secondary}
+	primary.NotFound = &decompressor{fs: fs, next: &onDemand{sc: sc, metrics: m, next: secondary}}
 	return primary
 }
 
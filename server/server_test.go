@@ -1,10 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"github.com/rickb777/expect"
 	"github.com/rickb777/goscrape2/config"
+	"github.com/rickb777/goscrape2/db"
 	"github.com/rickb777/goscrape2/logger"
 	"github.com/rickb777/goscrape2/scraper"
 	"github.com/rickb777/goscrape2/stubclient"
@@ -12,9 +15,13 @@ import (
 	"github.com/spf13/afero"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -33,7 +40,7 @@ func setup() {
 		if testing.Verbose() {
 			opts := &slog.HandlerOptions{Level: slog.LevelWarn}
 			opts.Level = slog.LevelDebug
-			servefiles.Debugf = func(format string, v ...interface{}) { logger.Debug(fmt.Sprintf(format, v...)) }
+			servefiles.Debugf = func(format string, v ...interface{}) { logger.Server.Debug(fmt.Sprintf(format, v...)) }
 			logger.Logger = slog.New(slog.NewTextHandler(os.Stdout, opts))
 		} else {
 			logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -54,6 +61,14 @@ func newTestScraper(t *testing.T, startURL string, stub *stubclient.Client) *scr
 	return sc
 }
 
+// listen creates a listener on a free port, giving the base URL of the webserver.
+func listen(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	expect.Error(err).ToBeNil(t)
+	return l, "http://" + l.Addr().String()
+}
+
 func TestServeDirectory(t *testing.T) {
 	stub := &stubclient.Client{}
 	sc := newTestScraper(t, "https://example.org/", stub)
@@ -63,7 +78,8 @@ func TestServeDirectory(t *testing.T) {
 	defer cancel()
 
 	// not testing what it actually does here - see below
-	err := ServeDirectory(ctx, sc, "", 14141)
+	l, _ := listen(t)
+	err := ServeDirectory(ctx, sc, "", Listeners{Web: []net.Listener{l}})
 	expect.Error(err).ToBeNil(t)
 }
 
@@ -108,21 +124,22 @@ It's here!
 	writeFile(sc.Fs, "example.org/index.html", indexPage)
 	writeFile(sc.Fs, "example.org/page2/index.html", page2)
 
-	server, errChan, err := LaunchWebserver(sc, "", 14141)
+	l, base := listen(t)
+	server, errChan, err := LaunchWebserver(sc, "", Listeners{Web: []net.Listener{l}})
 	expect.Error(err).ToBeNil(t)
 	expect.Any(server).Not().ToBeNil(t)
 
 	c := &http.Client{}
 
-	resp, err := c.Get("http://localhost:14141/")
+	resp, err := c.Get(base + "/")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/").ToBe(t, http.StatusOK)
 
-	resp, err = c.Get("http://localhost:14141/missing.html")
+	resp, err = c.Get(base + "/missing.html")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/missing.html").ToBe(t, http.StatusOK)
 
-	resp, err = c.Get("http://localhost:14141/page2/")
+	resp, err = c.Get(base + "/page2/")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/page2/").ToBe(t, http.StatusOK)
 
@@ -169,7 +186,8 @@ func TestLaunchWebserver_notConnected(t *testing.T) {
 	writeFile(sc.Fs, "example.org/index.html", indexPage)
 	writeFile(sc.Fs, "example.org/page2/index.html", page2)
 
-	server, errChan, err := LaunchWebserver(sc, "", 14141)
+	l, base := listen(t)
+	server, errChan, err := LaunchWebserver(sc, "", Listeners{Web: []net.Listener{l}})
 	expect.Error(err).ToBeNil(t)
 	expect.Any(server).Not().ToBeNil(t)
 
@@ -177,15 +195,15 @@ func TestLaunchWebserver_notConnected(t *testing.T) {
 
 	c := &http.Client{}
 
-	resp, err := c.Get("http://localhost:14141/")
+	resp, err := c.Get(base + "/")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/").ToBe(t, http.StatusOK)
 
-	resp, err = c.Get("http://localhost:14141/missing.html")
+	resp, err = c.Get(base + "/missing.html")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/missing.html").ToBe(t, http.StatusBadGateway)
 
-	resp, err = c.Get("http://localhost:14141/page2/")
+	resp, err = c.Get(base + "/page2/")
 	expect.Error(err).ToBeNil(t)
 	expect.Number(resp.StatusCode).I("/page2/").ToBe(t, http.StatusOK)
 
@@ -209,3 +227,180 @@ func must(err error) {
 		panic(err)
 	}
 }
+
+func TestConstructAssetServer_gzipOnly(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+
+	page := "<html><body>Hello</body></html>"
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, _ = gw.Write([]byte(page))
+	_ = gw.Close()
+	expect.Error(os.WriteFile(filepath.Join(dir, "index.html.gz"), buf.Bytes(), 0644)).ToBeNil(t)
+
+	handler := constructAssetServer(nil, dir, newServerMetrics(nil))
+
+	// a client that accepts gzip gets the compressed file as it is
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	expect.Number(w.Code).ToBe(t, http.StatusOK)
+	expect.String(w.Header().Get("Content-Encoding")).ToBe(t, "gzip")
+	expect.Slice(w.Body.Bytes()).ToBe(t, buf.Bytes()...)
+
+	// other clients get it decompressed
+	req = httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	expect.Number(w.Code).ToBe(t, http.StatusOK)
+	expect.String(w.Header().Get("Content-Encoding")).ToBe(t, "")
+	expect.String(w.Header().Get("Content-Type")).ToBe(t, "text/html; charset=utf-8")
+	expect.String(w.Body.String()).ToBe(t, page)
+
+	// missing files are still not found
+	req = httptest.NewRequest(http.MethodGet, "/missing.html", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	expect.Number(w.Code).ToBe(t, http.StatusNotFound)
+}
+
+func TestServerMetrics(t *testing.T) {
+	originStub := &stubclient.Client{}
+	originStub.GivenResponse(http.StatusOK, "https://example.org/missing.html", "text/html", "<html><body>It's here!</body></html>")
+
+	sc := newTestScraper(t, "https://example.org/", originStub)
+	writeFile(sc.Fs, "example.org/index.html", "<html><body>Index</body></html>")
+
+	m := newServerMetrics(sc)
+	handler := m.count(constructAssetServer(sc, "", m))
+
+	for _, path := range []string{"/", "/missing.html", "/missing.html"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		expect.Number(w.Code).I(path).ToBe(t, http.StatusOK)
+	}
+
+	w := httptest.NewRecorder()
+	m.registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	expect.String(body).ToContain(t, "goscrape_served_requests_total 3\n")
+	expect.String(body).ToContain(t, "goscrape_served_bytes_total 103\n")
+	expect.String(body).ToContain(t, "goscrape_served_cache_hit_ratio 0.6666666666666666\n")
+	expect.String(body).ToContain(t, `goscrape_ondemand_fetches_total{code="200"} 1`+"\n")
+	expect.String(body).ToContain(t, "goscrape_ondemand_fetch_seconds_count 1\n")
+	expect.String(body).ToContain(t, `goscrape_responses_total{code="200"} 1`+"\n")
+	expect.String(body).ToContain(t, "goscrape_queue_length 0\n")
+}
+
+func TestHealth(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	sc.ETagsDB = db.OpenDB("/state", afero.NewMemMapFs())
+	h := &health{sc: sc}
+
+	probe := func(handler http.HandlerFunc) (int, string) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := probe(h.serveHealth)
+	expect.Number(code).ToBe(t, http.StatusOK)
+	expect.String(body).ToBe(t, "ok\n")
+
+	code, body = probe(h.serveReady)
+	expect.Number(code).ToBe(t, http.StatusServiceUnavailable)
+	expect.String(body).ToBe(t, "listener is not up\n")
+
+	h.listening.Store(true)
+	code, body = probe(h.serveReady)
+	expect.Number(code).ToBe(t, http.StatusOK)
+	expect.String(body).ToBe(t, "ready\n")
+
+	expect.Error(sc.ETagsDB.Close()).ToBeNil(t)
+	code, body = probe(h.serveReady)
+	expect.Number(code).ToBe(t, http.StatusServiceUnavailable)
+	expect.String(body).ToBe(t, "state database is not loaded\n")
+}
+
+func TestHealth_corruptDB(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	expect.Error(afero.WriteFile(fs, "/state/"+db.FileName, []byte(strings.Repeat("x", 100000)), 0644)).ToBeNil(t)
+
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	sc.ETagsDB = db.OpenDB("/state", fs)
+	defer sc.ETagsDB.Close()
+
+	h := &health{sc: sc}
+	h.listening.Store(true)
+
+	w := httptest.NewRecorder()
+	h.serveReady(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+	expect.Number(w.Code).ToBe(t, http.StatusServiceUnavailable)
+	expect.String(w.Body.String()).ToBe(t, "state database is not loaded\n")
+}
+
+func TestReady(t *testing.T) {
+	h := &health{}
+	server := newWebserver(http.NotFoundHandler(), http.NotFoundHandler(), h)
+	expect.Bool(Ready(server)).I("before listening").ToBeFalse(t)
+
+	h.listening.Store(true)
+	expect.Bool(Ready(server)).I("listening").ToBeTrue(t)
+}
+
+func TestLaunchWebserver_adminListener(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	writeFile(sc.Fs, "example.org/index.html", "<html><body>Index</body></html>")
+
+	web, webBase := listen(t)
+	admin, adminBase := listen(t)
+	socket := filepath.Join(t.TempDir(), "web.sock")
+	unix, err := listenUnix(socket)
+	expect.Error(err).ToBeNil(t)
+
+	info, err := os.Stat(socket)
+	expect.Error(err).ToBeNil(t)
+	expect.Number(info.Mode().Perm()).ToBe(t, 0o660)
+
+	server, errChan, err := LaunchWebserver(sc, "", Listeners{Web: []net.Listener{web, unix}, Admin: []net.Listener{admin}})
+	expect.Error(err).ToBeNil(t)
+
+	c := &http.Client{}
+	for path, codes := range map[string][2]int{
+		"/":        {http.StatusOK, http.StatusNotFound},
+		"/metrics": {http.StatusOK, http.StatusOK},
+		"/healthz": {http.StatusOK, http.StatusOK},
+		"/readyz":  {http.StatusOK, http.StatusOK},
+	} {
+		resp, err := c.Get(webBase + path)
+		expect.Error(err).ToBeNil(t)
+		expect.Number(resp.StatusCode).I("web "+path).ToBe(t, codes[0])
+
+		resp, err = c.Get(adminBase + path)
+		expect.Error(err).ToBeNil(t)
+		expect.Number(resp.StatusCode).I("admin "+path).ToBe(t, codes[1])
+	}
+
+	viaSocket := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := viaSocket.Get("http://localhost/")
+	expect.Error(err).ToBeNil(t)
+	expect.Number(resp.StatusCode).I("unix /").ToBe(t, http.StatusOK)
+
+	err = server.Shutdown(context.Background())
+	expect.Error(err).ToBeNil(t)
+
+	expect.Any(<-errChan).ToBe(t, http.ErrServerClosed)
+
+	_, err = os.Stat(socket)
+	expect.Bool(os.IsNotExist(err)).I("socket removed").ToBeTrue(t)
+}
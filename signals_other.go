@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// There are no signals to start a fresh crawl or to reload the configuration on this platform.
+var recrawlSignal, reloadSignal os.Signal
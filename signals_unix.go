@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// recrawlSignal starts a fresh crawl and reloadSignal reloads the configuration, whilst the
+// webserver is running. SIGHUP is not used, because logrotate sends it to reopen the log file.
+var recrawlSignal, reloadSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
@@ -0,0 +1,189 @@
+package stats
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rickb777/goscrape2/utc"
+	"github.com/rickb777/goscrape2/work"
+)
+
+// topN is the number of slowest URLs and largest files that are kept.
+const topN = 10
+
+// Timing is the time taken to fetch a URL.
+type Timing struct {
+	URL     string  `json:"url"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Size is the size of a file, as transferred and as stored.
+type Size struct {
+	URL         string `json:"url"`
+	Transferred int64  `json:"transferred"`
+	Stored      int64  `json:"stored"`
+}
+
+// Summary is the machine-readable account of a scraping run.
+type Summary struct {
+	URL          string         `json:"url"`
+	Started      time.Time      `json:"started"`
+	Finished     time.Time      `json:"finished"`
+	Seconds      float64        `json:"seconds"`
+	Statuses     map[int]int    `json:"statuses"`     // counts of HTTP responses, including retries
+	ContentTypes map[string]int `json:"contentTypes"` // counts of successful downloads
+	Transferred  int64          `json:"bytesTransferred"`
+	Stored       int64          `json:"bytesStored"` // after gzip compression and image recoding
+	Retries      int            `json:"retries"`
+	Throttled    int            `json:"throttled"` // 429 Too Many Requests responses
+	Slowest      []Timing       `json:"slowest"`
+	Largest      []Size         `json:"largest"`
+}
+
+// Stats collects the statistics of a scraping run for one start URL. It is safe for
+// concurrent use. If it is nil, its methods are no-ops.
+type Stats struct {
+	summary Summary
+	mu      sync.Mutex
+}
+
+// New creates the statistics for a run starting at a URL.
+func New(startURL *url.URL) *Stats {
+	return &Stats{summary: Summary{
+		URL:          startURL.String(),
+		Statuses:     make(map[int]int),
+		ContentTypes: make(map[string]int),
+		Slowest:      []Timing{},
+		Largest:      []Size{},
+	}}
+}
+
+// Begin marks the start of the run.
+func (s *Stats) Begin() {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Started = utc.Now()
+}
+
+// End marks the end of the run.
+func (s *Stats) End() {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Finished = utc.Now()
+}
+
+// AddResponse counts an HTTP response.
+func (s *Stats) AddResponse(statusCode int) {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Statuses[statusCode]++
+}
+
+// AddRetry counts a request that is retried after a server error.
+func (s *Stats) AddRetry() {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Retries++
+}
+
+// AddThrottle counts a response that told the scraper to slow down.
+func (s *Stats) AddThrottle() {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Throttled++
+}
+
+// AddResult records the content type, sizes and time taken of a download.
+func (s *Stats) AddResult(result *work.Result, took time.Duration) {
+	if s == nil {
+		return // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if result.ContentType != "" {
+		s.summary.ContentTypes[result.ContentType]++
+	}
+
+	s.summary.Transferred += result.ContentLength
+	s.summary.Stored += result.FileSize
+
+	u := result.Item.URL.String()
+
+	s.summary.Slowest = insertTop(s.summary.Slowest, Timing{URL: u, Seconds: took.Seconds()},
+		func(a, b Timing) bool { return a.Seconds > b.Seconds })
+
+	if result.ContentLength > 0 || result.FileSize > 0 {
+		s.summary.Largest = insertTop(s.summary.Largest, Size{URL: u, Transferred: result.ContentLength, Stored: result.FileSize},
+			func(a, b Size) bool { return max(a.Transferred, a.Stored) > max(b.Transferred, b.Stored) })
+	}
+}
+
+// insertTop inserts a value into a list that is kept in order and no longer than topN.
+func insertTop[T any](list []T, v T, before func(a, b T) bool) []T {
+	i := 0
+	for i < len(list) && !before(v, list[i]) {
+		i++
+	}
+
+	if i >= topN {
+		return list
+	}
+
+	list = slices.Insert(list, i, v)
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+// Summary gets a copy of the statistics. If the run has not ended, the duration so far is
+// given.
+func (s *Stats) Summary() Summary {
+	if s == nil {
+		return Summary{} // no-op if absent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := s.summary
+	summary.Statuses = maps.Clone(s.summary.Statuses)
+	summary.ContentTypes = maps.Clone(s.summary.ContentTypes)
+	summary.Slowest = slices.Clone(s.summary.Slowest)
+	summary.Largest = slices.Clone(s.summary.Largest)
+
+	finished := summary.Finished
+	if finished.IsZero() {
+		finished = utc.Now()
+	}
+	if !summary.Started.IsZero() {
+		summary.Seconds = finished.Sub(summary.Started).Seconds()
+	}
+
+	return summary
+}
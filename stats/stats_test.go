@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rickb777/expect"
+	"github.com/rickb777/goscrape2/utc"
+	"github.com/rickb777/goscrape2/work"
+)
+
+func TestStats(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := utc.Now
+	defer func() { utc.Now = now }()
+	utc.Now = func() time.Time { return t0 }
+
+	s := New(mustParse("https://example.org/"))
+	s.Begin()
+
+	s.AddResponse(200)
+	s.AddResponse(200)
+	s.AddResponse(503)
+	s.AddRetry()
+	s.AddThrottle()
+
+	s.AddResult(&work.Result{Item: work.Item{URL: mustParse("https://example.org/")}, StatusCode: 200, ContentType: "text/html", ContentLength: 1000, FileSize: 1200}, 2*time.Second)
+	s.AddResult(&work.Result{Item: work.Item{URL: mustParse("https://example.org/a.png")}, StatusCode: 200, ContentType: "image/png", ContentLength: 5000, FileSize: 3000}, time.Second)
+	s.AddResult(&work.Result{Item: work.Item{URL: mustParse("https://example.org/b.css")}, StatusCode: 304}, 3*time.Second)
+
+	utc.Now = func() time.Time { return t0.Add(time.Minute) }
+	s.End()
+
+	summary := s.Summary()
+	expect.String(summary.URL).ToBe(t, "https://example.org/")
+	expect.Number(summary.Seconds).ToBe(t, 60.0)
+	expect.Map(summary.Statuses).ToBe(t, map[int]int{200: 2, 503: 1})
+	expect.Map(summary.ContentTypes).ToBe(t, map[string]int{"text/html": 1, "image/png": 1})
+	expect.Number(summary.Transferred).ToBe(t, 6000)
+	expect.Number(summary.Stored).ToBe(t, 4200)
+	expect.Number(summary.Retries).ToBe(t, 1)
+	expect.Number(summary.Throttled).ToBe(t, 1)
+	expect.Slice(summary.Slowest).ToBe(t,
+		Timing{URL: "https://example.org/b.css", Seconds: 3},
+		Timing{URL: "https://example.org/", Seconds: 2},
+		Timing{URL: "https://example.org/a.png", Seconds: 1},
+	)
+	expect.Slice(summary.Largest).ToBe(t,
+		Size{URL: "https://example.org/a.png", Transferred: 5000, Stored: 3000},
+		Size{URL: "https://example.org/", Transferred: 1000, Stored: 1200},
+	)
+}
+
+func TestStats_keepsOnlyTheTop(t *testing.T) {
+	s := New(mustParse("https://example.org/"))
+
+	for i := range 2 * topN {
+		u := mustParse(fmt.Sprintf("https://example.org/%d", i))
+		s.AddResult(&work.Result{Item: work.Item{URL: u}, StatusCode: 200, ContentLength: int64(i)}, time.Duration(i)*time.Millisecond)
+	}
+
+	summary := s.Summary()
+	expect.Slice(summary.Slowest).ToHaveLength(t, topN)
+	expect.String(summary.Slowest[0].URL).ToBe(t, "https://example.org/19")
+	expect.String(summary.Slowest[topN-1].URL).ToBe(t, "https://example.org/10")
+	expect.Slice(summary.Largest).ToHaveLength(t, topN)
+	expect.Number(summary.Largest[0].Transferred).ToBe(t, 19)
+}
+
+func TestStats_nil(t *testing.T) {
+	var s *Stats
+	s.Begin()
+	s.AddResponse(200)
+	s.AddResult(&work.Result{Item: work.Item{URL: mustParse("https://example.org/")}}, time.Second)
+	s.End()
+	expect.Number(s.Summary().Retries).ToBe(t, 0)
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
@@ -22,10 +22,11 @@ func (c *Client) GivenResponse(statusCode int, url, contentType, body string, et
 	req, _ := http.NewRequest(http.MethodGet, url, nil)
 	rdr := bytes.NewReader([]byte(body))
 	resp := http.Response{
-		Request:    req,
-		Header:     http.Header{headername.ContentType: []string{contentType}},
-		Body:       io.NopCloser(rdr),
-		StatusCode: statusCode,
+		Request:       req,
+		Header:        http.Header{headername.ContentType: []string{contentType}},
+		Body:          io.NopCloser(rdr),
+		ContentLength: int64(len(body)),
+		StatusCode:    statusCode,
 	}
 	if len(etags) > 0 {
 		resp.Header.Set("ETag", header.ETags(etags).String())
@@ -36,6 +37,19 @@ func (c *Client) GivenResponse(statusCode int, url, contentType, body string, et
 	c.responses[url] = resp
 }
 
+// GivenHeader adds a header to the response already given for a URL.
+func (c *Client) GivenHeader(url, name, value string) {
+	c.responses[url].Header.Add(name, value)
+}
+
+// GivenUnknownLength alters the response already given for a URL so that its length is not
+// declared, as when chunked transfer encoding is used.
+func (c *Client) GivenUnknownLength(url string) {
+	resp := c.responses[url]
+	resp.ContentLength = -1
+	c.responses[url] = resp
+}
+
 func (c *Client) GivenError(url string, expected error) {
 	if c.errors == nil {
 		c.errors = make(map[string]error)
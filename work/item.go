@@ -15,6 +15,7 @@ type Item struct {
 	Referrer  *url.URL
 	Depth     int
 	FilePath  string // returned when the item is processed
+	Manifest  bool   // referenced as a web app manifest, whatever its content type
 }
 
 func (it Item) ChangePath(newPath string) Item {
@@ -51,10 +52,32 @@ type Result struct {
 	StatusCode    int
 	References    Refs
 	Excluded      Refs
-	Location      string // only used for 301-308 redirection
-	ContentLength int64
-	FileSize      int64
-	Gzip          bool
+	Location      string          // only used for 301-308 redirection
+	ContentLength int64           // the bytes transferred
+	FileSize      int64           // the bytes stored
+	Unread        int64           // the declared length of a body that was not read, -1 if undeclared
+	ContentType   string          // the media type of 200 responses
+	Encoding      string          // the Content-Encoding of the transfer, if any
+	Skipped       string          // the reason the response was abandoned, if it was
+	Links         map[string]Link // details of the references in HTML pages, keyed by URL
+	FeedLatest    time.Time       // the newest entry of a feed, stored once its entries have been fetched
+}
+
+// Link describes where a reference was found.
+type Link struct {
+	Text   string // the text of a hyperlink, if any
+	Source string // the element and attribute, e.g. "img srcset", or the kind of header
+	Rel    string // the relations of a link element, e.g. "manifest", if any
+}
+
+// HasRel tests whether the link has a relation, which is case-insensitive.
+func (l Link) HasRel(rel string) bool {
+	for _, r := range strings.Fields(l.Rel) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
 }
 
 func (r Result) IsRedirect() bool {